@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Matrix86/driplane/feeders"
+	"github.com/Matrix86/driplane/filters"
+	"github.com/Matrix86/driplane/schema"
+	"github.com/Matrix86/driplane/utils"
+)
+
+// component is a kind of node that can be used in the rules: filter or feeder
+type component struct {
+	kind     string
+	names    func() []string
+	describe func(name string) (schema.Schema, bool)
+}
+
+var components = []component{
+	{"filter", filters.Names, filters.Describe},
+	{"feeder", feeders.Names, feeders.Describe},
+}
+
+// listCommand prints the available filters and feeders with their description
+func listCommand(args []string) int {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "filters" && args[0] != "feeders") {
+		fmt.Fprintf(os.Stderr, "Usage: driplane list [filters|feeders]\n")
+		return 2
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range components {
+		if len(args) == 1 && args[0] != c.kind+"s" {
+			continue
+		}
+		for _, name := range c.names() {
+			s, _ := c.describe(name)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.kind, name, s.Description)
+		}
+	}
+	w.Flush()
+	return 0
+}
+
+// describeCommand prints the parameters accepted by a filter or a feeder
+func describeCommand(args []string) int {
+	kind := ""
+	if len(args) == 2 && (args[0] == "filter" || args[0] == "feeder") {
+		kind = args[0]
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: driplane describe [filter|feeder] <name>\n")
+		return 2
+	}
+
+	name := args[0]
+	found := 0
+	candidates := make([]string, 0)
+	for _, c := range components {
+		if kind != "" && kind != c.kind {
+			continue
+		}
+		s, ok := c.describe(name)
+		if !ok {
+			candidates = append(candidates, c.names()...)
+			continue
+		}
+		if found > 0 {
+			fmt.Println()
+		}
+		printSchema(os.Stdout, c.kind, name, s)
+		found++
+	}
+
+	if found == 0 {
+		msg := fmt.Sprintf("'%s' doesn't exist", name)
+		if suggestions := utils.Suggest(name, candidates, 3); len(suggestions) > 0 {
+			msg += fmt.Sprintf(", did you mean '%s'?", strings.Join(suggestions, "' or '"))
+		}
+		fmt.Fprintln(os.Stderr, msg)
+		return 1
+	}
+	return 0
+}
+
+// printSchema writes the description of a filter or a feeder and the table of its parameters
+func printSchema(out io.Writer, kind string, name string, s schema.Schema) {
+	fmt.Fprintf(out, "%s %s: %s\n\n", kind, name, s.Description)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "PARAMETER\tTYPE\tDEFAULT\tDESCRIPTION\n")
+	for _, p := range s.Params {
+		def := p.Default
+		if p.Required {
+			def = "required"
+		}
+		desc := p.Description
+		if len(p.Values) > 0 {
+			desc += " (" + strings.Join(p.Values, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, p.Type, def, desc)
+	}
+	w.Flush()
+
+	if s.Open {
+		fmt.Fprintf(out, "\nother parameters are accepted and passed as they are\n")
+	}
+	if len(s.Fields) > 0 {
+		fmt.Fprintf(out, "\nfields set on the messages: %s\n", strings.Join(s.Fields, ", "))
+	}
+	if s.DynamicFields {
+		fmt.Fprintf(out, "\nthe fields set on the messages depend on the input\n")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Matrix86/driplane/core"
+	"github.com/Matrix86/driplane/utils"
+)
+
+// fmtCommand rewrites the rule files in the canonical layout, or only reports the ones to rewrite with -check
+func fmtCommand(args []string) int {
+	var (
+		configFile string
+		rulesPath  string
+		check      bool
+	)
+
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "Set configuration file (optional).")
+	flags.StringVar(&rulesPath, "rules", "", "Path of the rules' directory, used if no file is passed.")
+	flags.BoolVar(&check, "check", false, "Don't write the files, print the ones not formatted and exit with 1 if any.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: driplane fmt [options] [files or directories]\n\nUse - as file to format the stdin on the stdout.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	parser, err := core.NewParser()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		config := core.NewConfiguration()
+		if configFile != "" {
+			if config, err = core.LoadConfiguration(configFile); err != nil {
+				fmt.Fprintf(os.Stderr, "error loading file '%s': %s\n", configFile, err)
+				return 1
+			}
+		}
+		if rulesPath != "" {
+			config.Set("general.rules_path", rulesPath)
+		}
+		if !utils.DirExists(config.Get("general.rules_path")) {
+			fmt.Fprintf(os.Stderr, "rules directory not found: '%s'\n", config.Get("general.rules_path"))
+			return 1
+		}
+		paths = []string{config.Get("general.rules_path")}
+	}
+
+	files := make([]string, 0)
+	for _, path := range paths {
+		if !utils.DirExists(path) {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.rule"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		files = append(files, matches...)
+	}
+
+	status := 0
+	for _, file := range files {
+		var content []byte
+		if file == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = 1
+			continue
+		}
+
+		formatted, err := parser.Format(file, content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = 1
+			continue
+		}
+
+		switch {
+		case file == "-" && check:
+			if !bytes.Equal(content, formatted) {
+				fmt.Println("<stdin>")
+				status = 1
+			}
+		case file == "-":
+			os.Stdout.Write(formatted)
+		case bytes.Equal(content, formatted):
+		case check:
+			fmt.Println(file)
+			status = 1
+		default:
+			if err := os.WriteFile(file, formatted, 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				status = 1
+			}
+		}
+	}
+	return status
+}
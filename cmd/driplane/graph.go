@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Matrix86/driplane/core"
+	"github.com/Matrix86/driplane/utils"
+
+	"github.com/evilsocket/islazy/log"
+)
+
+// graphCommand compiles all the rules and prints how their nodes are connected
+func graphCommand(args []string) int {
+	var (
+		configFile string
+		rulesPath  string
+		format     string
+		outputFile string
+	)
+
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "Set configuration file (optional).")
+	flags.StringVar(&rulesPath, "rules", "", "Path of the rules' directory.")
+	flags.StringVar(&format, "format", "dot", "Output format: dot or mermaid.")
+	flags.StringVar(&outputFile, "o", "", "Write the graph on this file instead of the stdout.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: driplane graph [options]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if format != "dot" && format != "mermaid" {
+		fmt.Fprintf(os.Stderr, "unknown format '%s'\n", format)
+		return 2
+	}
+
+	log.Output = ""
+	log.Level = log.ERROR
+	log.OnFatal = log.ExitOnFatal
+	log.Format = "[{datetime}] {level:color}{level:name}{reset} {message}"
+
+	config := core.NewConfiguration()
+	if configFile != "" {
+		var err error
+		if config, err = core.LoadConfiguration(configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error loading file '%s': %s\n", configFile, err)
+			return 1
+		}
+	}
+	if rulesPath != "" {
+		config.Set("general.rules_path", rulesPath)
+	}
+	if !utils.DirExists(config.Get("general.rules_path")) {
+		fmt.Fprintf(os.Stderr, "rules directory not found: '%s'\n", config.Get("general.rules_path"))
+		return 1
+	}
+
+	if _, err := core.NewOrchestrator(config); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	graph := core.RuleSetInstance().Graph()
+	out := graph.DOT()
+	if format == "mermaid" {
+		out = graph.Mermaid()
+	}
+
+	if outputFile == "" {
+		fmt.Print(out)
+		return 0
+	}
+	if err := os.WriteFile(outputFile, []byte(out), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
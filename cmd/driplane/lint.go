@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Matrix86/driplane/core"
+	"github.com/Matrix86/driplane/utils"
+
+	"github.com/evilsocket/islazy/log"
+)
+
+// lintCommand checks the rules and prints the problems found
+func lintCommand(args []string) int {
+	var (
+		configFile string
+		rulesPath  string
+		format     string
+	)
+
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "Set configuration file (optional).")
+	flags.StringVar(&rulesPath, "rules", "", "Path of the rules' directory.")
+	flags.StringVar(&format, "format", "text", "Output format: text or json.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: driplane lint [options]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format '%s'\n", format)
+		return 2
+	}
+
+	log.Output = ""
+	log.Level = log.ERROR
+	log.OnFatal = log.ExitOnFatal
+	log.Format = "[{datetime}] {level:color}{level:name}{reset} {message}"
+
+	config := core.NewConfiguration()
+	if configFile != "" {
+		var err error
+		if config, err = core.LoadConfiguration(configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error loading file '%s': %s\n", configFile, err)
+			return 1
+		}
+	}
+	if rulesPath != "" {
+		config.Set("general.rules_path", rulesPath)
+	}
+	if !utils.DirExists(config.Get("general.rules_path")) {
+		fmt.Fprintf(os.Stderr, "rules directory not found: '%s'\n", config.Get("general.rules_path"))
+		return 1
+	}
+
+	diagnostics, err := core.Lint(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diagnostics); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
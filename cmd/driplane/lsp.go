@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Matrix86/driplane/core"
+	"github.com/Matrix86/driplane/lsp"
+
+	"github.com/evilsocket/islazy/log"
+)
+
+// lspCommand runs the language server for the rule files on the stdin and the stdout
+func lspCommand(args []string) int {
+	var (
+		configFile string
+		logFile    string
+	)
+
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "Set configuration file (optional).")
+	flags.StringVar(&logFile, "log", os.DevNull, "Write the logs on this file, the stdout is used by the protocol.")
+	flags.Parse(args)
+
+	log.Output = logFile
+	log.Level = log.ERROR
+	log.OnFatal = log.ExitOnFatal
+	log.Format = "[{datetime}] {level:color}{level:name}{reset} {message}"
+	if err := log.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "error opening the log file '%s': %s\n", logFile, err)
+		return 1
+	}
+	defer log.Close()
+
+	config := core.NewConfiguration()
+	if configFile != "" {
+		var err error
+		if config, err = core.LoadConfiguration(configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error loading file '%s': %s\n", configFile, err)
+			return 1
+		}
+	}
+
+	if err := lsp.NewServer(config).Serve(os.Stdin, os.Stdout); err != nil {
+		log.Error("lsp: %s", err)
+		return 1
+	}
+	return 0
+}
@@ -26,7 +26,17 @@ var (
 	configFile string
 
 	mainOrchestrator *core.Orchestrator
-	quitSignal       = false
+
+	// subcommands that can be used instead of running the rules (i.e. driplane test ...)
+	commands = map[string]func(args []string) int{
+		"test":     testCommand,
+		"graph":    graphCommand,
+		"list":     listCommand,
+		"describe": describeCommand,
+		"lint":     lintCommand,
+		"lsp":      lspCommand,
+		"fmt":      fmtCommand,
+	}
 )
 
 // Signal stops feeders on SIGINT or SIGTERM signal interception
@@ -40,7 +50,6 @@ func Signal() {
 		case os.Interrupt, syscall.SIGTERM:
 			log.Debug("CTRL-C detected")
 			if mainOrchestrator != nil {
-				quitSignal = true
 				mainOrchestrator.StopFeeders()
 			}
 			return
@@ -76,10 +85,11 @@ func Update(cfg *core.Configuration) {
 	for {
 		select {
 		case v := <-s.GetEvents():
-			log.Info("Event '%s' on File '%s'...restarting", v.TypeString(), v.Key)
+			log.Info("Event '%s' on File '%s'...reloading", v.TypeString(), v.Key)
 			if mainOrchestrator != nil {
-				log.Debug("Stopping")
-				mainOrchestrator.StopFeeders()
+				if err := mainOrchestrator.Reload(); err != nil {
+					log.Error("AutoUpdate: %s", err)
+				}
 			}
 
 		case e := <-s.GetErrors():
@@ -89,6 +99,12 @@ func Update(cfg *core.Configuration) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
 	flag.StringVar(&configFile, "config", "", "Set configuration file.")
 	flag.StringVar(&rulePath, "rules", "", "Path of the rules' directory.")
 	flag.StringVar(&jsPath, "js", "", "Path of the js plugins.")
@@ -170,21 +186,25 @@ func main() {
 
 	go Signal()
 
-	for !quitSignal {
-		mainOrchestrator, err = core.NewOrchestrator(config)
-		if err != nil {
-			log.Fatal("%s", err)
-		}
+	mainOrchestrator, err = core.NewOrchestrator(config)
+	if err != nil {
+		log.Fatal("%s", err)
+	}
+
+	if dryRunFlag {
+		os.Exit(0)
+	}
 
-		if dryRunFlag {
-			os.Exit(0)
+	if config.Get("general.admin.enable") == "true" {
+		if err := mainOrchestrator.StartAdmin(); err != nil {
+			log.Fatal("%s", err)
 		}
+	}
 
-		log.Debug("Trying to start orchestrator")
-		mainOrchestrator.StartFeeders()
-		mainOrchestrator.WaitFeeders()
+	log.Debug("Trying to start orchestrator")
+	mainOrchestrator.StartFeeders()
+	mainOrchestrator.WaitFeeders()
 
-		log.Debug("Stopping")
-		mainOrchestrator.StopFeeders()
-	}
+	log.Debug("Stopping")
+	mainOrchestrator.StopFeeders()
 }
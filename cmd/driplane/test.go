@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Matrix86/driplane/core"
+	"github.com/Matrix86/driplane/data"
+
+	"github.com/evilsocket/islazy/log"
+)
+
+func readMessagesFile(filename string) ([]*data.Message, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	messages, err := core.ReadMessages(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s': %s", filename, err)
+	}
+	return messages, nil
+}
+
+// testCommand runs a rule against the messages of a fixture file, printing the results or comparing them with the expected ones
+func testCommand(args []string) int {
+	var (
+		configFile   string
+		ruleName     string
+		inputFile    string
+		expectedFile string
+		debug        bool
+	)
+
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "Set configuration file (optional).")
+	flags.StringVar(&ruleName, "rule", "", "Name of the rule to test (optional if the file contains only one rule).")
+	flags.StringVar(&inputFile, "input", "", "JSONL file with the messages to send to the rule.")
+	flags.StringVar(&expectedFile, "expected", "", "JSONL file with the messages expected at the end of the rule.")
+	flags.BoolVar(&debug, "debug", false, "Enable debug logs.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: driplane test [options] file.rule\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || inputFile == "" {
+		flags.Usage()
+		return 2
+	}
+	ruleFile := flags.Arg(0)
+
+	log.Output = ""
+	log.Level = log.ERROR
+	if debug {
+		log.Level = log.DEBUG
+	}
+	log.Format = "[{datetime}] {level:color}{level:name}{reset} {message}"
+
+	config := core.NewConfiguration()
+	if configFile != "" {
+		var err error
+		if config, err = core.LoadConfiguration(configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error loading file '%s': %s\n", configFile, err)
+			return 1
+		}
+	}
+	if config.Get("general.rules_path") == "" {
+		config.Set("general.rules_path", filepath.Dir(ruleFile))
+	}
+
+	input, err := readMessagesFile(inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	tester, err := core.NewRuleTester(config, ruleFile, ruleName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	output := tester.Run(input)
+
+	if expectedFile == "" {
+		if err := core.WriteMessages(os.Stdout, output); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	expected, err := readMessagesFile(expectedFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	diffs, err := core.CompareMessages(expected, output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	if len(diffs) > 0 {
+		fmt.Printf("FAIL %s\n", ruleFile)
+		for _, d := range diffs {
+			fmt.Printf("  %s\n", d)
+		}
+		return 1
+	}
+	fmt.Printf("PASS %s (%d messages in, %d messages out)\n", ruleFile, len(input), len(output))
+	return 0
+}
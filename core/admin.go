@@ -0,0 +1,218 @@
+package core
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Matrix86/driplane/feeders"
+	"github.com/Matrix86/driplane/filters"
+	"github.com/Matrix86/driplane/metrics"
+
+	"github.com/evilsocket/islazy/log"
+)
+
+const defaultAdminAddress = "127.0.0.1:8090"
+
+// AdminServer exposes the state of the Orchestrator through a JSON HTTP API
+type AdminServer struct {
+	orchestrator *Orchestrator
+	address      string
+	token        string
+
+	server *http.Server
+}
+
+// AdminRule is the JSON representation of a PipeRule
+type AdminRule struct {
+	Identifier   string       `json:"identifier"`
+	Name         string       `json:"name"`
+	File         string       `json:"file"`
+	Dependencies []string     `json:"dependencies"`
+	Feeder       *AdminFeeder `json:"feeder,omitempty"`
+	Filters      []string     `json:"filters"`
+}
+
+// AdminFeeder is the JSON representation of a Feeder
+type AdminFeeder struct {
+	Rule       string `json:"rule"`
+	Name       string `json:"name"`
+	Identifier string `json:"identifier"`
+	Running    bool   `json:"running"`
+}
+
+// NewAdminServer creates the admin API reading its configuration from the general.admin section
+func NewAdminServer(o *Orchestrator, config *Configuration) *AdminServer {
+	a := &AdminServer{
+		orchestrator: o,
+		address:      defaultAdminAddress,
+		token:        config.Get("general.admin.token"),
+	}
+	if v := config.Get("general.admin.address"); v != "" {
+		a.address = v
+	}
+	return a
+}
+
+// Start opens the listening socket and serves the API in background
+func (a *AdminServer) Start() error {
+	l, err := net.Listen("tcp", a.address)
+	if err != nil {
+		return fmt.Errorf("admin API: %s", err)
+	}
+	a.server = &http.Server{
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Info("admin API listening on %s", l.Addr())
+	go func() {
+		if err := a.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Error("admin API: %s", err)
+		}
+	}()
+	return nil
+}
+
+// Stop shuts down the API
+func (a *AdminServer) Stop() {
+	if a.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		log.Error("admin API shutdown: %s", err)
+	}
+	a.server = nil
+}
+
+// Handler returns the http.Handler serving the API
+func (a *AdminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/rules", a.handleRules)
+	mux.HandleFunc("GET /api/files", a.handleFiles)
+	mux.HandleFunc("GET /api/feeders", a.handleFeeders)
+	mux.HandleFunc("POST /api/feeders/{rule}/start", a.handleFeederStart)
+	mux.HandleFunc("POST /api/feeders/{rule}/stop", a.handleFeederStop)
+	mux.HandleFunc("POST /api/reload", a.handleReload)
+	mux.Handle("GET /metrics", metrics.Handler())
+	return a.authenticate(mux)
+}
+
+func (a *AdminServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + a.token)
+		if a.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("admin API: encoding response: %s", err)
+	}
+}
+
+func newAdminFeeder(rule string, f feeders.Feeder) *AdminFeeder {
+	return &AdminFeeder{
+		Rule:       rule,
+		Name:       f.Name(),
+		Identifier: f.GetIdentifier(),
+		Running:    f.IsRunning(),
+	}
+}
+
+func (a *AdminServer) handleRules(w http.ResponseWriter, r *http.Request) {
+	a.orchestrator.Lock()
+	defer a.orchestrator.Unlock()
+
+	rs := RuleSetInstance()
+	rules := make([]*AdminRule, 0, len(rs.rules))
+	for id, rule := range rs.rules {
+		ar := &AdminRule{
+			Identifier:   id,
+			Name:         rule.Name,
+			File:         rule.file,
+			Dependencies: rule.dependencies,
+			Filters:      make([]string, 0),
+		}
+		if ar.Dependencies == nil {
+			ar.Dependencies = []string{}
+		}
+		for _, n := range rule.nodes {
+			switch node := n.(type) {
+			case feeders.Feeder:
+				ar.Feeder = newAdminFeeder(id, node)
+			case filters.Filter:
+				ar.Filters = append(ar.Filters, node.GetIdentifier())
+			}
+		}
+		rules = append(rules, ar)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Identifier < rules[j].Identifier
+	})
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (a *AdminServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	a.orchestrator.Lock()
+	defer a.orchestrator.Unlock()
+
+	files := make(map[string][]string)
+	for file, deps := range RuleSetInstance().compiledDeps {
+		files[file] = deps
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+func (a *AdminServer) handleFeeders(w http.ResponseWriter, r *http.Request) {
+	a.orchestrator.Lock()
+	defer a.orchestrator.Unlock()
+
+	rs := RuleSetInstance()
+	list := make([]*AdminFeeder, 0, len(rs.feedRules))
+	for _, name := range rs.feedRules {
+		list = append(list, newAdminFeeder(name, rs.rules[name].getFirstNode().(feeders.Feeder)))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleFeederStart starts the feeder of a rule. The complete identifiers contain the path of the file, so they have
+// to be escaped in the URL: PathValue returns them unescaped.
+func (a *AdminServer) handleFeederStart(w http.ResponseWriter, r *http.Request) {
+	rule := r.PathValue("rule")
+	if err := a.orchestrator.StartFeeder(rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "started", "rule": rule})
+}
+
+func (a *AdminServer) handleFeederStop(w http.ResponseWriter, r *http.Request) {
+	rule := r.PathValue("rule")
+	if err := a.orchestrator.StopFeeder(rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "stopped", "rule": rule})
+}
+
+func (a *AdminServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := a.orchestrator.Reload(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
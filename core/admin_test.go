@@ -0,0 +1,173 @@
+package core
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdminServer_API(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "admin.rule")
+	content := "admin_feed_rule => <timer: freq='1h'> | echo();\n" +
+		"admin_filter_rule => echo() | echo();"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+
+	config := &Configuration{
+		flat: map[string]string{
+			"general.rules_path":  dir,
+			"general.admin.token": "secret",
+		},
+	}
+	o, err := NewOrchestrator(config)
+	if err != nil {
+		t.Fatalf("NewOrchestrator returned error: %s", err)
+	}
+	defer o.StopFeeders()
+
+	ts := httptest.NewServer(NewAdminServer(o, config).Handler())
+	defer ts.Close()
+
+	abs, _ := filepath.Abs(ruleFile)
+	feedRule := abs + ":admin_feed_rule"
+
+	request := func(method string, path string, token string, v interface{}) int {
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("%s %s: decoding: %s", method, path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	if status := request("GET", "/api/rules", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("wrong status without token: expected=%d had=%d", http.StatusUnauthorized, status)
+	}
+	if status := request("GET", "/api/rules", "secre", nil); status != http.StatusUnauthorized {
+		t.Errorf("wrong status with a wrong token: expected=%d had=%d", http.StatusUnauthorized, status)
+	}
+
+	var rules []*AdminRule
+	if status := request("GET", "/api/rules", "secret", &rules); status != http.StatusOK {
+		t.Fatalf("wrong status: expected=%d had=%d", http.StatusOK, status)
+	}
+	found := 0
+	for _, r := range rules {
+		switch r.Identifier {
+		case feedRule:
+			found++
+			if r.Feeder == nil || r.Feeder.Running || len(r.Filters) != 1 {
+				t.Errorf("wrong feeder rule: %#v", r)
+			}
+		case abs + ":admin_filter_rule":
+			found++
+			if r.Feeder != nil || len(r.Filters) != 2 || r.File != abs {
+				t.Errorf("wrong filter rule: %#v", r)
+			}
+		}
+	}
+	if found != 2 {
+		t.Errorf("rules not found in the response: %#v", rules)
+	}
+
+	escaped := "/api/feeders/" + url.PathEscape(feedRule)
+	if status := request("POST", escaped+"/start", "secret", nil); status != http.StatusOK {
+		t.Errorf("wrong status on start: expected=%d had=%d", http.StatusOK, status)
+	}
+	if status := request("POST", escaped+"/start", "secret", nil); status != http.StatusBadRequest {
+		t.Errorf("starting a running feeder should fail: had=%d", status)
+	}
+
+	var list []*AdminFeeder
+	request("GET", "/api/feeders", "secret", &list)
+	running := false
+	for _, f := range list {
+		if f.Rule == feedRule {
+			running = f.Running
+		}
+	}
+	if !running {
+		t.Errorf("the feeder should be running: %#v", list)
+	}
+
+	if status := request("POST", "/api/feeders/admin_feed_rule/stop", "secret", nil); status != http.StatusOK {
+		t.Errorf("wrong status on stop using the rule name: expected=%d had=%d", http.StatusOK, status)
+	}
+	if status := request("POST", "/api/feeders/admin_filter_rule/stop", "secret", nil); status != http.StatusBadRequest {
+		t.Errorf("stopping a rule without feeder should fail: had=%d", status)
+	}
+
+	var files map[string][]string
+	if status := request("GET", "/api/files", "secret", &files); status != http.StatusOK {
+		t.Errorf("wrong status: expected=%d had=%d", http.StatusOK, status)
+	}
+	if _, ok := files[abs]; !ok {
+		t.Errorf("file '%s' not found in %#v", abs, files)
+	}
+
+	if status := request("POST", "/api/reload", "secret", nil); status != http.StatusOK {
+		t.Errorf("wrong status on reload: expected=%d had=%d", http.StatusOK, status)
+	}
+}
+
+func TestAdminServer_StopWithPendingRequest(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	config := &Configuration{
+		flat: map[string]string{
+			"general.rules_path":    t.TempDir(),
+			"general.admin.address": address,
+		},
+	}
+	o, err := NewOrchestrator(config)
+	if err != nil {
+		t.Fatalf("NewOrchestrator returned error: %s", err)
+	}
+	if err := o.StartAdmin(); err != nil {
+		t.Fatalf("StartAdmin returned error: %s", err)
+	}
+
+	// the Orchestrator is stopped while a request is waiting for its lock
+	o.Lock()
+	stopped := make(chan bool)
+	go func() {
+		o.StopFeeders()
+		close(stopped)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	go func() {
+		if resp, err := http.Get("http://" + address + "/api/rules"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	o.Unlock()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Error("the admin API should stop without waiting the shutdown timeout")
+	}
+}
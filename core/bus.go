@@ -0,0 +1,346 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/Matrix86/driplane/filters"
+	"github.com/Matrix86/driplane/metrics"
+)
+
+// Bus is the event bus used by the Ruleset to connect the nodes.
+// It implements the EventBus.Bus interface required by feeders and filters and it keeps track of the
+// owner of each subscription, so all the handlers of a rule can be removed at once during a reload.
+// The messages sent to the filters wait in a bounded queue, processed by a fixed number of workers.
+type Bus struct {
+	sync.Mutex
+
+	handlers map[string][]*busHandler
+	queues   map[string]*workQueue
+	wg       sync.WaitGroup
+}
+
+type busHandler struct {
+	sync.Mutex
+
+	owner         string
+	subscriber    string
+	callback      reflect.Value
+	once          bool
+	async         bool
+	transactional bool
+	// if set the calls are executed by the workers of the queue
+	queue *workQueue
+}
+
+// workQueue is the FIFO of the calls waiting to be executed by the workers of a node
+type workQueue struct {
+	sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	owner   string
+	rule    string
+	node    string
+	options filters.Queue
+	calls   []queuedCall
+	closed  bool
+	wg      *sync.WaitGroup
+}
+
+type queuedCall struct {
+	handler *busHandler
+	args    []interface{}
+}
+
+// NewBus creates a new empty Bus
+func NewBus() *Bus {
+	return &Bus{
+		handlers: make(map[string][]*busHandler),
+		queues:   make(map[string]*workQueue),
+	}
+}
+
+func (b *Bus) doSubscribe(topic string, fn interface{}, handler *busHandler) error {
+	if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		return fmt.Errorf("%v is not of type reflect.Func", reflect.TypeOf(fn))
+	}
+	handler.callback = reflect.ValueOf(fn)
+
+	b.Lock()
+	defer b.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], handler)
+	return nil
+}
+
+// Subscribe subscribes to a topic
+func (b *Bus) Subscribe(topic string, fn interface{}) error {
+	return b.doSubscribe(topic, fn, &busHandler{})
+}
+
+// SubscribeAsync subscribes to a topic with an asynchronous callback.
+// If transactional is true the callbacks for the topic are run serially.
+func (b *Bus) SubscribeAsync(topic string, fn interface{}, transactional bool) error {
+	return b.doSubscribe(topic, fn, &busHandler{async: true, transactional: transactional})
+}
+
+// SubscribeOnce subscribes to a topic once, the handler will be removed after executing
+func (b *Bus) SubscribeOnce(topic string, fn interface{}) error {
+	return b.doSubscribe(topic, fn, &busHandler{once: true})
+}
+
+// SubscribeOnceAsync subscribes to a topic once with an asynchronous callback
+func (b *Bus) SubscribeOnceAsync(topic string, fn interface{}) error {
+	return b.doSubscribe(topic, fn, &busHandler{once: true, async: true})
+}
+
+// subscribeOwned subscribes to a topic with an asynchronous callback, tracking the owner of the subscription
+// and the identifier of the node receiving the messages
+func (b *Bus) subscribeOwned(owner string, subscriber string, topic string, fn interface{}, transactional bool) error {
+	return b.doSubscribe(topic, fn, &busHandler{owner: owner, subscriber: subscriber, async: true, transactional: transactional})
+}
+
+// setQueue creates the queue of the node identified by subscriber and starts its workers.
+// The messages are delivered through the queue to the callbacks subscribed with subscribeQueued.
+func (b *Bus) setQueue(owner string, rule string, subscriber string, options filters.Queue) {
+	q := &workQueue{
+		owner:   owner,
+		rule:    rule,
+		node:    subscriber,
+		options: options,
+		wg:      &b.wg,
+	}
+	q.notEmpty = sync.NewCond(q)
+	q.notFull = sync.NewCond(q)
+	for i := 0; i < options.Workers; i++ {
+		go q.work()
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if old, ok := b.queues[subscriber]; ok {
+		old.close()
+	}
+	b.queues[subscriber] = q
+}
+
+// subscribeQueued subscribes to a topic the callback of a node, executed by the workers of the queue created by setQueue
+func (b *Bus) subscribeQueued(owner string, subscriber string, topic string, fn interface{}) error {
+	b.Lock()
+	q, ok := b.queues[subscriber]
+	b.Unlock()
+	if !ok {
+		return fmt.Errorf("the queue of %s doesn't exist", subscriber)
+	}
+	return b.doSubscribe(topic, fn, &busHandler{owner: owner, subscriber: subscriber, async: true, queue: q})
+}
+
+// subscribers returns, for each topic, the identifiers of the nodes subscribed to it
+func (b *Bus) subscribers() map[string][]string {
+	b.Lock()
+	defer b.Unlock()
+
+	result := make(map[string][]string)
+	for topic, handlers := range b.handlers {
+		for _, h := range handlers {
+			if h.subscriber != "" {
+				result[topic] = append(result[topic], h.subscriber)
+			}
+		}
+	}
+	return result
+}
+
+// Unsubscribe removes the first callback of the topic matching the handler
+func (b *Bus) Unsubscribe(topic string, handler interface{}) error {
+	b.Lock()
+	defer b.Unlock()
+
+	handlers, ok := b.handlers[topic]
+	if !ok || len(handlers) == 0 {
+		return fmt.Errorf("topic %s doesn't exist", topic)
+	}
+	callback := reflect.ValueOf(handler)
+	for i, h := range handlers {
+		if h.callback.Type() == callback.Type() && h.callback.Pointer() == callback.Pointer() {
+			b.removeHandler(topic, i)
+			break
+		}
+	}
+	return nil
+}
+
+// unsubscribeOwner removes all the callbacks subscribed by owner
+func (b *Bus) unsubscribeOwner(owner string) {
+	b.Lock()
+	defer b.Unlock()
+
+	for topic, handlers := range b.handlers {
+		kept := make([]*busHandler, 0, len(handlers))
+		for _, h := range handlers {
+			if h.owner != owner {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == 0 {
+			delete(b.handlers, topic)
+		} else {
+			b.handlers[topic] = kept
+		}
+	}
+	for subscriber, q := range b.queues {
+		if q.owner == owner {
+			q.close()
+			delete(b.queues, subscriber)
+		}
+	}
+}
+
+func (b *Bus) removeHandler(topic string, idx int) {
+	handlers := b.handlers[topic]
+	if idx < 0 || idx >= len(handlers) {
+		return
+	}
+	b.handlers[topic] = append(handlers[:idx:idx], handlers[idx+1:]...)
+}
+
+// HasCallback returns true if exists any callback subscribed to the topic
+func (b *Bus) HasCallback(topic string) bool {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.handlers[topic]) > 0
+}
+
+// Publish executes the callbacks subscribed to the topic passing them the args
+func (b *Bus) Publish(topic string, args ...interface{}) {
+	b.Lock()
+	handlers := make([]*busHandler, len(b.handlers[topic]))
+	copy(handlers, b.handlers[topic])
+	for _, h := range handlers {
+		if h.once {
+			for i, hh := range b.handlers[topic] {
+				if hh == h {
+					b.removeHandler(topic, i)
+					break
+				}
+			}
+		}
+	}
+	b.Unlock()
+
+	for _, h := range handlers {
+		if !h.async {
+			h.call(args...)
+			continue
+		}
+		if h.queue != nil {
+			h.queue.push(h, args)
+			continue
+		}
+
+		b.wg.Add(1)
+		if h.transactional {
+			// the lock is released by the goroutine, so the next Publish waits until this call ends
+			h.Lock()
+		}
+		go func(h *busHandler) {
+			defer b.wg.Done()
+			if h.transactional {
+				defer h.Unlock()
+			}
+			h.call(args...)
+		}(h)
+	}
+}
+
+func (h *busHandler) call(args ...interface{}) {
+	funcType := h.callback.Type()
+	in := make([]reflect.Value, len(args))
+	for i, v := range args {
+		if v == nil {
+			in[i] = reflect.New(funcType.In(i)).Elem()
+		} else {
+			in[i] = reflect.ValueOf(v)
+		}
+	}
+	h.callback.Call(in)
+}
+
+// push adds a call to the queue. If the queue is full the call waits for a free slot, or a call is discarded,
+// depending on the overflow policy.
+func (q *workQueue) push(h *busHandler, args []interface{}) {
+	q.wg.Add(1)
+	q.Lock()
+	defer q.Unlock()
+
+	for len(q.calls) >= q.options.Size && !q.closed {
+		switch q.options.Overflow {
+		case filters.OverflowDropNewest:
+			q.dropped()
+			return
+		case filters.OverflowDropOldest:
+			q.pop()
+			q.dropped()
+		default:
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		// the rule has been removed
+		q.wg.Done()
+		return
+	}
+	q.calls = append(q.calls, queuedCall{handler: h, args: args})
+	metrics.QueueLength(q.rule, q.node, len(q.calls))
+	q.notEmpty.Signal()
+}
+
+// pop removes the first call of the queue, the lock has to be held by the caller
+func (q *workQueue) pop() queuedCall {
+	c := q.calls[0]
+	q.calls[0] = queuedCall{}
+	q.calls = q.calls[1:]
+	metrics.QueueLength(q.rule, q.node, len(q.calls))
+	q.notFull.Signal()
+	return c
+}
+
+// dropped accounts a call discarded by the overflow policy, the lock has to be held by the caller
+func (q *workQueue) dropped() {
+	metrics.QueueDropped(q.rule, q.node)
+	q.wg.Done()
+}
+
+// work executes the calls of the queue until it is closed and empty
+func (q *workQueue) work() {
+	for {
+		q.Lock()
+		for len(q.calls) == 0 && !q.closed {
+			q.notEmpty.Wait()
+		}
+		if len(q.calls) == 0 {
+			q.Unlock()
+			return
+		}
+		c := q.pop()
+		q.Unlock()
+
+		c.handler.call(c.args...)
+		q.wg.Done()
+	}
+}
+
+// close stops the workers after the execution of the calls already in the queue, the new calls are discarded
+func (q *workQueue) close() {
+	q.Lock()
+	defer q.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// WaitAsync waits for all the async callbacks to complete
+func (b *Bus) WaitAsync() {
+	b.wg.Wait()
+}
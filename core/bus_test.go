@@ -0,0 +1,236 @@
+package core
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Matrix86/driplane/filters"
+)
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	b := NewBus()
+
+	var mu sync.Mutex
+	received := make([]string, 0)
+	handler := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, s)
+	}
+
+	if err := b.Subscribe("topic", handler); err != nil {
+		t.Fatalf("Subscribe returned error: %s", err)
+	}
+	if err := b.SubscribeAsync("topic", handler, false); err != nil {
+		t.Fatalf("SubscribeAsync returned error: %s", err)
+	}
+	if err := b.SubscribeOnce("topic", handler); err != nil {
+		t.Fatalf("SubscribeOnce returned error: %s", err)
+	}
+	if err := b.Subscribe("topic", "not a function"); err == nil {
+		t.Error("Subscribe should return an error if the handler is not a function")
+	}
+
+	b.Publish("topic", "first")
+	b.Publish("topic", "second")
+	b.WaitAsync()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 5 {
+		t.Errorf("wrong number of calls: expected=%d had=%d", 5, len(received))
+	}
+}
+
+func TestBus_UnsubscribeOwner(t *testing.T) {
+	b := NewBus()
+	calls := 0
+	handler := func(s string) {}
+
+	_ = b.subscribeOwned("rule1", "node1", "topic1", handler, false)
+	_ = b.subscribeOwned("rule1", "node1", "topic2", handler, false)
+	_ = b.subscribeOwned("rule2", "node2", "topic2", func(s string) { calls++ }, true)
+
+	b.unsubscribeOwner("rule1")
+	if b.HasCallback("topic1") {
+		t.Error("topic1 should not have callbacks")
+	}
+	if !b.HasCallback("topic2") {
+		t.Error("topic2 should still have the callback of rule2")
+	}
+
+	b.Publish("topic2", "msg")
+	b.WaitAsync()
+	if calls != 1 {
+		t.Errorf("the handler of rule2 should be called once, had=%d", calls)
+	}
+}
+
+func TestBus_Transactional(t *testing.T) {
+	b := NewBus()
+
+	var mu sync.Mutex
+	received := make([]int, 0)
+	_ = b.SubscribeAsync("topic", func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, i)
+	}, true)
+
+	for i := 0; i < 100; i++ {
+		b.Publish("topic", i)
+	}
+	b.WaitAsync()
+
+	for i, v := range received {
+		if i != v {
+			t.Fatalf("transactional handler received messages out of order: %v", received)
+		}
+	}
+}
+
+func TestBus_QueueWorkers(t *testing.T) {
+	type Test struct {
+		Name    string
+		Workers int
+	}
+	tests := []Test{
+		{"OneWorker", 1},
+		{"ManyWorkers", 3},
+	}
+
+	for _, v := range tests {
+		b := NewBus()
+		b.setQueue("rule1", "rule1", "node1", filters.Queue{Workers: v.Workers, Size: 1000, Overflow: filters.OverflowBlock})
+
+		var mu sync.Mutex
+		running, max := 0, 0
+		received := make([]int, 0)
+		handler := func(i int) {
+			mu.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			received = append(received, i)
+			mu.Unlock()
+		}
+		if err := b.subscribeQueued("rule1", "node1", "topic", handler); err != nil {
+			t.Fatalf("%s: unexpected error: %s", v.Name, err)
+		}
+
+		for i := 0; i < 30; i++ {
+			b.Publish("topic", i)
+		}
+		b.WaitAsync()
+
+		if len(received) != 30 {
+			t.Errorf("%s: wrong number of calls: expected=%d had=%d", v.Name, 30, len(received))
+		}
+		if max > v.Workers {
+			t.Errorf("%s: too many concurrent calls: expected=%d had=%d", v.Name, v.Workers, max)
+		}
+		if v.Workers == 1 && !sort.IntsAreSorted(received) {
+			t.Errorf("%s: calls executed out of order: %v", v.Name, received)
+		}
+		b.unsubscribeOwner("rule1")
+	}
+}
+
+func TestBus_QueueOverflow(t *testing.T) {
+	type Test struct {
+		Overflow string
+		Expected []int
+		Dropped  bool
+	}
+	tests := []Test{
+		{filters.OverflowBlock, []int{0, 1, 2, 3, 4}, false},
+		{filters.OverflowDropNewest, []int{0, 1, 2}, true},
+		{filters.OverflowDropOldest, []int{0, 3, 4}, true},
+	}
+
+	for _, v := range tests {
+		b := NewBus()
+		b.setQueue("rule1", "rule1", "node1", filters.Queue{Workers: 1, Size: 2, Overflow: v.Overflow})
+
+		var mu sync.Mutex
+		received := make([]int, 0)
+		started := make(chan bool)
+		release := make(chan bool)
+		_ = b.subscribeQueued("rule1", "node1", "topic", func(i int) {
+			if i == 0 {
+				// the worker is kept busy until the queue is full
+				started <- true
+				<-release
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, i)
+		})
+
+		b.Publish("topic", 0)
+		<-started
+		done := make(chan bool)
+		go func() {
+			for i := 1; i < 5; i++ {
+				b.Publish("topic", i)
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			if !v.Dropped {
+				t.Errorf("%s: the publisher should wait for a free slot", v.Overflow)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if v.Dropped {
+				t.Errorf("%s: the publisher should not wait", v.Overflow)
+			}
+		}
+		close(release)
+		<-done
+		b.WaitAsync()
+
+		mu.Lock()
+		if !reflect.DeepEqual(received, v.Expected) {
+			t.Errorf("%s: wrong calls: expected=%v had=%v", v.Overflow, v.Expected, received)
+		}
+		mu.Unlock()
+		b.unsubscribeOwner("rule1")
+	}
+}
+
+func TestBus_QueueClosed(t *testing.T) {
+	b := NewBus()
+	b.setQueue("rule1", "rule1", "node1", filters.Queue{Workers: 1, Size: 10, Overflow: filters.OverflowBlock})
+	calls := 0
+	if err := b.subscribeQueued("rule1", "node1", "topic", func(i int) { calls++ }); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := b.subscribeQueued("rule1", "node2", "topic", func(i int) {}); err == nil {
+		t.Error("subscribing a node without a queue should return an error")
+	}
+
+	b.Publish("topic", 1)
+	b.WaitAsync()
+	q := b.queues["node1"]
+	b.unsubscribeOwner("rule1")
+	if _, ok := b.queues["node1"]; ok {
+		t.Error("the queue of the removed rule should be deleted")
+	}
+
+	// a message published while the rule was being removed is discarded
+	q.push(&busHandler{}, []interface{}{2})
+	b.WaitAsync()
+	if calls != 1 {
+		t.Errorf("wrong number of calls: expected=%d had=%d", 1, calls)
+	}
+}
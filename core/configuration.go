@@ -18,6 +18,13 @@ type Configuration struct {
 	flat     map[string]string
 }
 
+// NewConfiguration creates an empty Configuration
+func NewConfiguration() *Configuration {
+	return &Configuration{
+		flat: make(map[string]string),
+	}
+}
+
 // LoadConfiguration create a Configuration struct from a filename
 func LoadConfiguration(path string) (*Configuration, error) {
 	configuration := &Configuration{
@@ -37,6 +44,13 @@ func LoadConfiguration(path string) (*Configuration, error) {
 		return configuration, fmt.Errorf("loading configuration: %s", err)
 	}
 	configuration.flat = configuration.flatMap(cc)
+	for k, v := range configuration.flat {
+		value, err := Interpolate(v)
+		if err != nil {
+			return configuration, fmt.Errorf("loading configuration: key '%s': %s", k, err)
+		}
+		configuration.flat[k] = value
+	}
 
 	return configuration, nil
 }
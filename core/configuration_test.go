@@ -22,7 +22,10 @@ func TestLoadConfiguration(t *testing.T) {
 		{"NotYamlFile", path.Join(os.TempDir(), "configuration_file_test.yml"), true, "asd {}", &Configuration{}, errors.New("")},
 		{"EmptyYamlFile", path.Join(os.TempDir(), "configuration_file_test.yml"), true, "", &Configuration{flat: map[string]string{}}, nil},
 		{"GoodYamlFile", path.Join(os.TempDir(), "configuration_file_test.yml"), true, "general:\n  config: true", &Configuration{flat: map[string]string{"general.config": "true"}}, nil},
+		{"Interpolation", path.Join(os.TempDir(), "configuration_file_test.yml"), true, "slack:\n  bot_token: \"${DRIPLANE_TEST_TOKEN}\"\n  user: \"${DRIPLANE_TEST_UNSET:-bot}\"", &Configuration{flat: map[string]string{"slack.bot_token": "secret", "slack.user": "bot"}}, nil},
+		{"InterpolationError", path.Join(os.TempDir(), "configuration_file_test.yml"), true, "slack:\n  bot_token: \"${DRIPLANE_TEST_UNSET}\"", &Configuration{}, errors.New("")},
 	}
+	t.Setenv("DRIPLANE_TEST_TOKEN", "secret")
 	for _, v := range tests {
 		if v.CreateFile {
 			file, err := os.Create(v.Filename)
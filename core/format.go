@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// the keys of a map that can be written without quotes
+var identRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z_\d-]*$`)
+
+// indentation of the lines starting with a '|' and of the content of the braces
+const formatIndent = "  "
+
+// sourceLine is a line of a rule file starting with '#': a comment, an #import or a #define
+type sourceLine struct {
+	line int
+	text string
+	// the line is preceded by an empty line
+	spaced bool
+}
+
+// formatter writes the AST of a file in the canonical layout, putting back the comments found in the source
+type formatter struct {
+	buf      bytes.Buffer
+	lines    []string
+	comments []sourceLine
+}
+
+// Format parses the content of a rule file and writes it in the canonical layout:
+// one node of the pipeline per line, the strings in double quotes and the branches and conditions indented.
+// The comments, the #import and the #define lines are kept as they are.
+// The imported files are not read, so the content can be formatted alone.
+func (p *Parser) Format(filename string, content []byte) ([]byte, error) {
+	ast := &AST{}
+	if err := p.handle.Parse(&namedReader{Reader: bytes.NewReader(content), name: filename}, ast); err != nil {
+		return nil, parseError(err, string(content), filename)
+	}
+
+	f := &formatter{lines: strings.Split(string(content), "\n")}
+	if err := f.findComments(string(content)); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range ast.Rules {
+		f.flushComments(rule.Pos.Line, true)
+		f.separate(f.spaced(rule.Pos.Line))
+		f.rule(rule)
+	}
+	f.flushComments(len(f.lines)+1, true)
+	if f.buf.Len() > 0 {
+		f.buf.WriteString("\n")
+	}
+	return f.buf.Bytes(), nil
+}
+
+// findComments collects the lines starting with '#', skipping the ones inside a multi-line string
+func (f *formatter) findComments(content string) error {
+	tokens, err := Tokenize(content)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for i, text := range f.lines {
+		start := offset
+		offset += len(text) + 1
+		if !strings.HasPrefix(text, "#") {
+			continue
+		}
+		inString := false
+		for _, t := range tokens {
+			if t.Type == "String" && t.Pos.Offset < start && start < t.Pos.Offset+len(t.Value) {
+				inString = true
+				break
+			}
+		}
+		if !inString {
+			f.comments = append(f.comments, sourceLine{line: i + 1, text: strings.TrimRight(text, " \t\r"), spaced: f.spaced(i + 1)})
+		}
+	}
+	return nil
+}
+
+// spaced returns true if the line is preceded by an empty line
+func (f *formatter) spaced(line int) bool {
+	return line > 1 && line-2 < len(f.lines) && strings.TrimSpace(f.lines[line-2]) == ""
+}
+
+// separate starts a new top level line, keeping one empty line where the source had some
+func (f *formatter) separate(spaced bool) {
+	if f.buf.Len() == 0 {
+		return
+	}
+	f.buf.WriteString("\n")
+	if spaced {
+		f.buf.WriteString("\n")
+	}
+}
+
+// flushComments writes the comments found before the line. The comments can only start at the beginning of a line,
+// so the ones inside a rule are not indented.
+func (f *formatter) flushComments(line int, topLevel bool) {
+	for len(f.comments) > 0 && f.comments[0].line < line {
+		c := f.comments[0]
+		f.comments = f.comments[1:]
+		if topLevel {
+			f.separate(c.spaced)
+		} else {
+			f.buf.WriteString("\n")
+		}
+		f.buf.WriteString(c.text)
+	}
+}
+
+func (f *formatter) rule(rule *RuleNode) {
+	f.buf.WriteString(rule.Identifier)
+	if rule.Formals != nil {
+		params := make([]string, 0, len(rule.Formals.Params))
+		for _, par := range rule.Formals.Params {
+			if par.Default != nil {
+				params = append(params, fmt.Sprintf("%s=%s", par.Name, formatValue(par.Default)))
+			} else {
+				params = append(params, par.Name)
+			}
+		}
+		fmt.Fprintf(&f.buf, "(%s)", strings.Join(params, ", "))
+	}
+	f.buf.WriteString(" => ")
+	if rule.Feeder != nil {
+		fmt.Fprintf(&f.buf, "<%s", rule.Feeder.Name)
+		if len(rule.Feeder.Params) > 0 {
+			fmt.Fprintf(&f.buf, ": %s", formatParams(rule.Feeder.Params))
+		}
+		f.buf.WriteString(">")
+		if rule.Feeder.Next != nil {
+			f.next(rule.Feeder.Next, formatIndent)
+		}
+	} else {
+		// the first node is aligned as the ones after it
+		f.pipeline(rule.First, formatIndent+formatIndent, formatIndent)
+	}
+	f.buf.WriteString(";")
+}
+
+// pipeline writes the nodes of a pipeline: the first one starts at the column, the ones after it are on their own line
+// starting with a '|' with the given indentation
+func (f *formatter) pipeline(n *Node, column string, indent string) {
+	f.node(n, column)
+	if next := nextNode(n); next != nil {
+		f.next(next, indent)
+	}
+}
+
+func (f *formatter) next(n *Node, indent string) {
+	f.flushComments(nodePos(n).Line, false)
+	fmt.Fprintf(&f.buf, "\n%s| ", indent)
+	f.pipeline(n, indent+formatIndent, indent)
+}
+
+// node writes a single node starting at the column, the content of branches and conditions is indented
+// and the closing brace is aligned with the node
+func (f *formatter) node(n *Node, column string) {
+	switch {
+	case n.Filter != nil:
+		f.filter(n.Filter.Neg, n.Filter.Name, n.Filter.Params)
+	case n.RuleCall != nil:
+		fmt.Fprintf(&f.buf, "@%s", n.RuleCall.Name)
+		if len(n.RuleCall.Args) > 0 {
+			fmt.Fprintf(&f.buf, "(%s)", formatParams(n.RuleCall.Args))
+		}
+	case n.Branch != nil:
+		f.buf.WriteString("{")
+		f.block(n.Branch.Pipelines, column)
+		f.buf.WriteString("}")
+	case n.Condition != nil:
+		for i, c := range n.Condition.Cases {
+			if i > 0 {
+				f.buf.WriteString(" else ")
+			}
+			f.buf.WriteString("if ")
+			f.filter(c.Predicate.Neg, c.Predicate.Name, c.Predicate.Params)
+			f.buf.WriteString(" {")
+			f.block(c.Pipelines, column)
+			f.buf.WriteString("}")
+		}
+		if n.Condition.Else != nil {
+			f.buf.WriteString(" else {")
+			f.block(n.Condition.Else, column)
+			f.buf.WriteString("}")
+		}
+	}
+}
+
+// block writes the pipelines between the braces, one for each line, and the indentation of the closing brace
+func (f *formatter) block(pipelines []*Node, column string) {
+	inner := column + formatIndent
+	for i, p := range pipelines {
+		f.flushComments(nodePos(p).Line, false)
+		fmt.Fprintf(&f.buf, "\n%s", inner)
+		f.pipeline(p, inner, inner+formatIndent)
+		if i < len(pipelines)-1 {
+			f.buf.WriteString(";")
+		}
+	}
+	fmt.Fprintf(&f.buf, "\n%s", column)
+}
+
+func (f *formatter) filter(neg bool, name string, params []*Param) {
+	if neg {
+		f.buf.WriteString("!")
+	}
+	fmt.Fprintf(&f.buf, "%s(%s)", name, formatParams(params))
+}
+
+// nextNode returns the node following n in its pipeline
+func nextNode(n *Node) *Node {
+	switch {
+	case n.Filter != nil:
+		return n.Filter.Next
+	case n.RuleCall != nil:
+		return n.RuleCall.Next
+	case n.Branch != nil:
+		return n.Branch.Next
+	case n.Condition != nil:
+		return n.Condition.Next
+	}
+	return nil
+}
+
+// nodePos returns the position of the node, branches and conditions start with the first node they contain
+func nodePos(n *Node) lexer.Position {
+	switch {
+	case n.Filter != nil:
+		return n.Filter.Pos
+	case n.RuleCall != nil:
+		return n.RuleCall.Pos
+	case n.Branch != nil && len(n.Branch.Pipelines) > 0:
+		return nodePos(n.Branch.Pipelines[0])
+	case n.Condition != nil && len(n.Condition.Cases) > 0:
+		return n.Condition.Cases[0].Predicate.Pos
+	}
+	return lexer.Position{}
+}
+
+func formatParams(params []*Param) string {
+	list := make([]string, 0, len(params))
+	for _, par := range params {
+		list = append(list, fmt.Sprintf("%s=%s", par.Name, formatValue(par.Value)))
+	}
+	return strings.Join(list, ", ")
+}
+
+// formatValue writes a value as it would be written in a rule, the variables are written with their name
+func formatValue(v *Value) string {
+	switch {
+	case v == nil:
+		return ""
+	case v.Var != nil:
+		return "$" + *v.Var
+	case v.String != nil:
+		return strconv.Quote(*v.String)
+	case v.Duration != nil:
+		return *v.Duration
+	case v.Number != nil:
+		return strconv.FormatFloat(*v.Number, 'f', -1, 64)
+	case v.Bool != nil:
+		return *v.Bool
+	case v.Rule != nil:
+		return "@" + *v.Rule
+	case v.List != nil:
+		items := make([]string, 0, len(v.List.Values))
+		for _, item := range v.List.Values {
+			items = append(items, formatValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case v.Map != nil:
+		entries := make([]string, 0, len(v.Map.Entries))
+		for _, e := range v.Map.Entries {
+			key := e.Key
+			if !identRegexp.MatchString(key) {
+				key = strconv.Quote(key)
+			}
+			entries = append(entries, fmt.Sprintf("%s: %s", key, formatValue(e.Value)))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParser_Format(t *testing.T) {
+	type Test struct {
+		Name          string
+		Input         string
+		Expected      string
+		ExpectedError string
+	}
+
+	tests := []Test{
+		{"Empty", "", "", ""},
+		{"OnlyComments", "# a\n\n\n# b   \n", "# a\n\n# b\n", ""},
+		{"Feeder", "r=><timer:freq=1m,  a='x'>;", "r => <timer: freq=1m, a=\"x\">;\n", ""},
+		{"FeederWithoutParams", "r => <timer>|echo();", "r => <timer>\n  | echo();\n", ""},
+		{
+			"Pipeline",
+			"r => <rss: url=\"http://x\"> | text(pattern='go', target=\"main\") | !echo() | @notify(chat=\"dev\", n=1.5) | @other;",
+			"r => <rss: url=\"http://x\">\n  | text(pattern=\"go\", target=\"main\")\n  | !echo()\n  | @notify(chat=\"dev\", n=1.5)\n  | @other;\n",
+			"",
+		},
+		{"CallWithoutArgs", "r => @x() | @y;", "r => @x\n  | @y;\n", ""},
+		{
+			"Values",
+			"r => f(a=[1, \"b\",true], m={k: 'v', \"a b\": $X, Content-type: [] }, d=1h30m, on_error=@e, s=\"a\\\"b\\nc\", e={});",
+			"r => f(a=[1, \"b\", true], m={k: \"v\", \"a b\": $X, Content-type: []}, d=1h30m, on_error=@e, s=\"a\\\"b\\nc\", e={});\n",
+			"",
+		},
+		{"Template", "t(a,b=\"x\")=>echo(to=$a);\nu()=>echo();", "t(a, b=\"x\") => echo(to=$a);\nu() => echo();\n", ""},
+		{
+			"Branch",
+			"r => echo() | { text(regexp=\"foo\") | a() ; @b } | echo();",
+			"r => echo()\n  | {\n      text(regexp=\"foo\")\n        | a();\n      @b\n    }\n  | echo();\n",
+			"",
+		},
+		{
+			"Condition",
+			"r => if number(op=\">\", value=\"5\") { @A } else if !text(p=\"a\") { @B ; x() | y() } else { @C } | echo();",
+			"r => if number(op=\">\", value=\"5\") {\n      @A\n    } else if !text(p=\"a\") {\n      @B;\n      x()\n        | y()\n    } else {\n      @C\n    }\n  | echo();\n",
+			"",
+		},
+		{
+			"Nested",
+			"r => { if a() { { b(); c() } } };",
+			"r => {\n      if a() {\n        {\n          b();\n          c()\n        }\n      }\n    };\n",
+			"",
+		},
+		{
+			"Comments",
+			"#import \"lib.rule\"\n#define X  \"a\"   \n\n\n# first rule\nr => <timer: freq=1m>\n# the filter\n| echo();\n\n# second\n\n\nx => echo();\n# end\n",
+			"#import \"lib.rule\"\n#define X  \"a\"\n\n# first rule\nr => <timer: freq=1m>\n# the filter\n  | echo();\n\n# second\n\nx => echo();\n# end\n",
+			"",
+		},
+		{"CommentInBranch", "r => {\n# one\na(); b() };", "r => {\n# one\n      a();\n      b()\n    };\n", ""},
+		{"MultilineString", "r => echo(a=\"x\n#not a comment\");", "r => echo(a=\"x\\n#not a comment\");\n", ""},
+		{"Blanks", "\n\na => b();\n\n\n\nc => d();\n\n", "a => b();\n\nc => d();\n", ""},
+		{"Invalid", "r => echo(", "", "1:11: unexpected token \"<EOF>\""},
+	}
+
+	parser, err := NewParser()
+	if err != nil {
+		t.Fatalf("wrong error: expected=%#v had=%#v", nil, err)
+	}
+	for _, v := range tests {
+		had, err := parser.Format("test.rule", []byte(v.Input))
+		if (err == nil && v.ExpectedError != "") || (err != nil && !strings.Contains(err.Error(), v.ExpectedError)) || (err != nil && v.ExpectedError == "") {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if string(had) != v.Expected {
+			t.Errorf("%s: wrong output: expected=%#v had=%#v", v.Name, v.Expected, string(had))
+		}
+
+		// the output doesn't change if formatted again and it contains the same rules
+		again, err := parser.Format("test.rule", had)
+		if err != nil {
+			t.Errorf("%s: wrong error formatting again: expected=%#v had=%#v", v.Name, nil, err)
+			continue
+		}
+		if !bytes.Equal(again, had) {
+			t.Errorf("%s: wrong output formatting again: expected=%#v had=%#v", v.Name, string(had), string(again))
+		}
+		before, after := &AST{}, &AST{}
+		if err := parser.handle.ParseString(v.Input, before); err != nil {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, nil, err)
+		}
+		if err := parser.handle.ParseString(string(had), after); err != nil {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, nil, err)
+		}
+		if !sameNodes(before, after) {
+			t.Errorf("%s: the formatted rules are different from the original ones", v.Name)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Matrix86/driplane/feeders"
+	"github.com/Matrix86/driplane/filters"
+)
+
+// maximum length of a parameter value shown in the graph
+const graphValueLength = 32
+
+// GraphNode is a feeder or a filter of a compiled rule
+type GraphNode struct {
+	ID     string
+	Rule   string
+	Label  string
+	Feeder bool
+}
+
+// GraphEdge connects the node publishing the messages on a topic to a node subscribed to it
+type GraphEdge struct {
+	From  string
+	To    string
+	Label string
+}
+
+// Graph describes how the compiled rules are connected through the bus
+type Graph struct {
+	Rules map[string][]*GraphNode
+	Edges []*GraphEdge
+}
+
+func paramLabel(par *Param) string {
+	value := ""
+	switch {
+	case par.Value.Var != nil:
+		value = "$" + *par.Value.Var
+	case par.Value.String != nil:
+		value = strconv.Quote(truncate(*par.Value.String))
+	case par.Value.Rule != nil:
+		value = "@" + *par.Value.Rule
+	default:
+		v, err := paramValue(par)
+		if err != nil {
+			v = err.Error()
+		}
+		value = truncate(v)
+	}
+	return par.Name + "=" + value
+}
+
+func truncate(s string) string {
+	if len(s) > graphValueLength {
+		return s[:graphValueLength] + "..."
+	}
+	return s
+}
+
+func paramsLabel(params []*Param) string {
+	list := make([]string, 0, len(params))
+	for _, par := range params {
+		list = append(list, paramLabel(par))
+	}
+	return strings.Join(list, ", ")
+}
+
+// nodeLabel returns the filter as it is written in the rule
+func nodeLabel(neg bool, name string, params []*Param) string {
+	label := fmt.Sprintf("%s(%s)", name, paramsLabel(params))
+	if neg {
+		label = "!" + label
+	}
+	return label
+}
+
+// feederLabel returns the feeder as it is written in the rule
+func feederLabel(name string, params []*Param) string {
+	if len(params) == 0 {
+		return "<" + name + ">"
+	}
+	return fmt.Sprintf("<%s: %s>", name, paramsLabel(params))
+}
+
+// Graph returns the nodes of the compiled rules and the bus subscriptions connecting them
+func (r *Ruleset) Graph() *Graph {
+	g := &Graph{
+		Rules: make(map[string][]*GraphNode),
+		Edges: make([]*GraphEdge, 0),
+	}
+
+	known := make(map[string]bool)
+	for id, rule := range r.rules {
+		for _, n := range rule.nodes {
+			node := &GraphNode{Rule: id}
+			switch v := n.(type) {
+			case feeders.Feeder:
+				node.ID = v.GetIdentifier()
+				node.Feeder = true
+			case filters.Filter:
+				node.ID = v.GetIdentifier()
+			default:
+				continue
+			}
+			node.Label = rule.labels[node.ID]
+			if node.Label == "" {
+				node.Label = node.ID
+			}
+			known[node.ID] = true
+			g.Rules[id] = append(g.Rules[id], node)
+		}
+	}
+
+	for topic, subscribers := range r.bus.subscribers() {
+		// the topics are the identifiers of the nodes, or their else/error routes
+		from, label := topic, ""
+		for _, suffix := range []string{"else", "error"} {
+			if strings.HasSuffix(topic, ":"+suffix) {
+				from, label = strings.TrimSuffix(topic, ":"+suffix), suffix
+			}
+		}
+		if !known[from] {
+			continue
+		}
+		for _, to := range subscribers {
+			if known[to] {
+				g.Edges = append(g.Edges, &GraphEdge{From: from, To: to, Label: label})
+			}
+		}
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Label < b.Label
+	})
+	return g
+}
+
+func (g *Graph) sortedRules() []string {
+	rules := make([]string, 0, len(g.Rules))
+	for id := range g.Rules {
+		rules = append(rules, id)
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+func ruleTitle(id string) string {
+	return "@" + id[strings.LastIndex(id, ":")+1:]
+}
+
+// DOT returns the graph in the Graphviz format
+func (g *Graph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph driplane {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	for i, id := range g.sortedRules() {
+		fmt.Fprintf(&sb, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&sb, "    label=%s;\n", strconv.Quote(ruleTitle(id)))
+		fmt.Fprintf(&sb, "    tooltip=%s;\n", strconv.Quote(id))
+		for _, n := range g.Rules[id] {
+			shape := ""
+			if n.Feeder {
+				shape = ", shape=ellipse"
+			}
+			fmt.Fprintf(&sb, "    %s [label=%s%s];\n", strconv.Quote(n.ID), strconv.Quote(n.Label), shape)
+		}
+		sb.WriteString("  }\n")
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		if e.Label != "" {
+			attrs = fmt.Sprintf(" [label=%s, style=dashed]", strconv.Quote(e.Label))
+		}
+		fmt.Fprintf(&sb, "  %s -> %s%s;\n", strconv.Quote(e.From), strconv.Quote(e.To), attrs)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+var mermaidIDRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func mermaidID(id string) string {
+	return mermaidIDRegexp.ReplaceAllString(id, "_")
+}
+
+func mermaidText(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "#quot;") + "\""
+}
+
+// Mermaid returns the graph in the Mermaid flowchart format
+func (g *Graph) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	for i, id := range g.sortedRules() {
+		fmt.Fprintf(&sb, "  subgraph rule_%d[%s]\n", i, mermaidText(ruleTitle(id)))
+		for _, n := range g.Rules[id] {
+			if n.Feeder {
+				fmt.Fprintf(&sb, "    %s([%s])\n", mermaidID(n.ID), mermaidText(n.Label))
+			} else {
+				fmt.Fprintf(&sb, "    %s[%s]\n", mermaidID(n.ID), mermaidText(n.Label))
+			}
+		}
+		sb.WriteString("  end\n")
+	}
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			fmt.Fprintf(&sb, "  %s -.->|%s| %s\n", mermaidID(e.From), e.Label, mermaidID(e.To))
+		} else {
+			fmt.Fprintf(&sb, "  %s --> %s\n", mermaidID(e.From), mermaidID(e.To))
+		}
+	}
+	return sb.String()
+}
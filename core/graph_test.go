@@ -0,0 +1,83 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleset_Graph(t *testing.T) {
+	file := writeTestRuleFile(t, `graph_failed => echo();
+graph_rule => !text(target="title", pattern="spam") | if text(pattern="urgent") { http(url="http://127.0.0.1:1/x", on_error=@graph_failed) } else { echo() };`)
+	parser, _ := NewParser()
+	ast, err := parser.ParseFile(file)
+	if err != nil {
+		t.Fatalf("ParseFile returned '%s'", err)
+	}
+	rs := RuleSetInstance()
+	if _, err := rs.CompileAst(file, ast, NewConfiguration()); err != nil {
+		t.Fatalf("CompileAst returned '%s'", err)
+	}
+
+	g := rs.Graph()
+	// the called rule is part of the caller
+	nodes := g.Rules[file+":graph_rule"]
+	if len(nodes) != 5 {
+		t.Fatalf("wrong number of nodes: expected=5 had=%d", len(nodes))
+	}
+	labels := make(map[string]string)
+	for _, n := range nodes {
+		labels[n.ID] = n.Label
+	}
+	if failed := g.Rules[file+":graph_failed"]; len(failed) != 1 {
+		t.Fatalf("wrong number of nodes: expected=1 had=%d", len(failed))
+	}
+
+	expected := map[string]bool{
+		`!text(target="title", pattern="spam") -> if text(pattern="urgent") `:                    true,
+		`if text(pattern="urgent") -> http(url="http://127.0.0.1:1/x", on_error=@graph_failed) `: true,
+		`if text(pattern="urgent") -> echo() else`:                                               true,
+		`http(url="http://127.0.0.1:1/x", on_error=@graph_failed) -> echo() error`:               true,
+	}
+	had := make(map[string]bool)
+	for _, e := range g.Edges {
+		from, ok1 := labels[e.From]
+		to, ok2 := labels[e.To]
+		if ok1 && ok2 {
+			had[from+" -> "+to+" "+e.Label] = true
+		}
+	}
+	for e := range expected {
+		if !had[e] {
+			t.Errorf("edge not found: %s (had=%v)", e, had)
+		}
+	}
+	if len(had) != len(expected) {
+		t.Errorf("wrong number of edges: expected=%d had=%d", len(expected), len(had))
+	}
+
+	dot := g.DOT()
+	if !strings.HasPrefix(dot, "digraph driplane {") || !strings.Contains(dot, `label="@graph_rule"`) || !strings.Contains(dot, `[label="else", style=dashed]`) {
+		t.Errorf("wrong DOT output:\n%s", dot)
+	}
+	mermaid := g.Mermaid()
+	if !strings.HasPrefix(mermaid, "flowchart LR") || !strings.Contains(mermaid, `["@graph_rule"]`) || !strings.Contains(mermaid, "-.->|error|") {
+		t.Errorf("wrong Mermaid output:\n%s", mermaid)
+	}
+}
+
+func TestGraphLabels(t *testing.T) {
+	long := strings.Repeat("a", 40)
+	num := 5.0
+	rule := "other"
+	params := []*Param{
+		{Name: "s", Value: &Value{String: &long}},
+		{Name: "n", Value: &Value{Number: &num}},
+		{Name: "r", Value: &Value{Rule: &rule}},
+	}
+	if l := nodeLabel(true, "text", params); l != `!text(s="`+strings.Repeat("a", 32)+`...", n=5, r=@other)` {
+		t.Errorf("wrong label: %s", l)
+	}
+	if l := feederLabel("slack", nil); l != "<slack>" {
+		t.Errorf("wrong label: %s", l)
+	}
+}
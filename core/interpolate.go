@@ -0,0 +1,72 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	interpolationRegexp = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+	envNameRegexp       = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Interpolate replaces in s the references to environment variables and files:
+//
+//	${NAME}             value of the environment variable NAME
+//	${NAME:-default}    value of NAME, or default if it is not set or empty
+//	${file:/path}       content of the file (without the trailing newline)
+//	${file:/path:-def}  content of the file, or def if it cannot be read
+//	$${                 a literal ${
+func Interpolate(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var err error
+	result := interpolationRegexp.ReplaceAllStringFunc(s, func(match string) string {
+		if err != nil {
+			return match
+		}
+		if match == "$${" {
+			return "${"
+		}
+
+		ref := match[2 : len(match)-1]
+		def, hasDefault := "", false
+		if i := strings.Index(ref, ":-"); i != -1 {
+			ref, def, hasDefault = ref[:i], ref[i+2:], true
+		}
+
+		if strings.HasPrefix(ref, "file:") {
+			content, e := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+			if e != nil {
+				if hasDefault {
+					return def
+				}
+				err = fmt.Errorf("interpolation of '%s': %s", match, e)
+				return match
+			}
+			return strings.TrimRight(string(content), "\r\n")
+		}
+
+		if !envNameRegexp.MatchString(ref) {
+			err = fmt.Errorf("interpolation of '%s': invalid variable name", match)
+			return match
+		}
+		v, ok := os.LookupEnv(ref)
+		if hasDefault && v == "" {
+			return def
+		}
+		if ok {
+			return v
+		}
+		err = fmt.Errorf("interpolation of '%s': environment variable '%s' is not set", match, ref)
+		return match
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	secret := path.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DRIPLANE_TEST_VAR", "value")
+	t.Setenv("DRIPLANE_TEST_EMPTY", "")
+
+	type Test struct {
+		Name          string
+		Input         string
+		Expected      string
+		ExpectedError bool
+	}
+	tests := []Test{
+		{"NoReference", "plain {{ .main }} $HOME", "plain {{ .main }} $HOME", false},
+		{"Env", "a-${DRIPLANE_TEST_VAR}-b", "a-value-b", false},
+		{"EmptyEnv", "${DRIPLANE_TEST_EMPTY}", "", false},
+		{"EmptyEnvDefault", "${DRIPLANE_TEST_EMPTY:-default}", "default", false},
+		{"Default", "${DRIPLANE_TEST_UNSET:-default}", "default", false},
+		{"EmptyDefault", "${DRIPLANE_TEST_UNSET:-}", "", false},
+		{"Unset", "${DRIPLANE_TEST_UNSET}", "", true},
+		{"InvalidName", "${NOT VALID}", "", true},
+		{"File", "token ${file:" + secret + "}", "token s3cr3t", false},
+		{"MissingFile", "${file:/not/existing/file}", "", true},
+		{"MissingFileDefault", "${file:/not/existing/file:-none}", "none", false},
+		{"Escape", "$${DRIPLANE_TEST_VAR} ${DRIPLANE_TEST_VAR}", "${DRIPLANE_TEST_VAR} value", false},
+		{"Multiple", "${DRIPLANE_TEST_VAR}${DRIPLANE_TEST_VAR}", "valuevalue", false},
+	}
+
+	for _, v := range tests {
+		had, err := Interpolate(v.Input)
+		if v.ExpectedError != (err != nil) {
+			t.Errorf("%s: wrong error: %v", v.Name, err)
+			continue
+		}
+		if had != v.Expected {
+			t.Errorf("%s: wrong result: expected=%#v had=%#v", v.Name, v.Expected, had)
+		}
+	}
+}
+
+func TestParamValueInterpolation(t *testing.T) {
+	t.Setenv("DRIPLANE_TEST_KEY", "key")
+	s := "Bearer ${DRIPLANE_TEST_KEY}"
+	par := &Param{Name: "headers", Value: &Value{Map: &Map{Entries: []*MapEntry{{Key: "Authorization", Value: &Value{String: &s}}}}}}
+	v, err := paramValue(par)
+	if err != nil {
+		t.Fatalf("paramValue returned '%s'", err)
+	}
+	if expected := `{"Authorization":"Bearer key"}`; v != expected {
+		t.Errorf("wrong value: expected=%#v had=%#v", expected, v)
+	}
+
+	unset := "${DRIPLANE_TEST_UNSET}"
+	if _, err := paramValue(&Param{Name: "p", Value: &Value{String: &unset}}); err == nil {
+		t.Errorf("an unset variable should return an error")
+	}
+}
+
+func TestParamValueEscapedInterpolation(t *testing.T) {
+	parser, _ := NewParser()
+	ast := &AST{}
+	rule := `r => system(cmd="echo $${HOME} $HOME", template="{{ .main }} $$${x}");`
+	if err := parser.handle.ParseString(rule, ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+
+	expected := []string{"echo ${HOME} $HOME", "{{ .main }} $${x}"}
+	for i, par := range ast.Rules[0].First.Filter.Params {
+		v, err := paramValue(par)
+		if err != nil {
+			t.Errorf("%s: paramValue returned '%s'", par.Name, err)
+			continue
+		}
+		if v != expected[i] {
+			t.Errorf("%s: wrong value: expected=%#v had=%#v", par.Name, expected[i], v)
+		}
+	}
+}
@@ -0,0 +1,696 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/feeders"
+	"github.com/Matrix86/driplane/filters"
+	"github.com/Matrix86/driplane/schema"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/evilsocket/islazy/fs"
+)
+
+// Severities of the diagnostics
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// fields set on all the Messages by the feeders and the filters
+var baseFields = []string{"main", "rule_name", "source_feeder", "source_feeder_rule", data.MetaField}
+
+// Diagnostic is a problem found in the rule files
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	// Check identifies the check that found the problem
+	Check   string `json:"check"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// String returns the diagnostic in the form "file:line:column: severity: message (check)"
+func (d Diagnostic) String() string {
+	pos := d.File
+	if d.Line > 0 {
+		pos = fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", pos, d.Severity, d.Message, d.Check)
+}
+
+// lintRule is a rule or a template with the file defining it
+type lintRule struct {
+	id   string
+	file string
+	node *RuleNode
+}
+
+// fieldSet contains the extra fields that can be found in the Messages in a point of a rule
+type fieldSet struct {
+	names map[string]bool
+	// the fields are not known: a feeder or a filter sets fields not known in advance
+	dynamic bool
+}
+
+func newFieldSet(names ...string) fieldSet {
+	s := fieldSet{names: make(map[string]bool)}
+	for _, n := range names {
+		s.names[n] = true
+	}
+	return s
+}
+
+// with returns a copy of the set containing also the names
+func (s fieldSet) with(names ...string) fieldSet {
+	c := fieldSet{names: make(map[string]bool, len(s.names)+len(names)), dynamic: s.dynamic}
+	for n := range s.names {
+		c.names[n] = true
+	}
+	for _, n := range names {
+		c.names[n] = true
+	}
+	return c
+}
+
+// union returns the fields found in at least one of the sets
+func (s fieldSet) union(o fieldSet) fieldSet {
+	c := s.with()
+	c.dynamic = c.dynamic || o.dynamic
+	for n := range o.names {
+		c.names[n] = true
+	}
+	return c
+}
+
+// Linter runs semantic checks on the parsed rule files
+type Linter struct {
+	config *Configuration
+	// rules and templates of the files and of their imports, identified by "file:name"
+	rules map[string]*lintRule
+	deps  map[string][]string
+	used  map[string]bool
+
+	diagnostics []Diagnostic
+	reported    map[string]bool
+}
+
+// NewLinter creates a Linter for the ASTs of the rule files
+func NewLinter(config *Configuration, asts map[string]*AST) *Linter {
+	l := &Linter{
+		config:   config,
+		rules:    make(map[string]*lintRule),
+		deps:     make(map[string][]string),
+		used:     make(map[string]bool),
+		reported: make(map[string]bool),
+	}
+	defs := make(map[string]*RuleNode)
+	for file, ast := range asts {
+		collectRules(file, ast, defs, l.deps)
+	}
+	for id, node := range defs {
+		l.rules[id] = &lintRule{id: id, file: strings.TrimSuffix(id, ":"+node.Identifier), node: node}
+	}
+	return l
+}
+
+// Run executes all the checks and returns the problems found, sorted by position
+func (l *Linter) Run() []Diagnostic {
+	ids := make([]string, 0, len(l.rules))
+	for id := range l.rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		r := l.rules[id]
+		if r.node.Feeder != nil {
+			l.checkFeeder(r, r.node.Feeder)
+			l.checkNodes(r, r.node.Feeder.Next, true)
+		}
+		l.checkNodes(r, r.node.First, false)
+	}
+
+	// the fields are followed from the feeders, through the called rules
+	for _, id := range ids {
+		r := l.rules[id]
+		if r.node.Formals != nil {
+			continue
+		}
+		if r.node.Feeder != nil {
+			l.feederFields(r, nil)
+		} else {
+			l.flow(r, r.node.First, fieldSet{dynamic: true}, []string{r.id})
+		}
+	}
+
+	for _, id := range ids {
+		r := l.rules[id]
+		if r.node.Feeder == nil && !l.used[id] && !l.startsWithFeeder(r, nil) {
+			l.report(r, r.node.Pos, SeverityWarning, "unused-rule", "rule '%s' has no feeder and it is never called", r.node.Identifier)
+		}
+	}
+
+	sortDiagnostics(l.diagnostics)
+	return l.diagnostics
+}
+
+func (l *Linter) report(r *lintRule, pos lexer.Position, severity string, check string, format string, args ...interface{}) {
+	d := Diagnostic{
+		File:     pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Severity: severity,
+		Check:    check,
+		Rule:     r.node.Identifier,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if d.File == "" {
+		d.File = r.file
+	}
+	// the rules called from several places are checked more times
+	key := d.String()
+	if l.reported[key] {
+		return
+	}
+	l.reported[key] = true
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// resolve returns the rule or the template called with name from the rule r, nil if it doesn't exist
+func (l *Linter) resolve(r *lintRule, name string) *lintRule {
+	id := lookupRule(r.file, l.deps[r.file], name, func(n string) bool {
+		_, ok := l.rules[n]
+		return ok
+	})
+	if id == "" {
+		return nil
+	}
+	return l.rules[id]
+}
+
+// use resolves a rule called from r and marks it as used
+func (l *Linter) use(r *lintRule, name string) *lintRule {
+	callee := l.resolve(r, name)
+	if callee != nil && callee.id != r.id {
+		l.used[callee.id] = true
+	}
+	return callee
+}
+
+// checkNodes runs the checks on the nodes of a rule, input is true if the nodes receive messages from the previous ones
+func (l *Linter) checkNodes(r *lintRule, n *Node, input bool) {
+	if n == nil {
+		return
+	}
+	switch {
+	case n.Filter != nil:
+		fn := n.Filter
+		l.checkFilter(r, fn.Pos, fn.Name, fn.Params)
+		if fn.Next != nil && l.dropsAll(fn.Neg, fn.Name) {
+			l.report(r, fn.Pos, SeverityWarning, "unreachable", "'!%s' never propagates the messages: the nodes after it are never reached", fn.Name)
+		}
+		l.checkNodes(r, fn.Next, true)
+	case n.RuleCall != nil:
+		for _, name := range paramCalls(n.RuleCall.Args) {
+			l.use(r, name)
+		}
+		if callee := l.use(r, n.RuleCall.Name); callee != nil {
+			l.checkArgs(r, n.RuleCall, callee)
+			l.checkCall(r, n.RuleCall.Pos, callee, input)
+		} else {
+			l.report(r, n.RuleCall.Pos, SeverityError, "unknown-name", "%s", unknownName("rule", n.RuleCall.Name, l.visible(r)))
+		}
+		l.checkNodes(r, n.RuleCall.Next, true)
+	case n.Branch != nil:
+		for _, pipeline := range n.Branch.Pipelines {
+			l.checkNodes(r, pipeline, input)
+		}
+		l.checkNodes(r, n.Branch.Next, true)
+	case n.Condition != nil:
+		cases := n.Condition.Cases
+		for i, c := range cases {
+			p := c.Predicate
+			l.checkFilter(r, p.Pos, p.Name, p.Params)
+			if l.dropsAll(p.Neg, p.Name) {
+				l.report(r, p.Pos, SeverityWarning, "unreachable", "'!%s' never matches: its pipelines are never reached", p.Name)
+			} else if !p.Neg && l.passThrough(p.Name) && (i < len(cases)-1 || len(n.Condition.Else) > 0) {
+				l.report(r, p.Pos, SeverityWarning, "unreachable", "'%s' always matches: the cases after it are never reached", p.Name)
+			}
+			for _, pipeline := range c.Pipelines {
+				l.checkNodes(r, pipeline, true)
+			}
+		}
+		for _, pipeline := range n.Condition.Else {
+			l.checkNodes(r, pipeline, true)
+		}
+		l.checkNodes(r, n.Condition.Next, true)
+	}
+}
+
+// checkFeeder checks the name of the feeder and its parameters against its schema
+func (l *Linter) checkFeeder(r *lintRule, fn *FeederNode) {
+	s, ok := feeders.Describe(fn.Name)
+	if !ok {
+		l.report(r, fn.Pos, SeverityError, "unknown-name", "%s", unknownName("feeder", fn.Name, feeders.Names()))
+		return
+	}
+	l.checkParams(r, fn.Pos, "feeder", fn.Name, s, fn.Params)
+}
+
+// checkParams reports the parameters not declared in the schema, the ones with a wrong value and the missing required ones
+func (l *Linter) checkParams(r *lintRule, pos lexer.Position, kind string, name string, s schema.Schema, params []*Param) {
+	// the parameters can be set also in the configuration
+	found := make(map[string]string)
+	prefix := strings.ToLower(name + ".")
+	for k, v := range l.config.GetConfig() {
+		if strings.HasPrefix(k, prefix) {
+			found[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	for _, par := range params {
+		found[par.Name] = ""
+		if par.Name == "on_error" && kind == "filter" {
+			continue
+		}
+		value, err := paramValue(par)
+		if err != nil {
+			// the parameters of a template are known only when it is called
+			if r.node.Formals == nil {
+				l.report(r, par.Pos, SeverityError, "params", "%s", err)
+			}
+			continue
+		}
+		if err := checkParam(s, par.Name, value); err != nil {
+			l.report(r, par.Pos, SeverityError, "params", "%s '%s': %s", kind, name, err)
+		}
+	}
+	if missing := missingParams(s, found, ""); len(missing) > 0 {
+		l.report(r, pos, SeverityError, "params", "%s '%s': missing required parameter %s", kind, name, strings.Join(missing, ", "))
+	}
+}
+
+// checkArgs reports the calls with arguments that don't match the parameters of the called rule
+func (l *Linter) checkArgs(r *lintRule, call *RuleCall, callee *lintRule) {
+	if callee.node.Formals == nil {
+		if call.Args != nil {
+			l.report(r, call.Pos, SeverityError, "params", "rule '%s' has no parameters", call.Name)
+		}
+		return
+	}
+	if _, err := callee.node.instantiate(call.Args); err != nil {
+		l.report(r, call.Pos, SeverityError, "params", "calling rule '%s': %s", call.Name, err)
+	}
+}
+
+// visible returns the names of the rules and of the templates that can be called from the rule
+func (l *Linter) visible(r *lintRule) []string {
+	names := make([]string, 0)
+	for _, rule := range l.rules {
+		if rule.file == r.file || slices.Contains(l.deps[r.file], rule.file) {
+			names = append(names, rule.node.Identifier)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkFilter runs the checks on the name and on the parameters of a filter
+func (l *Linter) checkFilter(r *lintRule, pos lexer.Position, name string, params []*Param) {
+	s, ok := filters.Describe(name)
+	if !ok {
+		l.report(r, pos, SeverityError, "unknown-name", "%s", unknownName("filter", name, filters.Names()))
+	} else {
+		l.checkParams(r, pos, "filter", name, s, params)
+	}
+
+	hasTTL := l.config.Get("cache.ttl") != ""
+	for _, par := range params {
+		switch par.Name {
+		case "ttl":
+			hasTTL = true
+		case "on_error":
+			handler := ""
+			if par.Value.Rule != nil {
+				handler = *par.Value.Rule
+			} else if par.Value.String != nil {
+				handler = strings.TrimPrefix(*par.Value.String, "@")
+			} else if par.Value.Var == nil || r.node.Formals == nil {
+				l.report(r, par.Pos, SeverityError, "params", "on_error requires a rule: on_error=@rule_name")
+				continue
+			}
+			if callee := l.use(r, handler); callee != nil {
+				l.checkCall(r, par.Pos, callee, true)
+			} else if handler != "" {
+				l.report(r, par.Pos, SeverityError, "unknown-name", "%s", unknownName("rule", handler, l.visible(r)))
+			}
+		}
+	}
+	if name == "cache" && !hasTTL {
+		l.report(r, pos, SeverityWarning, "cache-ttl", "cache without 'ttl': the entries are kept for the default 24h")
+	}
+}
+
+// checkCall reports the calls to the rules with a feeder where they would receive messages
+func (l *Linter) checkCall(r *lintRule, pos lexer.Position, callee *lintRule, input bool) {
+	if !input {
+		return
+	}
+	if callee.node.Feeder != nil {
+		l.report(r, pos, SeverityError, "feeder-call", "rule '%s' contains a feeder and cannot receive messages", callee.node.Identifier)
+		return
+	}
+	if first := callee.node.First; first != nil && first.RuleCall != nil {
+		if feeder := l.resolve(callee, first.RuleCall.Name); feeder != nil && feeder.node.Feeder != nil {
+			l.report(r, pos, SeverityError, "feeder-call", "rule '%s' starts with the rule '%s' that contains a feeder and cannot receive messages", callee.node.Identifier, feeder.node.Identifier)
+		}
+	}
+}
+
+// startsWithFeeder returns true if the rule receives the messages of a rule with a feeder called at its beginning
+func (l *Linter) startsWithFeeder(r *lintRule, stack []string) bool {
+	if slices.Contains(stack, r.id) {
+		return false
+	}
+	stack = append(stack, r.id)
+
+	var starts func(n *Node) bool
+	starts = func(n *Node) bool {
+		switch {
+		case n == nil:
+			return false
+		case n.RuleCall != nil:
+			callee := l.resolve(r, n.RuleCall.Name)
+			return callee != nil && (callee.node.Feeder != nil || l.startsWithFeeder(callee, stack))
+		case n.Branch != nil:
+			return slices.ContainsFunc(n.Branch.Pipelines, starts)
+		}
+		return false
+	}
+	return starts(r.node.First)
+}
+
+// dropsAll returns true if the filter never propagates the messages
+func (l *Linter) dropsAll(neg bool, name string) bool {
+	return neg && l.passThrough(name)
+}
+
+func (l *Linter) passThrough(name string) bool {
+	s, ok := filters.Describe(name)
+	return ok && s.PassThrough
+}
+
+// feederFields follows the fields set by the feeder of the rule and returns the ones found at its end
+func (l *Linter) feederFields(r *lintRule, stack []string) fieldSet {
+	if slices.Contains(stack, r.id) {
+		return fieldSet{dynamic: true}
+	}
+	fields := newFieldSet(baseFields...)
+	if s, ok := feeders.Describe(r.node.Feeder.Name); ok {
+		fields = fields.with(s.Fields...)
+		fields.dynamic = s.DynamicFields
+	} else {
+		fields.dynamic = true
+	}
+	return l.flow(r, r.node.Feeder.Next, fields, append(stack, r.id))
+}
+
+// flow follows the fields through the nodes, checking the format filters, and returns the fields found at the end of the nodes
+func (l *Linter) flow(r *lintRule, n *Node, in fieldSet, stack []string) fieldSet {
+	if n == nil {
+		return in
+	}
+	switch {
+	case n.Filter != nil:
+		out := l.filterFields(r, n.Filter.Name, n.Filter.Params, in)
+		if n.Filter.Name == "format" {
+			l.checkFormat(r, n.Filter, in)
+		}
+		return l.flow(r, n.Filter.Next, out, stack)
+	case n.RuleCall != nil:
+		out := fieldSet{dynamic: true}
+		callee := l.resolve(r, n.RuleCall.Name)
+		if callee != nil && callee.node.Feeder != nil {
+			// the messages come from the feeder of the called rule
+			out = l.feederFields(callee, stack)
+		} else if callee != nil && !slices.Contains(stack, callee.id) {
+			node := callee.node
+			if node.Formals != nil {
+				var err error
+				if node, err = node.instantiate(n.RuleCall.Args); err != nil {
+					node = nil
+				}
+			}
+			if node != nil {
+				instance := &lintRule{id: callee.id, file: callee.file, node: node}
+				out = l.flow(instance, node.First, in, append(stack, callee.id))
+			}
+		}
+		return l.flow(r, n.RuleCall.Next, out, stack)
+	case n.Branch != nil:
+		out := fieldSet{names: make(map[string]bool)}
+		for _, pipeline := range n.Branch.Pipelines {
+			out = out.union(l.flow(r, pipeline, in, stack))
+		}
+		return l.flow(r, n.Branch.Next, out, stack)
+	case n.Condition != nil:
+		out := fieldSet{names: make(map[string]bool)}
+		for _, c := range n.Condition.Cases {
+			matched := l.filterFields(r, c.Predicate.Name, c.Predicate.Params, in)
+			for _, pipeline := range c.Pipelines {
+				out = out.union(l.flow(r, pipeline, matched, stack))
+			}
+		}
+		// the else pipelines receive the messages as they were before the predicates
+		for _, pipeline := range n.Condition.Else {
+			out = out.union(l.flow(r, pipeline, in, stack))
+		}
+		if len(n.Condition.Else) == 0 {
+			out = out.union(in)
+		}
+		return l.flow(r, n.Condition.Next, out, stack)
+	}
+	return in
+}
+
+// filterFields returns the fields of the messages propagated by a filter receiving the fields in
+func (l *Linter) filterFields(r *lintRule, name string, params []*Param, in fieldSet) fieldSet {
+	s, ok := filters.Describe(name)
+	if !ok {
+		return fieldSet{dynamic: true}
+	}
+	out := in.with(s.Fields...)
+	out.dynamic = out.dynamic || s.DynamicFields
+	for _, par := range params {
+		if p := s.Get(par.Name); p == nil || !p.Output {
+			continue
+		}
+		value, err := paramValue(par)
+		if err != nil || strings.Contains(value, "{{") {
+			out.dynamic = true
+			continue
+		}
+		// a path sets a value inside the field
+		out.names[data.PathRoot(value)] = true
+	}
+	return out
+}
+
+// checkFormat reports the fields used in the template of a format filter that are not found in the received messages
+func (l *Linter) checkFormat(r *lintRule, fn *FilterNode, in fieldSet) {
+	if in.dynamic {
+		return
+	}
+	for _, par := range fn.Params {
+		var text string
+		switch par.Name {
+		case "template":
+			value, err := paramValue(par)
+			if err != nil {
+				continue
+			}
+			text = value
+		case "file":
+			value, err := paramValue(par)
+			if err != nil {
+				continue
+			}
+			content, err := os.ReadFile(l.templatePath(value))
+			if err != nil {
+				continue
+			}
+			text = string(content)
+		default:
+			continue
+		}
+
+		t, err := template.New("lint").Parse(text)
+		if err != nil || t.Tree == nil {
+			continue
+		}
+		for _, field := range templateFields(t.Tree.Root) {
+			if !in.names[field] {
+				l.report(r, par.Pos, SeverityWarning, "format-fields", "the template uses the field '%s' that is never set by the feeder and the filters before it", field)
+			}
+		}
+	}
+}
+
+// templatePath returns the path of a template file, as it is loaded by the format filter
+func (l *Linter) templatePath(file string) string {
+	if dir := l.config.Get("general.templates_path"); dir != "" {
+		return filepath.Join(dir, file)
+	}
+	return filepath.Join(l.config.Get("general.rules_path"), file)
+}
+
+// templateFields returns the fields of the Message used in a template, ignoring the ones inside range and with
+func templateFields(root parse.Node) []string {
+	fields := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+
+	var walk func(node parse.Node, dot bool)
+	walkBranch := func(b *parse.BranchNode, dot bool, scoped bool) {
+		walk(b.Pipe, dot)
+		// range and with change the meaning of the dot in their body
+		walk(b.List, dot && !scoped)
+		walk(b.ElseList, dot)
+	}
+	walk = func(node parse.Node, dot bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, dot)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, dot)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c, dot)
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a, dot)
+			}
+		case *parse.ChainNode:
+			walk(n.Node, dot)
+		case *parse.FieldNode:
+			if dot {
+				add(n.Ident[0])
+			}
+		case *parse.VariableNode:
+			// $ is always the Message
+			if n.Ident[0] == "$" && len(n.Ident) > 1 {
+				add(n.Ident[1])
+			}
+		case *parse.IfNode:
+			walkBranch(&n.BranchNode, dot, false)
+		case *parse.RangeNode:
+			walkBranch(&n.BranchNode, dot, true)
+		case *parse.WithNode:
+			walkBranch(&n.BranchNode, dot, true)
+		case *parse.TemplateNode:
+			walk(n.Pipe, dot)
+		}
+	}
+	walk(root, true)
+	return fields
+}
+
+// Lint parses and compiles the rule files found in the rules path and runs the semantic checks on them.
+// The parsing and compilation errors are returned as diagnostics too.
+func Lint(config *Configuration) ([]Diagnostic, error) {
+	diagnostics := make([]Diagnostic, 0)
+	asts := make(map[string]*AST)
+	parser, _ := NewParser()
+	err := fs.Glob(config.Get("general.rules_path"), "*.rule", func(file string) error {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("cannot get absolute path of %s: %s", file, err)
+		}
+		ast, err := parser.ParseFile(abs)
+		if err != nil {
+			diagnostics = append(diagnostics, errorDiagnostic(err, abs, "syntax"))
+			return nil
+		}
+		asts[abs] = ast
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(asts))
+	for file := range asts {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	rs := RuleSetInstance()
+	for _, file := range files {
+		if _, err := rs.CompileAst(file, asts[file], config); err != nil {
+			diagnostics = append(diagnostics, errorDiagnostic(err, file, "compile"))
+		}
+	}
+
+	for _, d := range NewLinter(config, asts).Run() {
+		duplicate := false
+		for _, e := range diagnostics {
+			// the compilation already reported the problem in the same position
+			duplicate = duplicate || (e.File == d.File && e.Line == d.Line && e.Column == d.Column && e.Severity == d.Severity)
+		}
+		if !duplicate {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	sortDiagnostics(diagnostics)
+	return diagnostics, nil
+}
+
+// errorDiagnostic converts a parsing or compilation error of file in a Diagnostic
+func errorDiagnostic(err error, file string, check string) Diagnostic {
+	d := Diagnostic{File: file, Severity: SeverityError, Check: check, Message: err.Error()}
+	var rerr *RuleError
+	if errors.As(err, &rerr) && rerr.Pos.Filename != "" {
+		d.File = rerr.Pos.Filename
+		d.Line = rerr.Pos.Line
+		d.Column = rerr.Pos.Column
+		d.Message = rerr.Message
+	}
+	return d
+}
+
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
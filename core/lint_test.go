@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"text/template"
+)
+
+func TestLint(t *testing.T) {
+	type Test struct {
+		Name     string
+		Rules    string
+		Config   map[string]string
+		Expected []string
+	}
+	tests := []Test{
+		{"Clean", "lint_a_feed => <rss: url=\"x\"> | cache(ttl=1h) | format(template=\"{{.title}}: {{.link}}\") | echo();", nil, []string{}},
+		{
+			"UnusedRule",
+			"lint_b_feed => <timer: freq=1m>;\nlint_b_used => echo();\nlint_b_entry => @lint_b_feed | @lint_b_used;\nlint_b_unused => echo();\nlint_b_tpl(x) => echo();",
+			nil,
+			[]string{"4:1 warning unused-rule", "5:1 warning unused-rule"},
+		},
+		{
+			"FeederCall",
+			"lint_c_feed => <timer: freq=1m>;\nlint_c_starts => @lint_c_feed | echo();\nlint_c_tpl(x) => echo() | @lint_c_feed;\nlint_c_entry => @lint_c_feed | @lint_c_tpl(x=1) | { echo() ; @lint_c_starts };",
+			nil,
+			[]string{"3:27 error compile", "4:62 error feeder-call"},
+		},
+		{
+			"OnErrorFeeder",
+			"lint_d_feed => <timer: freq=1m>;\nlint_d_entry => @lint_d_feed | http(url=\"x\", on_error=@lint_d_feed);",
+			nil,
+			[]string{"2:46 error compile"},
+		},
+		{"CacheTTL", "lint_e_feed => <timer: freq=1m> | cache(target=\"rfc3339\") | echo();", nil, []string{"1:35 warning cache-ttl"}},
+		{"CacheTTLConfig", "lint_f_feed => <timer: freq=1m> | cache() | echo();", map[string]string{"cache.ttl": "1h"}, []string{}},
+		{
+			"FormatFields",
+			"lint_g_feed => <timer: freq=1m> | format(template=\"{{.rfc3339}} {{.missing}} {{range .list}}{{.item}}{{end}}\");",
+			nil,
+			[]string{"1:42 warning format-fields"},
+		},
+		{
+			"FormatFieldsUpstream",
+			"lint_h_feed => <timer: freq=1m> | override(name=\"set\", value=\"1\") | text(pattern=\"a\") | { format(template=\"{{.set}} {{.fulltext}}\") ; format(template=\"{{$.other}}\") };",
+			nil,
+			[]string{"1:142 warning format-fields"},
+		},
+		{
+			"FormatFieldsPath",
+			"lint_p_feed => <timer: freq=1m> | override(name=\"payload.user.id\", value=\"1\") | format(template=\"{{.payload.user.id}} {{.user.id}}\");",
+			nil,
+			[]string{"1:88 warning format-fields"},
+		},
+		{
+			"FormatFieldsMeta",
+			"lint_m_feed => <timer: freq=1m> | format(template=\"{{._meta.id}} {{index ._meta.hops 0}}\");",
+			nil,
+			[]string{},
+		},
+		{
+			"FormatFieldsCalls",
+			"lint_i_feed => <timer: freq=1m>;\nlint_i_fmt(f) => format(template=$f);\nlint_i_entry => @lint_i_feed | @lint_i_fmt(f=\"{{.timestamp}}\") | @lint_i_fmt(f=\"{{.nope}}\");",
+			nil,
+			[]string{"2:25 warning format-fields"},
+		},
+		{
+			"Unreachable",
+			"lint_k_feed => <timer: freq=1m> | !echo() | echo();\nlint_k_cond => @lint_k_feed | if !format(template=\"a\") { echo() } else if echo() { echo() } else { echo() };",
+			nil,
+			[]string{"1:35 warning unreachable", "2:34 warning unreachable", "2:75 warning unreachable"},
+		},
+		{
+			"UnknownNames",
+			"lint_m_feed => <timr: freq=1m>;\nlint_m_entry => @lint_m_feed | ech() | @lint_m_ech | http(url=\"x\", on_error=@nope);",
+			nil,
+			[]string{"1:16 error compile", "2:32 error unknown-name", "2:40 error unknown-name", "2:68 error unknown-name"},
+		},
+		{
+			"Params",
+			"lint_n_feed => <timer: frq=1m> | text(target=\"main\") | random(min=\"a\");\nlint_n_tpl(x) => echo() | text(pattern=$x);\nlint_n_entry => @lint_n_feed | @lint_n_tpl() | @lint_n_feed_two(a=1);\nlint_n_feed_two => echo();",
+			map[string]string{"text.pattern": "a"},
+			[]string{"1:24 error compile", "1:63 error params", "3:32 error params", "3:48 error params"},
+		},
+		{"Syntax", "lint_l_feed => <timer: freq=1m> | echo(", nil, []string{"1:33 error syntax"}},
+	}
+
+	for _, v := range tests {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "lint.rule")
+		if err := os.WriteFile(file, []byte(v.Rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config := NewConfiguration()
+		config.Set("general.rules_path", dir)
+		for k, c := range v.Config {
+			config.Set(k, c)
+		}
+
+		diagnostics, err := Lint(config)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", v.Name, err)
+			continue
+		}
+		had := make([]string, 0)
+		for _, d := range diagnostics {
+			if d.File != file {
+				t.Errorf("%s: wrong file: expected=%#v had=%#v", v.Name, file, d.File)
+			}
+			had = append(had, fmt.Sprintf("%d:%d %s %s", d.Line, d.Column, d.Severity, d.Check))
+		}
+		if !reflect.DeepEqual(had, v.Expected) {
+			t.Errorf("%s: wrong diagnostics: expected=%#v had=%#v (%v)", v.Name, v.Expected, had, diagnostics)
+		}
+	}
+}
+
+func TestLinterDynamicFields(t *testing.T) {
+	// the rules are not compiled: the folder feeder would be added to the rule set
+	file := filepath.Join(t.TempDir(), "dynamic.rule")
+	content := "dyn_feed => <folder: name=\".\", type=\"local\"> | format(template=\"{{.anything}}\");\n" +
+		"dyn_js => <timer: freq=1m> | js(path=\"a.js\", function=\"f\") | format(template=\"{{.anything}}\");"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parser, _ := NewParser()
+	ast, err := parser.ParseFile(file)
+	if err != nil {
+		t.Fatalf("wrong error: expected=%#v had=%#v", nil, err)
+	}
+	if had := NewLinter(NewConfiguration(), map[string]*AST{file: ast}).Run(); len(had) != 0 {
+		t.Errorf("wrong diagnostics: expected=%#v had=%#v", []Diagnostic{}, had)
+	}
+}
+
+func TestTemplateFields(t *testing.T) {
+	type Test struct {
+		Template string
+		Expected []string
+	}
+	tests := []Test{
+		{"plain text", []string{}},
+		{"{{.a}} {{.b.c}} {{.a}}", []string{"a", "b"}},
+		{"{{if .a}}{{.b}}{{else}}{{.c}}{{end}}", []string{"a", "b", "c"}},
+		{"{{range .list}}{{.item}}{{$.d}}{{else}}{{.e}}{{end}}", []string{"list", "d", "e"}},
+		{"{{with .w}}{{.inner}}{{end}} {{printf \"%s\" .f | html}}", []string{"w", "f"}},
+	}
+
+	for _, v := range tests {
+		tpl := template.Must(template.New("test").Parse(v.Template))
+		had := templateFields(tpl.Tree.Root)
+		if !reflect.DeepEqual(had, v.Expected) {
+			t.Errorf("%s: wrong fields: expected=%#v had=%#v", v.Template, v.Expected, had)
+		}
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	d := Diagnostic{File: "a.rule", Line: 2, Column: 5, Severity: SeverityWarning, Check: "cache-ttl", Message: "msg"}
+	if had := d.String(); had != "a.rule:2:5: warning: msg (cache-ttl)" {
+		t.Errorf("wrong string: expected=%#v had=%#v", "a.rule:2:5: warning: msg (cache-ttl)", had)
+	}
+	d.Line = 0
+	if had := d.String(); had != "a.rule: warning: msg (cache-ttl)" {
+		t.Errorf("wrong string: expected=%#v had=%#v", "a.rule: warning: msg (cache-ttl)", had)
+	}
+}
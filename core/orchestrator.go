@@ -16,6 +16,7 @@ import (
 type Orchestrator struct {
 	asts   map[string]*AST
 	config *Configuration
+	admin  *AdminServer
 
 	waitFeeder sync.WaitGroup
 	sync.Mutex
@@ -39,13 +40,13 @@ func NewOrchestrator(config *Configuration) (*Orchestrator, error) {
 		log.Info("parsing rule file: %s", file)
 		ast, err := parser.ParseFile(file)
 		if err != nil {
-			log.Fatal("rule parsing: file '%s': %s", file, err)
+			log.Fatal("%s", wrapError(err, "rule parsing: file '%s'", file))
 		}
 		o.asts[file] = ast
 
 		_, err = RuleSetInstance().CompileAst(file, ast, o.config)
 		if err != nil {
-			return fmt.Errorf("compilation of '%s': %s", file, err)
+			return wrapError(err, "compilation of '%s'", file)
 		}
 		return nil
 	})
@@ -55,6 +56,122 @@ func NewOrchestrator(config *Configuration) (*Orchestrator, error) {
 	return o, nil
 }
 
+// Reload parses again the rule files and recompiles only the rules that have been changed.
+// The feeders of the unchanged rules keep running, whereas the new ones are started.
+func (o *Orchestrator) Reload() error {
+	asts := make(map[string]*AST)
+	parser, _ := NewParser()
+	err := fs.Glob(o.config.Get("general.rules_path"), "*.rule", func(file string) error {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("cannot get absolute path of %s: %s", file, err)
+		}
+		log.Info("parsing rule file: %s", abs)
+		ast, err := parser.ParseFile(abs)
+		if err != nil {
+			return wrapError(err, "rule parsing: file '%s'", abs)
+		}
+		asts[abs] = ast
+		return nil
+	})
+	if err != nil {
+		// the running rules are left untouched
+		return fmt.Errorf("reload: %s", err)
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	// WaitFeeders must not return while the feeders are replaced
+	o.waitFeeder.Add(1)
+	defer o.waitFeeder.Done()
+
+	rs := RuleSetInstance()
+	running := make(map[string]bool)
+	for _, rulename := range rs.feedRules {
+		running[rulename] = rs.rules[rulename].getFirstNode().(feeders.Feeder).IsRunning()
+	}
+
+	previous := o.asts
+	unchanged, err := o.compile(asts)
+	if err != nil {
+		// the previous rules are compiled again, so a broken file doesn't leave only a part of the rules running
+		log.Error("reload: %s, restoring the previous rules", err)
+		if _, rerr := o.compile(previous); rerr != nil {
+			log.Error("reload: restoring the previous rules: %s", rerr)
+		}
+		o.startFeeders(func(rulename string) bool {
+			return running[rulename]
+		})
+		return err
+	}
+
+	// only the new feeders are started, the unchanged ones keep their state
+	o.startFeeders(func(rulename string) bool {
+		return !unchanged[rulename]
+	})
+	return nil
+}
+
+// compile replaces the rules that are different in the ASTs and returns the unchanged ones, that keep running.
+// The feeders of the new rules are not started.
+func (o *Orchestrator) compile(asts map[string]*AST) (map[string]bool, error) {
+	rs := RuleSetInstance()
+	unchanged := rs.unchangedRules(asts)
+	removed := 0
+	for name, rule := range rs.rules {
+		if unchanged[name] {
+			continue
+		}
+		removed++
+		if rule.HasFeeder {
+			f := rule.getFirstNode().(feeders.Feeder)
+			if f.IsRunning() {
+				log.Debug("[%s] Stopping %s", name, f.Name())
+				f.Stop()
+				o.waitFeeder.Done()
+			}
+		}
+		rs.removeRule(name)
+	}
+	log.Info("reload: %d rules unchanged, %d rules removed", len(unchanged), removed)
+
+	rs.compiledDeps = make(map[string][]string)
+	rs.templates = make(map[string]*ruleTemplate)
+	rs.keep = make(map[string]bool)
+	for name := range unchanged {
+		rs.keep[name] = true
+	}
+	defer func() {
+		rs.keep = nil
+	}()
+
+	o.asts = asts
+	for file, ast := range asts {
+		if _, err := rs.CompileAst(file, ast, o.config); err != nil {
+			return nil, wrapError(err, "compilation of '%s'", file)
+		}
+	}
+
+	return unchanged, nil
+}
+
+// startFeeders starts the feeders that are not running, if selected by start
+func (o *Orchestrator) startFeeders(start func(rulename string) bool) {
+	rs := RuleSetInstance()
+	for _, rulename := range rs.feedRules {
+		if !start(rulename) {
+			continue
+		}
+		f := rs.rules[rulename].getFirstNode().(feeders.Feeder)
+		if !f.IsRunning() {
+			log.Debug("[%s] Starting %s", rulename, f.Name())
+			o.waitFeeder.Add(1)
+			f.Start()
+		}
+	}
+}
+
 // StartFeeders opens the gates
 func (o *Orchestrator) StartFeeders() {
 	o.Lock()
@@ -91,6 +208,9 @@ func (o *Orchestrator) WaitFeeders() {
 
 // StopFeeders closes the gates
 func (o *Orchestrator) StopFeeders() {
+	// the handlers of the admin API take the lock, so the server is stopped before taking it
+	o.stopAdmin()
+
 	o.Lock()
 	defer o.Unlock()
 
@@ -109,3 +229,91 @@ func (o *Orchestrator) StopFeeders() {
 	rs.bus.Publish(data.EventTopicName, &data.Event{Type: "shutdown"})
 	rs.bus.WaitAsync()
 }
+
+// StartAdmin starts the HTTP admin API configured in the general.admin section.
+// The Orchestrator keeps waiting while the admin API is running, even if all the feeders have been stopped.
+func (o *Orchestrator) StartAdmin() error {
+	o.Lock()
+	defer o.Unlock()
+	if o.admin != nil {
+		return fmt.Errorf("admin API already started")
+	}
+
+	admin := NewAdminServer(o, o.config)
+	if err := admin.Start(); err != nil {
+		return err
+	}
+	o.admin = admin
+	o.waitFeeder.Add(1)
+	return nil
+}
+
+// stopAdmin stops the admin API, if it has been started
+func (o *Orchestrator) stopAdmin() {
+	o.Lock()
+	admin := o.admin
+	o.admin = nil
+	o.Unlock()
+
+	if admin != nil {
+		admin.Stop()
+		o.waitFeeder.Done()
+	}
+}
+
+// getFeeder returns the Feeder of the rule identified by name (the rule name or its complete identifier)
+func (o *Orchestrator) getFeeder(name string) (feeders.Feeder, error) {
+	rs := RuleSetInstance()
+	rule, ok := rs.rules[name]
+	if !ok {
+		for _, r := range rs.rules {
+			if r.Name == name {
+				if rule != nil {
+					return nil, fmt.Errorf("rule name '%s' is ambiguous, use the complete identifier", name)
+				}
+				rule = r
+			}
+		}
+	}
+	if rule == nil {
+		return nil, fmt.Errorf("rule '%s' not found", name)
+	}
+	if !rule.HasFeeder {
+		return nil, fmt.Errorf("rule '%s' doesn't have a feeder", name)
+	}
+	return rule.getFirstNode().(feeders.Feeder), nil
+}
+
+// StartFeeder starts the Feeder of a single rule
+func (o *Orchestrator) StartFeeder(name string) error {
+	o.Lock()
+	defer o.Unlock()
+	f, err := o.getFeeder(name)
+	if err != nil {
+		return err
+	}
+	if f.IsRunning() {
+		return fmt.Errorf("feeder of rule '%s' is already running", name)
+	}
+	log.Debug("[%s] Starting %s", name, f.Name())
+	o.waitFeeder.Add(1)
+	f.Start()
+	return nil
+}
+
+// StopFeeder stops the Feeder of a single rule
+func (o *Orchestrator) StopFeeder(name string) error {
+	o.Lock()
+	defer o.Unlock()
+	f, err := o.getFeeder(name)
+	if err != nil {
+		return err
+	}
+	if !f.IsRunning() {
+		return fmt.Errorf("feeder of rule '%s' is not running", name)
+	}
+	log.Debug("[%s] Stopping %s", name, f.Name())
+	f.Stop()
+	o.waitFeeder.Done()
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/Matrix86/driplane/feeders"
+	"github.com/Matrix86/driplane/filters"
 )
 
 func TestNewOrchestratorNoRulesPath(t *testing.T) {
@@ -187,3 +190,265 @@ func TestNewOrchestratorMultipleRuleFiles(t *testing.T) {
 		t.Errorf("expected at least 2 ASTs, got %d", len(o.asts))
 	}
 }
+
+func TestOrchestratorReload(t *testing.T) {
+	dir := t.TempDir()
+	feedFile := filepath.Join(dir, "reload_feed.rule")
+	content := "reload_feed => <timer: freq='1h'>;\n" +
+		"reload_other_feed => <timer: freq='1h'> | echo();"
+	if err := os.WriteFile(feedFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	ruleFile := filepath.Join(dir, "reload_rules.rule")
+	content = "#import \"reload_feed.rule\"\n" +
+		"reload_kept => @reload_feed | echo();\n" +
+		"reload_changed => @reload_feed | echo();\n" +
+		"reload_removed => echo();"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+
+	config := &Configuration{
+		flat: map[string]string{
+			"general.rules_path": dir,
+		},
+	}
+
+	o, err := NewOrchestrator(config)
+	if err != nil {
+		t.Fatalf("NewOrchestrator returned error: %s", err)
+	}
+	o.StartFeeders()
+	defer o.StopFeeders()
+
+	rs := RuleSetInstance()
+	feedFile, _ = filepath.Abs(feedFile)
+	ruleFile, _ = filepath.Abs(ruleFile)
+	feeder := rs.rules[feedFile+":reload_feed"].getFirstNode()
+	otherFeeder := rs.rules[feedFile+":reload_other_feed"].getFirstNode()
+	kept := rs.rules[ruleFile+":reload_kept"]
+	changed := rs.rules[ruleFile+":reload_changed"]
+
+	content = "reload_feed => <timer: freq='1h'>;\n" +
+		"reload_other_feed => <timer: freq='2h'> | echo();"
+	if err := os.WriteFile(feedFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	content = "#import \"reload_feed.rule\"\n" +
+		"reload_kept => @reload_feed | echo();\n" +
+		"reload_changed => @reload_feed | echo(extra=\"true\");\n" +
+		"reload_added => @reload_other_feed | echo();"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+
+	if err := o.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %s", err)
+	}
+
+	if r, ok := rs.rules[feedFile+":reload_feed"]; !ok || r.getFirstNode() != feeder {
+		t.Error("the unchanged feeder should not be replaced")
+	} else if !feeder.(feeders.Feeder).IsRunning() {
+		t.Error("the unchanged feeder should be still running")
+	}
+	if r, ok := rs.rules[feedFile+":reload_other_feed"]; !ok || r.getFirstNode() == otherFeeder {
+		t.Error("the changed feeder should be replaced")
+	} else if !r.getFirstNode().(feeders.Feeder).IsRunning() {
+		t.Error("the new feeder should be started")
+	}
+	if otherFeeder.(feeders.Feeder).IsRunning() {
+		t.Error("the old feeder should be stopped")
+	}
+	if rs.rules[ruleFile+":reload_kept"] != kept {
+		t.Error("the unchanged rule should not be replaced")
+	}
+	if r, ok := rs.rules[ruleFile+":reload_changed"]; !ok || r == changed {
+		t.Error("the changed rule should be replaced")
+	}
+	if _, ok := rs.rules[ruleFile+":reload_removed"]; ok {
+		t.Error("the removed rule should not be in the ruleset")
+	}
+	if _, ok := rs.rules[ruleFile+":reload_added"]; !ok {
+		t.Error("the new rule should be in the ruleset")
+	}
+	if rs.bus.HasCallback(changed.getLastNode().(filters.Filter).GetIdentifier()) {
+		t.Error("the subscriptions of the changed rule should be removed")
+	}
+}
+
+func TestOrchestratorReloadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "reload_templates.rule")
+	content := "reload_tpl1(text) => format(template=$text);\n" +
+		"reload_tpl2(text) => format(template=$text);\n" +
+		"reload_tpl_kept => echo() | @reload_tpl1(text=\"a\");\n" +
+		"reload_tpl_changed => echo() | @reload_tpl2(text=\"b\");"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+
+	config := &Configuration{
+		flat: map[string]string{
+			"general.rules_path": dir,
+		},
+	}
+	o, err := NewOrchestrator(config)
+	if err != nil {
+		t.Fatalf("NewOrchestrator returned error: %s", err)
+	}
+
+	rs := RuleSetInstance()
+	ruleFile, _ = filepath.Abs(ruleFile)
+	kept := rs.rules[ruleFile+":reload_tpl_kept"]
+	changed := rs.rules[ruleFile+":reload_tpl_changed"]
+
+	content = "reload_tpl1(text) => format(template=$text);\n" +
+		"reload_tpl2(text) => format(template=$text) | echo();\n" +
+		"reload_tpl_kept => echo() | @reload_tpl1(text=\"a\");\n" +
+		"reload_tpl_changed => echo() | @reload_tpl2(text=\"b\");"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	if err := o.Reload(); err != nil {
+		t.Fatalf("Reload returned error: %s", err)
+	}
+
+	if rs.rules[ruleFile+":reload_tpl_kept"] != kept {
+		t.Error("the rule calling an unchanged template should not be replaced")
+	}
+	if r, ok := rs.rules[ruleFile+":reload_tpl_changed"]; !ok || r == changed {
+		t.Error("the rule calling a changed template should be replaced")
+	} else if len(r.nodes) != 3 {
+		t.Errorf("wrong number of nodes: expected=3 had=%d", len(r.nodes))
+	}
+}
+
+func TestOrchestratorReloadParseError(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "reload_error.rule")
+	if err := os.WriteFile(ruleFile, []byte("reload_error_rule => echo();"), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+
+	config := &Configuration{
+		flat: map[string]string{
+			"general.rules_path": dir,
+		},
+	}
+
+	o, err := NewOrchestrator(config)
+	if err != nil {
+		t.Fatalf("NewOrchestrator returned error: %s", err)
+	}
+
+	if err := os.WriteFile(ruleFile, []byte("reload_error_rule =>"), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	if err := o.Reload(); err == nil {
+		t.Error("Reload should return an error if a file can't be parsed")
+	}
+
+	abs, _ := filepath.Abs(ruleFile)
+	if _, ok := RuleSetInstance().rules[abs+":reload_error_rule"]; !ok {
+		t.Error("the rules should be left untouched if the reload fails")
+	}
+}
+
+func TestOrchestratorReloadCompileError(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "reload_compile.rule")
+	content := "reload_compile_feed => <timer: freq='1h'> | echo();\n" +
+		"reload_compile_first => echo();\n" +
+		"reload_compile_second => echo();"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+
+	config := &Configuration{
+		flat: map[string]string{
+			"general.rules_path": dir,
+		},
+	}
+	o, err := NewOrchestrator(config)
+	if err != nil {
+		t.Fatalf("NewOrchestrator returned error: %s", err)
+	}
+	o.StartFeeders()
+	defer o.StopFeeders()
+
+	// the first rules are compiled, the last one fails
+	content = "reload_compile_feed => <timer: freq='2h'> | echo();\n" +
+		"reload_compile_first => echo() | echo();\n" +
+		"reload_compile_second => notexistingfilter();"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	if err := o.Reload(); err == nil {
+		t.Fatal("Reload should return an error if a rule can't be compiled")
+	}
+
+	rs := RuleSetInstance()
+	ruleFile, _ = filepath.Abs(ruleFile)
+	for _, name := range []string{"reload_compile_feed", "reload_compile_first", "reload_compile_second"} {
+		if _, ok := rs.rules[ruleFile+":"+name]; !ok {
+			t.Errorf("the rule '%s' should be restored", name)
+		}
+	}
+	if r, ok := rs.rules[ruleFile+":reload_compile_first"]; ok && len(r.nodes) != 1 {
+		t.Errorf("wrong number of nodes: expected=1 had=%d", len(r.nodes))
+	}
+	if r, ok := rs.rules[ruleFile+":reload_compile_feed"]; ok {
+		f := r.getFirstNode().(feeders.Feeder)
+		if !f.IsRunning() {
+			t.Error("the restored feeder should be running")
+		}
+		if params := r.node.Feeder.Params; len(params) == 0 || params[0].Value.String == nil || *params[0].Value.String != "1h" {
+			t.Error("the feeder should be compiled from the previous file")
+		}
+	}
+}
+
+func TestOrchestratorCompileErrorNoFeeders(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "compile_error.rule")
+	if err := os.WriteFile(ruleFile, []byte("compile_error_first => echo();"), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	config := &Configuration{
+		flat: map[string]string{
+			"general.rules_path": dir,
+		},
+	}
+	o, err := NewOrchestrator(config)
+	if err != nil {
+		t.Fatalf("NewOrchestrator returned error: %s", err)
+	}
+	previous := o.asts
+
+	content := "compile_error_feed => <timer: freq='1h'> | echo();\n" +
+		"compile_error_first => notexistingfilter();"
+	if err := os.WriteFile(ruleFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	parser, _ := NewParser()
+	abs, _ := filepath.Abs(ruleFile)
+	ast, err := parser.ParseFile(abs)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %s", err)
+	}
+
+	o.Lock()
+	defer o.Unlock()
+	if _, err := o.compile(map[string]*AST{abs: ast}); err == nil {
+		t.Fatal("compile should return an error if a rule can't be compiled")
+	}
+	rs := RuleSetInstance()
+	if r, ok := rs.rules[abs+":compile_error_feed"]; !ok {
+		t.Error("the rules before the error should be compiled")
+	} else if r.getFirstNode().(feeders.Feeder).IsRunning() {
+		t.Error("the feeders should not be started if the compilation fails")
+	}
+	if _, err := o.compile(previous); err != nil {
+		t.Errorf("compile returned error: %s", err)
+	}
+}
@@ -1,13 +1,17 @@
 package core
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Matrix86/driplane/data"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/Matrix86/driplane/feeders"
 	"github.com/Matrix86/driplane/filters"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 )
@@ -23,7 +27,22 @@ type PipeRule struct {
 	dependencies []string
 	file         string
 	config       *Configuration
+	node         *RuleNode
 	nodes        []INode
+
+	// filters receiving the messages when the rule is called from another one
+	inputs []filters.Filter
+	// topics where the last nodes of the rule publish their messages
+	outputs []string
+	// description of each node as written in the rule, used by the graph
+	labels map[string]string
+
+	// rule containing the call when the PipeRule is an instance of a called rule
+	parent   *PipeRule
+	instance string
+
+	// the messages of the feeder go through the nodes in FIFO order
+	ordered bool
 }
 
 func (p *PipeRule) getLastNode() INode {
@@ -40,7 +59,105 @@ func (p *PipeRule) getFirstNode() INode {
 	return p.nodes[0]
 }
 
+// paramValue converts the value of a parameter to the string passed to filters and feeders:
+// environment variables and files referenced in the strings are interpolated, numbers are written without exponent, booleans as "true" or "false", durations as written in the rule,
+// lists and maps are encoded as JSON
+func paramValue(par *Param) (string, error) {
+	if par.Value == nil {
+		return "", fmt.Errorf("parameter '%s' has no value", par.Name)
+	}
+	if par.Value.List != nil || par.Value.Map != nil {
+		v, err := par.Value.native()
+		if err != nil {
+			return "", fmt.Errorf("parameter '%s': %s", par.Name, err)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("parameter '%s': %s", par.Name, err)
+		}
+		return string(b), nil
+	}
+	v, err := par.Value.native()
+	if err != nil {
+		return "", fmt.Errorf("parameter '%s': %s", par.Name, err)
+	}
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+	return v.(string), nil
+}
+
+// native returns the Go value of a Value: string, float64, bool, []interface{} or map[string]interface{}.
+// Durations are returned as strings.
+func (v *Value) native() (interface{}, error) {
+	switch {
+	case v.String != nil:
+		return Interpolate(*v.String)
+	case v.Duration != nil:
+		return *v.Duration, nil
+	case v.Number != nil:
+		return *v.Number, nil
+	case v.Bool != nil:
+		return *v.Bool == "true", nil
+	case v.List != nil:
+		list := make([]interface{}, 0, len(v.List.Values))
+		for _, item := range v.List.Values {
+			n, err := item.native()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, n)
+		}
+		return list, nil
+	case v.Map != nil:
+		dict := make(map[string]interface{}, len(v.Map.Entries))
+		for _, entry := range v.Map.Entries {
+			n, err := entry.Value.native()
+			if err != nil {
+				return nil, err
+			}
+			dict[entry.Key] = n
+		}
+		return dict, nil
+	case v.Rule != nil:
+		return nil, fmt.Errorf("a rule reference is not accepted here")
+	case v.Var != nil:
+		return nil, fmt.Errorf("variable '$%s' is not defined", *v.Var)
+	}
+	return nil, fmt.Errorf("empty value")
+}
+
+// checkParam returns an error if the parameter is not declared in the schema or its value has not the declared type
+func checkParam(s schema.Schema, name string, value string) error {
+	par := s.Get(name)
+	if par == nil {
+		if s.Open {
+			return nil
+		}
+		return errors.New(unknownName("parameter", name, s.Names()))
+	}
+	return par.Check(value)
+}
+
+// missingParams returns the required parameters of the schema not found in params, where their names start with prefix
+func missingParams(s schema.Schema, params map[string]string, prefix string) []string {
+	missing := make([]string, 0)
+	for _, par := range s.Params {
+		if _, ok := params[prefix+par.Name]; par.Required && !ok {
+			missing = append(missing, "'"+par.Name+"'")
+		}
+	}
+	return missing
+}
+
 func (p *PipeRule) newFilter(fn *FilterNode) (filters.Filter, error) {
+	if !slices.Contains(filters.Names(), fn.Name) {
+		return nil, newRuleError(fn.Pos, "rule '%s': %s", p.Name, unknownName("filter", fn.Name, filters.Names()))
+	}
+
 	params := make(map[string]string)
 	config := p.config.GetConfig()
 	// The filter will receive only his configuration and general config in the parameters
@@ -54,105 +171,359 @@ func (p *PipeRule) newFilter(fn *FilterNode) (filters.Filter, error) {
 	}
 
 	// configurations will be overrided by the parameters defined in the rule file
+	sch, _ := filters.Describe(fn.Name)
 	for _, par := range fn.Params {
-		value := ""
-		if par.Value.Number != nil {
-			value = strconv.FormatFloat(*par.Value.Number, 'E', -1, 64)
-		} else {
-			value = *par.Value.String
+		if par.Name == "on_error" {
+			// handled by addNodes
+			continue
+		}
+		value, err := paramValue(par)
+		if err != nil {
+			return nil, newRuleError(par.Pos, "rule '%s': %s", p.Name, err)
+		}
+		if err := checkParam(sch, par.Name, value); err != nil {
+			return nil, newRuleError(par.Pos, "rule '%s': filter '%s': %s", p.Name, fn.Name, err)
 		}
 		params[par.Name] = value
 	}
+	if missing := missingParams(sch, params, ""); len(missing) > 0 {
+		return nil, newRuleError(fn.Pos, "rule '%s': filter '%s': missing required parameter %s", p.Name, fn.Name, strings.Join(missing, ", "))
+	}
 
 	rs := RuleSetInstance()
 	f, err := filters.NewFilter(p.Name, fn.Name+"filter", params, rs.bus, rs.lastID+1, fn.Neg)
 	if err != nil {
-		return nil, err
+		return nil, newRuleError(fn.Pos, "rule '%s': filter '%s': %s", p.Name, fn.Name, err)
 	}
 	rs.lastID++
+	p.setLabel(f.GetIdentifier(), nodeLabel(fn.Neg, fn.Name, fn.Params))
 
 	return f, nil
 }
 
+func (p *PipeRule) setLabel(id string, label string) {
+	if p.labels == nil {
+		p.labels = make(map[string]string)
+	}
+	p.labels[id] = label
+}
+
 func (p *PipeRule) getRuleCall(node *RuleCall) (*PipeRule, error) {
 	rs := RuleSetInstance()
-	// searching the rulecall in dependencies
-	for _, dep := range rs.compiledDeps[p.file] {
-		name := strings.Join([]string{dep, node.Name}, ":")
-		if r, ok := rs.rules[name]; ok {
-			return r, nil
+	// searching the rulecall in dependencies and then in the current file
+	name := lookupRule(p.file, rs.compiledDeps[p.file], node.Name, func(n string) bool {
+		_, ok := rs.rules[n]
+		return ok
+	})
+	if name == "" {
+		return nil, newRuleError(node.Pos, "rule '%s': %s...you need to define it", p.Name, unknownName("rule", node.Name, p.visibleRules()))
+	}
+	return rs.rules[name], nil
+}
+
+// getTemplate returns the identifier of the template called by node, or an empty string if it isn't a template
+func (p *PipeRule) getTemplate(node *RuleCall) string {
+	rs := RuleSetInstance()
+	return lookupRule(p.file, rs.compiledDeps[p.file], node.Name, func(n string) bool {
+		if _, ok := rs.rules[n]; ok {
+			// rules shadow the templates with the same name in the dependencies
+			return true
+		}
+		_, ok := rs.templates[n]
+		return ok
+	})
+}
+
+// visibleRules returns the names of the rules and of the templates that can be called from the rule
+func (p *PipeRule) visibleRules() []string {
+	rs := RuleSetInstance()
+	files := append([]string{p.file}, rs.compiledDeps[p.file]...)
+	names := make([]string, 0)
+	for _, file := range files {
+		for id := range rs.rules {
+			if strings.HasPrefix(id, file+":") {
+				names = append(names, strings.TrimPrefix(id, file+":"))
+			}
+		}
+		for id := range rs.templates {
+			if strings.HasPrefix(id, file+":") {
+				names = append(names, strings.TrimPrefix(id, file+":"))
+			}
+		}
+	}
+	return names
+}
+
+// owner returns the identifier of the compiled rule containing the nodes of p
+func (p *PipeRule) owner() string {
+	if p.parent != nil {
+		return p.parent.owner()
+	}
+	return p.GetIdentifier()
+}
+
+// isOrdered returns true if the nodes of p process the messages one at a time, in the order they are received
+func (p *PipeRule) isOrdered() bool {
+	if p.parent != nil {
+		return p.parent.isOrdered()
+	}
+	return p.ordered
+}
+
+// filterQueue returns the options of the queue of the filter, with a single worker if the rule is ordered
+func (p *PipeRule) filterQueue(f filters.Filter, fn *FilterNode) (filters.Queue, error) {
+	queue := f.Queue()
+	if !p.isOrdered() {
+		return queue, nil
+	}
+	for _, par := range fn.Params {
+		if par.Name != "workers" {
+			continue
 		}
+		if value, err := paramValue(par); err != nil || value != "1" {
+			return queue, newRuleError(par.Pos, "rule '%s': filter '%s': workers cannot be changed in a rule with order=\"%s\"", p.Name, fn.Name, feeders.OrderFIFO)
+		}
+	}
+	queue.Workers = 1
+	return queue, nil
+}
+
+// subscribe adds fn of the node identified by subscriber to the topic on the bus, tracking the rule as owner of the subscription
+func (p *PipeRule) subscribe(topic string, subscriber string, fn interface{}) error {
+	return RuleSetInstance().bus.subscribeOwned(p.owner(), subscriber, topic, fn, false)
+}
+
+// addInstance creates a new instance of the called rule, defined by node, and connects it to the prev topics.
+// The nodes of the instance become part of p, so each call has its own filters and its own outputs.
+func (p *PipeRule) addInstance(id string, node *RuleNode, file string, deps []string, call *RuleCall, prev []string) ([]string, error) {
+	for r := p; r != nil; r = r.parent {
+		if r.instance == id {
+			return nil, newRuleError(call.Pos, "rule '%s' calls itself", call.Name)
+		}
+	}
+
+	sub := &PipeRule{
+		Name:         node.Identifier,
+		config:       p.config,
+		node:         node,
+		dependencies: deps,
+		file:         file,
+		nodes:        make([]INode, 0),
+		parent:       p,
+		instance:     id,
+	}
+	outputs, err := sub.addNodes(node.First, prev)
+	if err != nil {
+		return nil, ruleError(err, call.Pos, "rule '%s': calling rule '%s'", p.Name, call.Name)
+	}
+	if len(outputs) == 0 {
+		return nil, newRuleError(call.Pos, "rule '%s': rule '%s' is empty", p.Name, call.Name)
+	}
+
+	p.nodes = append(p.nodes, sub.nodes...)
+	for k, v := range sub.labels {
+		p.setLabel(k, v)
 	}
-	// search it in the current file
-	name := strings.Join([]string{p.file, node.Name}, ":")
-	if foundrule, ok := rs.rules[name]; ok {
-		return foundrule, nil
+	if len(prev) == 0 {
+		p.inputs = append(p.inputs, sub.inputs...)
 	}
-	return nil, fmt.Errorf("rule '%s' not found...you need to define it", node.Name)
+	return p.addNodes(call.Next, outputs)
 }
 
 func (p *PipeRule) addNode(node *Node, prev string) error {
-	if node == nil {
-		return nil
+	var topics []string
+	if prev != "" {
+		topics = []string{prev}
+	}
+	outputs, err := p.addNodes(node, topics)
+	if err != nil {
+		return err
 	}
+	if outputs != nil {
+		p.outputs = outputs
+	}
+	return nil
+}
 
-	rs := RuleSetInstance()
-	if node.Filter != nil {
-		log.Debug("['%s'] new filter found '%s'", p.Name, node.Filter.Name)
+// addErrorHandler connects the rule specified in the on_error parameter to the messages that caused an error in the filter
+func (p *PipeRule) addErrorHandler(f filters.Filter, params []*Param) error {
+	for _, par := range params {
+		if par.Name != "on_error" {
+			continue
+		}
 
-		f, err := p.newFilter(node.Filter)
-		if err != nil {
-			return err
+		name := ""
+		if par.Value.Rule != nil {
+			name = *par.Value.Rule
+		} else if par.Value.String != nil {
+			name = strings.TrimPrefix(*par.Value.String, "@")
+		} else {
+			return newRuleError(par.Pos, "rule '%s': on_error requires a rule: on_error=@rule_name", p.Name)
 		}
 
-		if prev != "" {
-			err := rs.bus.SubscribeAsync(prev, f.Pipe, false)
-			if err != nil {
-				return err
-			}
+		log.Debug("['%s'] errors of '%s' sent to '%s'", p.Name, f.GetIdentifier(), name)
+		f.EnableError()
+		if _, err := p.addNodes(&Node{RuleCall: &RuleCall{Pos: par.Pos, Name: name}}, []string{f.ErrorIdentifier()}); err != nil {
+			return ruleError(err, par.Pos, "rule '%s': on_error", p.Name)
 		}
+	}
+	return nil
+}
+
+// addFilter adds the filter defined by fn to the rule, subscribing it to all the prev topics, and returns it
+func (p *PipeRule) addFilter(fn *FilterNode, prev []string) (filters.Filter, error) {
+	log.Debug("['%s'] new filter found '%s'", p.Name, fn.Name)
 
-		err = rs.bus.SubscribeAsync(data.EventTopicName, f.OnEvent, false)
+	f, err := p.newFilter(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prev) == 0 {
+		// first filter of the rule: it will receive messages from the rule calls
+		p.inputs = append(p.inputs, f)
+	}
+	queue, err := p.filterQueue(f, fn)
+	if err != nil {
+		return nil, err
+	}
+	RuleSetInstance().bus.setQueue(p.owner(), f.Rule(), f.GetIdentifier(), queue)
+	for _, topic := range prev {
+		err := RuleSetInstance().bus.subscribeQueued(p.owner(), f.GetIdentifier(), topic, f.Pipe)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
+
+	err = p.subscribe(data.EventTopicName, f.GetIdentifier(), f.OnEvent)
+	if err != nil {
+		return nil, err
+	}
 
-		p.nodes = append(p.nodes, f)
+	p.nodes = append(p.nodes, f)
 
-		return p.addNode(node.Filter.Next, f.GetIdentifier())
+	if err := p.addErrorHandler(f, fn.Params); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// addNodes adds the chain starting from node to the rule, subscribing its first element to all the prev topics.
+// It returns the topics where the end of the chain publishes its messages.
+func (p *PipeRule) addNodes(node *Node, prev []string) ([]string, error) {
+	if node == nil {
+		return prev, nil
+	}
+
+	if node.Filter != nil {
+		f, err := p.addFilter(node.Filter, prev)
+		if err != nil {
+			return nil, err
+		}
+		return p.addNodes(node.Filter.Next, []string{f.GetIdentifier()})
 	} else if node.RuleCall != nil {
 		log.Debug("['%s'] new rulecall found '%s'", p.Name, node.RuleCall.Name)
 		var err error
 
+		rs := RuleSetInstance()
+		if id := p.getTemplate(node.RuleCall); id != "" {
+			if t, ok := rs.templates[id]; ok {
+				instance, err := t.node.instantiate(node.RuleCall.Args)
+				if err != nil {
+					return nil, newRuleError(node.RuleCall.Pos, "rule '%s': calling rule '%s': %s", p.Name, node.RuleCall.Name, err)
+				}
+				return p.addInstance(id, instance, t.file, rs.compiledDeps[t.file], node.RuleCall, prev)
+			}
+		}
+		if node.RuleCall.Args != nil {
+			return nil, newRuleError(node.RuleCall.Pos, "rule '%s': rule '%s' has no parameters", p.Name, node.RuleCall.Name)
+		}
+
 		r, err := p.getRuleCall(node.RuleCall)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if prev != "" {
+		if len(prev) > 0 {
 			if r.HasFeeder {
-				return fmt.Errorf("rule '%s' contains a feeder and cannot be here", node.RuleCall.Name)
+				return nil, newRuleError(node.RuleCall.Pos, "rule '%s': rule '%s' contains a feeder and cannot be here", p.Name, node.RuleCall.Name)
+			}
+			// each call gets its own copy of the filters to not mix the messages of different callers
+			return p.addInstance(r.GetIdentifier(), r.node, r.file, r.dependencies, node.RuleCall, prev)
+		}
+		// the rules called at the beginning are shared: all the callers receive the messages of the same nodes
+		if len(r.outputs) == 0 {
+			return nil, newRuleError(node.RuleCall.Pos, "rule '%s': found an unknown node type", p.Name)
+		}
+		if r.isOrdered() {
+			// the messages come from a FIFO feeder, so they keep their order in the calling rule too
+			root := p
+			for root.parent != nil {
+				root = root.parent
+			}
+			root.ordered = true
+		}
+		return p.addNodes(node.RuleCall.Next, r.outputs)
+	} else if node.Branch != nil {
+		log.Debug("['%s'] new branch found with %d pipelines", p.Name, len(node.Branch.Pipelines))
+
+		outputs := make([]string, 0)
+		for _, pipeline := range node.Branch.Pipelines {
+			out, err := p.addNodes(pipeline, prev)
+			if err != nil {
+				return nil, err
 			}
+			outputs = append(outputs, out...)
+		}
 
-			node := r.getFirstNode()
-			err := rs.bus.SubscribeAsync(prev, node.(filters.Filter).Pipe, false)
+		return p.addNodes(node.Branch.Next, outputs)
+	} else if node.Condition != nil {
+		log.Debug("['%s'] new condition found with %d cases", p.Name, len(node.Condition.Cases))
+
+		outputs := make([]string, 0)
+		input := prev
+		for _, c := range node.Condition.Cases {
+			fn := &FilterNode{
+				Pos:    c.Predicate.Pos,
+				Neg:    c.Predicate.Neg,
+				Name:   c.Predicate.Name,
+				Params: c.Predicate.Params,
+			}
+			// the predicate is a normal filter whose not matching messages go to the next case
+			f, err := p.addFilter(fn, input)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			f.EnableElse()
+			p.setLabel(f.GetIdentifier(), "if "+p.labels[f.GetIdentifier()])
+
+			for _, pipeline := range c.Pipelines {
+				out, err := p.addNodes(pipeline, []string{f.GetIdentifier()})
+				if err != nil {
+					return nil, err
+				}
+				outputs = append(outputs, out...)
+			}
+			input = []string{f.ElseIdentifier()}
 		}
 
-		// This is a filter for sure!
-		last := r.getLastNode()
-		if _, ok := last.(filters.Filter); ok {
-			return p.addNode(node.RuleCall.Next, last.(filters.Filter).GetIdentifier())
-		} else if _, ok := last.(feeders.Feeder); ok {
-			return p.addNode(node.RuleCall.Next, last.(feeders.Feeder).GetIdentifier())
+		if len(node.Condition.Else) > 0 {
+			for _, pipeline := range node.Condition.Else {
+				out, err := p.addNodes(pipeline, input)
+				if err != nil {
+					return nil, err
+				}
+				outputs = append(outputs, out...)
+			}
 		} else {
-			return fmt.Errorf("found an unknown node type")
+			// without else the messages not matching any case go straight to the next node
+			outputs = append(outputs, input...)
 		}
+
+		return p.addNodes(node.Condition.Next, outputs)
 	}
 
-	return nil
+	return prev, nil
 }
 
 // NewPipeRule creates and returns a PipeRule struct
@@ -160,6 +531,7 @@ func NewPipeRule(node *RuleNode, config *Configuration, filename string, deps []
 	rule := &PipeRule{
 		Name:         node.Identifier,
 		config:       config,
+		node:         node,
 		dependencies: deps,
 		file:         filename,
 		nodes:        make([]INode, 0),
@@ -171,6 +543,9 @@ func NewPipeRule(node *RuleNode, config *Configuration, filename string, deps []
 	// The Rule has a feeder specified
 	if node.Feeder != nil {
 		log.Debug("['%s'] new feeder found '%s'", rule.Name, node.Feeder.Name)
+		if !slices.Contains(feeders.Names(), node.Feeder.Name) {
+			return nil, newRuleError(node.Feeder.Pos, "rule '%s': %s", rule.Name, unknownName("feeder", node.Feeder.Name, feeders.Names()))
+		}
 
 		// configuration override from the rule itself
 		params := make(map[string]string)
@@ -187,26 +562,33 @@ func NewPipeRule(node *RuleNode, config *Configuration, filename string, deps []
 		}
 
 		// Feeder params in the rule will overwrite that ones specified in the config file
+		sch, _ := feeders.Describe(node.Feeder.Name)
 		for _, par := range node.Feeder.Params {
-			value := ""
-			if par.Value.Number != nil {
-				value = strconv.FormatFloat(*par.Value.Number, 'E', -1, 64)
-			} else {
-				value = *par.Value.String
+			value, err := paramValue(par)
+			if err != nil {
+				return nil, newRuleError(par.Pos, "rule '%s': %s", rule.Name, err)
+			}
+			if err := checkParam(sch, par.Name, value); err != nil {
+				return nil, newRuleError(par.Pos, "rule '%s': feeder '%s': %s", rule.Name, node.Feeder.Name, err)
 			}
 			params[node.Feeder.Name+"."+par.Name] = value
 		}
+		if missing := missingParams(sch, params, node.Feeder.Name+"."); len(missing) > 0 {
+			return nil, newRuleError(node.Feeder.Pos, "rule '%s': feeder '%s': missing required parameter %s", rule.Name, node.Feeder.Name, strings.Join(missing, ", "))
+		}
 
 		rs := RuleSetInstance()
 		f, err := feeders.NewFeeder(rule.Name, node.Feeder.Name+"feeder", params, rs.bus, rs.lastID+1)
 		if err != nil {
 			log.Error("piperule.NewRule: %s", err)
-			return nil, err
+			return nil, newRuleError(node.Feeder.Pos, "rule '%s': feeder '%s': %s", rule.Name, node.Feeder.Name, err)
 		}
 		rs.lastID++
 
 		rule.HasFeeder = true
+		rule.ordered = f.Order() == feeders.OrderFIFO
 		rule.nodes = append(rule.nodes, f)
+		rule.setLabel(f.GetIdentifier(), feederLabel(node.Feeder.Name, node.Feeder.Params))
 		next = node.Feeder.Next
 
 		if err := rule.addNode(next, f.GetIdentifier()); err != nil {
@@ -214,7 +596,9 @@ func NewPipeRule(node *RuleNode, config *Configuration, filename string, deps []
 		}
 
 		// Adding the feeder node to the event bus
-		rs.bus.SubscribeAsync(data.EventTopicName, f.OnEvent, false)
+		if err := rule.subscribe(data.EventTopicName, f.GetIdentifier(), f.OnEvent); err != nil {
+			return nil, err
+		}
 	} else { // It doesn't start with a feeder
 		if err := rule.addNode(node.First, ""); err != nil {
 			return nil, err
@@ -1,8 +1,14 @@
 package core
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/feeders"
 	"github.com/Matrix86/driplane/filters"
 )
 
@@ -142,9 +148,9 @@ func TestNewFilterWithNumberParam(t *testing.T) {
 
 	num := 42.0
 	fn := &FilterNode{
-		Name: "echo",
+		Name: "random",
 		Params: []*Param{
-			{Name: "count", Value: &Value{Number: &num}},
+			{Name: "min", Value: &Value{Number: &num}},
 		},
 	}
 
@@ -409,12 +415,10 @@ func TestNewPipeRuleFeederWithNumberParam(t *testing.T) {
 		flat: map[string]string{},
 	}
 
-	pr, err := NewPipeRule(node, config, "test7.rule", nil)
-	if err != nil {
-		t.Fatalf("NewPipeRule returned error: %s", err)
-	}
-	if !pr.HasFeeder {
-		t.Error("should have feeder")
+	// the number is converted, but the timer feeder doesn't declare the parameter
+	_, err := NewPipeRule(node, config, "test7.rule", nil)
+	if err == nil || !strings.Contains(err.Error(), "parameter 'numval' doesn't exist") {
+		t.Errorf("wrong error: expected=%#v had=%#v", "parameter 'numval' doesn't exist", err)
 	}
 }
 
@@ -554,3 +558,420 @@ func TestAddNodeRuleCallWithFeederError(t *testing.T) {
 
 // Ensure filter package init runs (factories available)
 var _ filters.Filter
+
+func TestNewPipeRuleBranch(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	err := parser.handle.ParseString("branch_rule => echo() | { echo() ; echo() | echo() } | echo();", ast)
+	if err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+
+	pr, err := NewPipeRule(ast.Rules[0], config, "branch_test.rule", nil)
+	if err != nil {
+		t.Fatalf("NewPipeRule with branch returned error: %s", err)
+	}
+	if len(pr.nodes) != 5 {
+		t.Errorf("expected 5 nodes, got %d", len(pr.nodes))
+	}
+	if len(pr.inputs) != 1 {
+		t.Errorf("expected 1 input, got %d", len(pr.inputs))
+	}
+	if len(pr.outputs) != 1 || pr.outputs[0] != pr.getLastNode().(filters.Filter).GetIdentifier() {
+		t.Errorf("wrong outputs: %#v", pr.outputs)
+	}
+
+	var mu sync.Mutex
+	received := 0
+	err = rs.bus.Subscribe(pr.outputs[0], func(msg *data.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received++
+	})
+	if err != nil {
+		t.Fatalf("subscribe returned error: %s", err)
+	}
+
+	pr.inputs[0].Pipe(data.NewMessage("test"))
+	rs.bus.WaitAsync()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 2 {
+		t.Errorf("the message should reach the end of the rule once for each branch: expected=2 had=%d", received)
+	}
+}
+
+func TestNewPipeRuleBranchAsLastNode(t *testing.T) {
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	node := &RuleNode{
+		Identifier: "branch_last_rule",
+		First: &Node{
+			Branch: &BranchNode{
+				Pipelines: []*Node{
+					{Filter: &FilterNode{Name: "echo", Params: []*Param{}}},
+					{Filter: &FilterNode{Name: "echo", Params: []*Param{}}},
+				},
+			},
+		},
+	}
+
+	pr, err := NewPipeRule(node, config, "branch_last_test.rule", nil)
+	if err != nil {
+		t.Fatalf("NewPipeRule with branch returned error: %s", err)
+	}
+	if len(pr.inputs) != 2 {
+		t.Errorf("expected 2 inputs, got %d", len(pr.inputs))
+	}
+	if len(pr.outputs) != 2 {
+		t.Errorf("expected 2 outputs, got %d", len(pr.outputs))
+	}
+}
+
+func TestNewPipeRuleCondition(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	rules := "cond_rule => if number(op=\">\", value=5) { override(name=\"size\", value=\"big\") } " +
+		"else if number(op=\">\", value=2) { override(name=\"size\", value=\"medium\") } " +
+		"else { override(name=\"size\", value=\"small\") } | echo();\n" +
+		"cond_noelse_rule => if !number(op=\"<\", value=5) { override(name=\"size\", value=\"big\") } | echo();"
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	if err := parser.handle.ParseString(rules, ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+
+	type Test struct {
+		Name         string
+		Rule         *RuleNode
+		Input        string
+		ExpectedSize interface{}
+	}
+	tests := []Test{
+		{"FirstCase", ast.Rules[0], "10", "big"},
+		{"ElseIf", ast.Rules[0], "3", "medium"},
+		{"Else", ast.Rules[0], "1", "small"},
+		{"NoElseMatch", ast.Rules[1], "7", "big"},
+		{"NoElsePassThrough", ast.Rules[1], "1", nil},
+	}
+
+	for _, v := range tests {
+		pr, err := NewPipeRule(v.Rule, config, "cond_test.rule", nil)
+		if err != nil {
+			t.Fatalf("%s: NewPipeRule returned error: %s", v.Name, err)
+		}
+		if len(pr.outputs) != 1 {
+			t.Fatalf("%s: expected 1 output, got %d", v.Name, len(pr.outputs))
+		}
+
+		var mu sync.Mutex
+		received := make([]*data.Message, 0)
+		err = rs.bus.Subscribe(pr.outputs[0], func(msg *data.Message) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, msg)
+		})
+		if err != nil {
+			t.Fatalf("%s: subscribe returned error: %s", v.Name, err)
+		}
+
+		pr.inputs[0].Pipe(data.NewMessage(v.Input))
+		rs.bus.WaitAsync()
+
+		mu.Lock()
+		if len(received) != 1 {
+			t.Errorf("%s: expected 1 message, had %d", v.Name, len(received))
+		} else if size := received[0].GetTarget("size"); size != v.ExpectedSize {
+			t.Errorf("%s: wrong size: expected=%#v had=%#v", v.Name, v.ExpectedSize, size)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestNewPipeRuleOnError(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	rules := "on_error_handler => echo();\n" +
+		"on_error_rule => number(op=\">\", value=5, on_error=@on_error_handler) | echo();\n" +
+		"on_error_string_rule => number(on_error=\"on_error_handler\");\n"
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	if err := parser.handle.ParseString(rules, ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	if _, err := rs.CompileAst("on_error_test.rule", ast, config); err != nil {
+		t.Fatalf("CompileAst returned error: %s", err)
+	}
+
+	rule := rs.rules["on_error_test.rule:on_error_rule"]
+	// the error handler called by the rule is its second node
+	handler := rule.nodes[1].(filters.Filter)
+	if handler.Rule() != "on_error_handler" {
+		t.Fatalf("wrong error handler: %s", handler.Rule())
+	}
+
+	var mu sync.Mutex
+	received := make([]*data.Message, 0)
+	err := rs.bus.Subscribe(handler.GetIdentifier(), func(msg *data.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, msg)
+	})
+	if err != nil {
+		t.Fatalf("subscribe returned error: %s", err)
+	}
+
+	rule.inputs[0].Pipe(data.NewMessage("10"))
+	rule.inputs[0].Pipe(data.NewMessage("not a number"))
+	rs.bus.WaitAsync()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("the error handler should receive 1 message, had %d", len(received))
+	}
+	if received[0].GetMessage() != "not a number" {
+		t.Errorf("wrong message: %#v", received[0].GetMessage())
+	}
+	if received[0].GetTarget("error_rule") != "on_error_rule" || received[0].GetTarget("error") == nil {
+		t.Errorf("wrong error extras: %#v", received[0].GetExtra())
+	}
+
+	ast = &AST{}
+	if err := parser.handle.ParseString("on_error_missing => number(on_error=@not_defined);", ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	if _, err := NewPipeRule(ast.Rules[0], config, "on_error_test.rule", nil); err == nil {
+		t.Error("on_error with an undefined rule should return an error")
+	}
+
+	ast = &AST{}
+	if err := parser.handle.ParseString("on_error_ref => number(value=@on_error_handler);", ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	if _, err := NewPipeRule(ast.Rules[0], config, "on_error_test.rule", nil); err == nil {
+		t.Error("a rule reference should be accepted only by on_error")
+	}
+}
+
+func TestNewPipeRuleCallIsolation(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	rules := "isolation_common => echo();\n" +
+		"isolation_a => echo() | @isolation_common | echo();\n" +
+		"isolation_b => echo() | @isolation_common | echo();\n"
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	if err := parser.handle.ParseString(rules, ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	if _, err := rs.CompileAst("isolation_test.rule", ast, config); err != nil {
+		t.Fatalf("CompileAst returned error: %s", err)
+	}
+
+	a := rs.rules["isolation_test.rule:isolation_a"]
+	b := rs.rules["isolation_test.rule:isolation_b"]
+	if len(a.nodes) != 3 || len(b.nodes) != 3 {
+		t.Fatalf("wrong number of nodes: expected=3 had=%d,%d", len(a.nodes), len(b.nodes))
+	}
+	if a.nodes[1] == b.nodes[1] {
+		t.Error("the callers should have their own instance of the called rule")
+	}
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	for _, r := range []*PipeRule{a, b} {
+		name := r.Name
+		err := rs.bus.Subscribe(r.outputs[0], func(msg *data.Message) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name]++
+		})
+		if err != nil {
+			t.Fatalf("subscribe returned error: %s", err)
+		}
+	}
+
+	a.inputs[0].Pipe(data.NewMessage("test"))
+	rs.bus.WaitAsync()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received["isolation_a"] != 1 || received["isolation_b"] != 0 {
+		t.Errorf("the message should reach only the caller: %#v", received)
+	}
+}
+
+func TestNewPipeRuleCallShared(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	rules := "shared_feed => <timer: freq=\"1h\">;\n" +
+		"shared_filtered => @shared_feed | echo();\n" +
+		"shared_other => @shared_filtered | echo();\n" +
+		"shared_another => @shared_filtered | echo();\n"
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	if err := parser.handle.ParseString(rules, ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	if _, err := rs.CompileAst("shared_test.rule", ast, config); err != nil {
+		t.Fatalf("CompileAst returned error: %s", err)
+	}
+
+	feed := rs.rules["shared_test.rule:shared_feed"].getFirstNode().(feeders.Feeder)
+	filtered := rs.rules["shared_test.rule:shared_filtered"].getFirstNode().(filters.Filter)
+	subscribers := rs.bus.subscribers()
+	if expected := []string{filtered.GetIdentifier()}; !reflect.DeepEqual(subscribers[feed.GetIdentifier()], expected) {
+		t.Errorf("wrong subscribers of the feeder: expected=%#v had=%#v", expected, subscribers[feed.GetIdentifier()])
+	}
+	// the rules continuing from a shared rule are subscribed to its outputs
+	if had := len(subscribers[filtered.GetIdentifier()]); had != 2 {
+		t.Errorf("wrong number of subscribers of the shared rule: expected=2 had=%d", had)
+	}
+	for _, name := range []string{"shared_other", "shared_another"} {
+		if had := len(rs.rules["shared_test.rule:"+name].nodes); had != 1 {
+			t.Errorf("%s: wrong number of nodes: expected=1 had=%d", name, had)
+		}
+	}
+}
+
+func TestNewFilterRequiredParamFromConfig(t *testing.T) {
+	p := &PipeRule{
+		Name:   "test_rule_required",
+		config: &Configuration{flat: map[string]string{}},
+		file:   "testfile",
+	}
+	fn := &FilterNode{Name: "json"}
+	if _, err := p.newFilter(fn); err == nil || !strings.Contains(err.Error(), "missing required parameter 'selector'") {
+		t.Errorf("wrong error: expected=%#v had=%#v", "missing required parameter 'selector'", err)
+	}
+
+	// the required parameter can be set in the configuration
+	p.config = &Configuration{flat: map[string]string{"json.selector": "a.b"}}
+	if _, err := p.newFilter(fn); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestNewPipeRuleOrdered(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	rules := "ordered_called => echo() | echo();\n" +
+		"ordered_feed => <timer: freq=\"1s\", order=\"fifo\"> | echo() | @ordered_called | echo(workers=1);\n" +
+		"ordered_parallel => <timer: freq=\"1s\"> | echo();\n"
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	if err := parser.handle.ParseString(rules, ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	if _, err := rs.CompileAst("ordered_test.rule", ast, config); err != nil {
+		t.Fatalf("CompileAst returned error: %s", err)
+	}
+
+	ordered := rs.rules["ordered_test.rule:ordered_feed"]
+	for _, n := range ordered.nodes[1:] {
+		f := n.(filters.Filter)
+		if q := rs.bus.queues[f.GetIdentifier()]; q == nil || q.options.Workers != 1 {
+			t.Errorf("%s: the filters of an ordered rule should have a single worker", f.GetIdentifier())
+		}
+	}
+	parallel := rs.rules["ordered_test.rule:ordered_parallel"]
+	if q := rs.bus.queues[parallel.nodes[1].(filters.Filter).GetIdentifier()]; q == nil || q.options.Workers != 4 {
+		t.Errorf("the filters of a parallel rule should keep their workers")
+	}
+
+	var mu sync.Mutex
+	received := make([]string, 0)
+	err := rs.bus.Subscribe(ordered.outputs[0], func(msg *data.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, msg.GetMessage().(string))
+	})
+	if err != nil {
+		t.Fatalf("subscribe returned error: %s", err)
+	}
+	expected := make([]string, 0)
+	for i := 0; i < 100; i++ {
+		expected = append(expected, fmt.Sprintf("message %d", i))
+		rs.bus.Publish(ordered.nodes[0].(feeders.Feeder).GetIdentifier(), data.NewMessage(expected[i]))
+	}
+	rs.bus.WaitAsync()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("the messages should keep their order: %v", received)
+	}
+}
+
+func TestNewPipeRuleOrderedChain(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	rules := "ordered_chain_feed => <timer: freq=\"1h\", order=\"fifo\">;\n" +
+		"ordered_chain_first => @ordered_chain_feed | echo();\n" +
+		"ordered_chain_second => @ordered_chain_first | echo();\n"
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	if err := parser.handle.ParseString(rules, ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	if _, err := rs.CompileAst("ordered_chain_test.rule", ast, config); err != nil {
+		t.Fatalf("CompileAst returned error: %s", err)
+	}
+
+	for _, name := range []string{"ordered_chain_first", "ordered_chain_second"} {
+		f := rs.rules["ordered_chain_test.rule:"+name].getFirstNode().(filters.Filter)
+		if q := rs.bus.queues[f.GetIdentifier()]; q == nil || q.options.Workers != 1 {
+			t.Errorf("%s: the filters of a rule continuing from an ordered rule should have a single worker", name)
+		}
+	}
+}
+
+func TestNewPipeRuleOrderedWorkers(t *testing.T) {
+	config := &Configuration{
+		flat: map[string]string{},
+	}
+
+	parser, _ := NewParser()
+	ast := &AST{}
+	if err := parser.handle.ParseString("ordered_workers => <timer: freq=\"1s\", order=\"fifo\"> | echo(workers=4);", ast); err != nil {
+		t.Fatalf("parsing returned error: %s", err)
+	}
+	_, err := NewPipeRule(ast.Rules[0], config, "ordered_workers_test.rule", nil)
+	expected := "rule 'ordered_workers': filter 'echo': workers cannot be changed in a rule with order=\"fifo\""
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("wrong error: expected=%#v had=%#v", expected, err)
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Matrix86/driplane/utils"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// RuleError is an error found in a rule file, reported with the position of the element causing it
+type RuleError struct {
+	Pos     lexer.Position
+	Message string
+	// line of the file containing the error with a caret under the column
+	Excerpt string
+}
+
+// Error returns the error in the form "file:line:column: message" followed by the excerpt of the file
+func (e *RuleError) Error() string {
+	msg := lexer.FormatError(e.Pos, e.Message)
+	if e.Excerpt != "" {
+		msg += "\n" + e.Excerpt
+	}
+	return msg
+}
+
+// newRuleError returns a RuleError reading the excerpt from the file in the position
+func newRuleError(pos lexer.Position, format string, args ...interface{}) *RuleError {
+	e := &RuleError{
+		Pos:     pos,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if pos.Filename != "" && pos.Line > 0 {
+		if content, err := os.ReadFile(pos.Filename); err == nil {
+			e.Excerpt = excerpt(string(content), pos)
+		}
+	}
+	return e
+}
+
+// parseError converts the errors returned by participle in a RuleError
+func parseError(err error, content string, filename string) error {
+	var perr participle.Error
+	if !errors.As(err, &perr) {
+		return err
+	}
+	pos := perr.Token().Pos
+	pos.Filename = filename
+	return &RuleError{
+		Pos:     pos,
+		Message: perr.Message(),
+		Excerpt: excerpt(content, pos),
+	}
+}
+
+// ruleError returns err as it is if it's already a RuleError, otherwise a new RuleError in pos
+func ruleError(err error, pos lexer.Position, format string, args ...interface{}) error {
+	var rerr *RuleError
+	if errors.As(err, &rerr) && rerr.Pos.Filename != "" {
+		return err
+	}
+	return newRuleError(pos, "%s: %s", fmt.Sprintf(format, args...), err)
+}
+
+// wrapError adds the context to err, unless it is a RuleError that already contains its position
+func wrapError(err error, format string, args ...interface{}) error {
+	var rerr *RuleError
+	if errors.As(err, &rerr) && rerr.Pos.Filename != "" {
+		return err
+	}
+	return fmt.Errorf("%s: %s", fmt.Sprintf(format, args...), err)
+}
+
+// excerpt returns the line of content in the position with a caret under the column
+func excerpt(content string, pos lexer.Position) string {
+	lines := strings.Split(content, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[pos.Line-1], "\r")
+
+	// the tabs are kept to align the caret with the column
+	var caret strings.Builder
+	for i, c := range []rune(line) {
+		if i >= pos.Column-1 {
+			break
+		}
+		if c == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return "    " + line + "\n    " + caret.String()
+}
+
+// unknownName returns the error message for a name not found, suggesting the most similar ones
+func unknownName(kind string, name string, names []string) string {
+	msg := fmt.Sprintf("%s '%s' doesn't exist", kind, name)
+	suggestions := utils.Suggest(name, names, 3)
+	if len(suggestions) == 0 {
+		return msg
+	}
+	for i, s := range suggestions {
+		suggestions[i] = "'" + s + "'"
+	}
+	return fmt.Sprintf("%s, did you mean %s?", msg, strings.Join(suggestions, " or "))
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+func TestRuleError(t *testing.T) {
+	type Test struct {
+		Name     string
+		Content  string
+		Pos      lexer.Position
+		Expected string
+	}
+	tests := []Test{
+		{"Simple", "rule => echo();", lexer.Position{Filename: "a.rule", Line: 1, Column: 9}, "a.rule:1:9: message\n    rule => echo();\n            ^"},
+		{"Tabs", "rule =>\n\t\techo();", lexer.Position{Filename: "a.rule", Line: 2, Column: 3}, "a.rule:2:3: message\n    \t\techo();\n    \t\t^"},
+		{"Unicode", "r => text(p=\"è\", x=1);", lexer.Position{Filename: "a.rule", Line: 1, Column: 18}, "a.rule:1:18: message\n    r => text(p=\"è\", x=1);\n                     ^"},
+		{"OutOfFile", "rule => echo();", lexer.Position{Filename: "a.rule", Line: 3, Column: 1}, "a.rule:3:1: message"},
+		{"NoPosition", "", lexer.Position{}, "message"},
+	}
+	for _, v := range tests {
+		err := &RuleError{Pos: v.Pos, Message: "message", Excerpt: excerpt(v.Content, v.Pos)}
+		if err.Error() != v.Expected {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.Expected, err.Error())
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	type Test struct {
+		Name     string
+		Rules    string
+		Expected string
+	}
+	tests := []Test{
+		{"UnknownFilter", "errors_a => echo() |\n  txt(pattern=\"a\");", ":2:3: rule 'errors_a': filter 'txt' doesn't exist, did you mean 'text'?\n      txt(pattern=\"a\");\n      ^"},
+		{"UnknownFeeder", "errors_b => <rs: url=\"x\">;", ":1:13: rule 'errors_b': feeder 'rs' doesn't exist, did you mean 'rss'?"},
+		{"WrongParam", "errors_c => echo() | text(pattern=$X);", "variable '$X' is not defined"},
+		{"FilterError", "errors_d => echo() | format(template=\"{{\");", ":1:22: rule 'errors_d': filter 'format': "},
+		{"UnknownRule", "errors_e1 => echo();\nerrors_e2 => echo() | @errors_e;", ":2:23: rule 'errors_e2': rule 'errors_e' doesn't exist, did you mean 'errors_e1'?"},
+		{"Predicate", "errors_f => if txt() { echo() };", ":1:16: rule 'errors_f': filter 'txt' doesn't exist"},
+		{"OnError", "errors_g => http(url=\"x\", on_error=5);", ":1:27: rule 'errors_g': on_error requires a rule"},
+		{"ParseError", "errors_h => echo(", ":1:18: unexpected token \"<EOF>\""},
+		{"UnknownParam", "errors_i => text(patern=\"a\");", ":1:18: rule 'errors_i': filter 'text': parameter 'patern' doesn't exist, did you mean 'pattern'?"},
+		{"ParamType", "errors_j => text(pattern=\"a\", regexp=\"yes\");", ":1:31: rule 'errors_j': filter 'text': parameter 'regexp' expects a value of type bool, got 'yes'"},
+		{"ParamValues", "errors_k => slack(action=\"send\");", ":1:19: rule 'errors_k': filter 'slack': parameter 'action' accepts only 'send_message', 'send_file', 'download_file', 'user_info', got 'send'"},
+		{"MissingParam", "errors_l => echo() | json();", ":1:22: rule 'errors_l': filter 'json': missing required parameter 'selector'"},
+		{"FeederParamType", "errors_m => <timer: freq=\"often\">;", ":1:21: rule 'errors_m': feeder 'timer': parameter 'freq' expects a value of type duration, got 'often'"},
+		{"FeederMissingParam", "errors_n => <file: toend=true>;", ":1:13: rule 'errors_n': feeder 'file': missing required parameter 'filename'"},
+	}
+
+	parser, _ := NewParser()
+	for _, v := range tests {
+		file := filepath.Join(t.TempDir(), "errors.rule")
+		if err := os.WriteFile(file, []byte(v.Rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ast, err := parser.ParseFile(file)
+		if err == nil {
+			_, err = RuleSetInstance().CompileAst(file, ast, NewConfiguration())
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", v.Name)
+			continue
+		}
+		if _, ok := err.(*RuleError); !ok {
+			t.Errorf("%s: wrong error type: %#v", v.Name, err)
+		}
+		if !strings.Contains(err.Error(), v.Expected) {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.Expected, err.Error())
+		}
+	}
+}
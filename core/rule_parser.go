@@ -1,10 +1,15 @@
 package core
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/evilsocket/islazy/log"
 
@@ -12,7 +17,10 @@ import (
 	"github.com/alecthomas/participle/lexer"
 )
 
-var importRegexp = regexp.MustCompile(`(?m)^#import\s+"([^"]+)"\s*$`)
+var (
+	importRegexp = regexp.MustCompile(`(?m)^#import\s+"([^"]+)"\s*$`)
+	defineRegexp = regexp.MustCompile(`(?m)^#define\s+([a-zA-Z_][a-zA-Z0-9_]*)\s+(.*?)\s*$`)
+)
 
 // A custom regexp lexer
 var ruleLexer = lexer.Must(lexer.Regexp(
@@ -21,33 +29,85 @@ var ruleLexer = lexer.Must(lexer.Regexp(
 		`|(^[#].*$)` +
 		`|(?P<Ident>[a-zA-Z][a-zA-Z_\d-]*)` +
 		`|(?P<String>(?:(?:"(?:\\.|[^\"])*")|(?:'(?:\\.|[^'])*')))` +
-		`|(?P<Float>\d+(?:\.\d+)?)` +
-		`|(?P<Punct>[]["|,:;()=<>@"])` +
+		`|(?P<Duration>\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h)(?:\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h))*)` +
+		`|(?P<Float>-?\d+(?:\.\d+)?)` +
+		`|(?P<Punct>[]["|,:;(){}=<>@$"])` +
 		`|(?P<Operators>!)`,
 ))
 
+// Token is an element of a rule file found by the lexer
+type Token struct {
+	// Type is the name of the group of the lexer matching the token: Ident, String, Duration, Float, Punct or Operators
+	Type  string
+	Value string
+	Pos   lexer.Position
+}
+
+// Tokenize returns the tokens of the content, skipping spaces and comments.
+// If an invalid token is found, it returns the tokens before it and the error.
+func Tokenize(content string) ([]Token, error) {
+	tokens := make([]Token, 0)
+	names := lexer.SymbolsByRune(ruleLexer)
+	lex, err := ruleLexer.Lex(strings.NewReader(content))
+	if err != nil {
+		return tokens, err
+	}
+	for {
+		t, err := lex.Next()
+		if err != nil {
+			return tokens, err
+		}
+		if t.EOF() {
+			return tokens, nil
+		}
+		tokens = append(tokens, Token{Type: names[t.Type], Value: t.Value, Pos: t.Pos})
+	}
+}
+
 // AST defines a set of Rules
 type AST struct {
 	Dependencies map[string]*AST
-	Rules        []*RuleNode `@@*`
+	// variables defined in the file with #define
+	Defines map[string]*Value
+	Rules   []*RuleNode `@@*`
 }
 
 // RuleNode defines the first part of the Rule
 type RuleNode struct {
-	Identifier string      `@Ident "="">"`
+	Pos lexer.Position
+
+	Identifier string      `@Ident`
+	Formals    *Formals    `@@? "=" ">"`
 	Feeder     *FeederNode `( @@`
 	First      *Node       `| @@ ) ";"`
 }
 
-// Node identifies a Filter or a RuleCall
+// Formals identifies the parameters of a rule template: name(param1, param2="default") => ...
+type Formals struct {
+	Params []*FormalParam `"(" ( @@ ("," @@)* )? ")"`
+}
+
+// FormalParam identifies a parameter of a rule template with its optional default value
+type FormalParam struct {
+	Pos lexer.Position
+
+	Name    string `@Ident`
+	Default *Value `("=" @@)?`
+}
+
+// Node identifies a Filter, a RuleCall, a Branch or a Condition
 type Node struct {
 	//Action   *ActionNode `( @@ `
-	Filter   *FilterNode `( @@`
-	RuleCall *RuleCall   `| @@)`
+	Condition *ConditionNode `( @@`
+	Filter    *FilterNode    `| @@`
+	RuleCall  *RuleCall      `| @@`
+	Branch    *BranchNode    `| @@)`
 }
 
 // FeederNode identifies the Feeder in the rule
 type FeederNode struct {
+	Pos lexer.Position
+
 	Name   string   `"<" @Ident`
 	Params []*Param `(":" @@ ("," @@)*)? ">"`
 	Next   *Node    `("|" @@)?`
@@ -55,6 +115,8 @@ type FeederNode struct {
 
 // FilterNode identifies the Filter in the rule
 type FilterNode struct {
+	Pos lexer.Position
+
 	Neg    bool     `@("!")?`
 	Name   string   `@Ident`
 	Params []*Param `"(" ( @@ ("," @@)* )? ")"`
@@ -69,35 +131,104 @@ type FilterNode struct {
 
 // RuleCall identifies the Call nodes in the rule
 type RuleCall struct {
-	Name string `"@" @Ident`
-	Next *Node  `("|" @@)?`
+	Pos lexer.Position
+
+	Name string   `"@" @Ident`
+	Args []*Param `("(" ( @@ ("," @@)* )? ")")?`
+	Next *Node    `("|" @@)?`
+}
+
+// BranchNode sends the same input to several sub-pipelines
+type BranchNode struct {
+	Pipelines []*Node `"{" @@ (";" @@)* "}"`
+	Next      *Node   `("|" @@)?`
+}
+
+// ConditionNode routes the input to the pipelines of the first Case whose predicate matches or to the Else ones
+type ConditionNode struct {
+	Cases []*CaseNode `"if" @@ ("else" "if" @@)*`
+	Else  []*Node     `("else" "{" @@ (";" @@)* "}")?`
+	Next  *Node       `("|" @@)?`
+}
+
+// CaseNode identifies a predicate Filter and the pipelines executed if it matches
+type CaseNode struct {
+	Predicate *PredicateNode `@@`
+	Pipelines []*Node        `"{" @@ (";" @@)* "}"`
+}
+
+// PredicateNode identifies the Filter used as condition
+type PredicateNode struct {
+	Pos lexer.Position
+
+	Neg    bool     `@("!")?`
+	Name   string   `@Ident`
+	Params []*Param `"(" ( @@ ("," @@)* )? ")"`
 }
 
 // Param identifies the parameters accepted by nodes
 type Param struct {
+	Pos lexer.Position
+
 	Name  string `@Ident "="`
 	Value *Value `@@`
 }
 
-// Value identifies a String or a Number
+// Value identifies a String, a Number, a Boolean, a Duration, a List, a Map, a reference to a Rule or to a variable.
+// After the parsing, the values referencing a variable keep its name in Var and they contain also the value of the variable.
 type Value struct {
-	String *string  `  @String`
-	Number *float64 `| @Float`
+	String   *string  `  @String`
+	Duration *string  `| @Duration`
+	Number   *float64 `| @Float`
+	Bool     *string  `| @("true" | "false")`
+	List     *List    `| @@`
+	Map      *Map     `| @@`
+	Rule     *string  `| "@" @Ident`
+	Var      *string  `| "$" @Ident`
+}
+
+// List identifies a list of values: [1, "a", true]
+type List struct {
+	Values []*Value `"[" ( @@ ("," @@)* )? "]"`
+}
+
+// Map identifies a map of values: {key: "value", "other key": 1}
+type Map struct {
+	Entries []*MapEntry `"{" ( @@ ("," @@)* )? "}"`
+}
+
+// MapEntry identifies a key of a Map with its value
+type MapEntry struct {
+	Key   string `(@Ident | @String) ":"`
+	Value *Value `@@`
 }
 
 // Parser handles the parsing of the rules
 type Parser struct {
 	handle *participle.Parser
+	// parser of the values in the #define directives
+	valueHandle *participle.Parser
+	// reads the content of the rule files and of their imports
+	readFile func(filename string) ([]byte, error)
 }
 
 // NewParser creates a new Parser struct
 func NewParser() (*Parser, error) {
 	var err error
-	parser := &Parser{}
+	parser := &Parser{readFile: os.ReadFile}
 	parser.handle, err = participle.Build(&AST{},
 		participle.Lexer(ruleLexer),
 		participle.Unquote("String"),
 		participle.CaseInsensitive("Keyword"),
+		participle.UseLookahead(2),
+	)
+	if err != nil {
+		return nil, err
+	}
+	parser.valueHandle, err = participle.Build(&Value{},
+		participle.Lexer(ruleLexer),
+		participle.Unquote("String"),
+		participle.UseLookahead(2),
 	)
 	if err != nil {
 		return nil, err
@@ -106,6 +237,11 @@ func NewParser() (*Parser, error) {
 	return parser, nil
 }
 
+// SetFileReader replaces the function used to read the files, i.e. to parse the content of the files not saved yet
+func (p *Parser) SetFileReader(fn func(filename string) ([]byte, error)) {
+	p.readFile = fn
+}
+
 func (p *Parser) extractImports(content string, relativeTo string) []string {
 	imports := make([]string, 0)
 	matches := importRegexp.FindAllStringSubmatch(content, -1)
@@ -127,15 +263,15 @@ func (p *Parser) parseFile(filename string, deps []string) (*AST, error) {
 
 	ast := &AST{}
 	log.Debug("parsing %s", filename)
-	content, err := os.ReadFile(filename)
+	content, err := p.readFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("parsing '%s': %s", filename, err)
 	}
 
 	// Parsing current file
-	err = p.handle.ParseBytes(content, ast)
+	err = p.handle.Parse(&namedReader{Reader: bytes.NewReader(content), name: filename}, ast)
 	if err != nil {
-		return nil, err
+		return nil, parseError(err, string(content), filename)
 	}
 
 	deps = append(deps, filename)
@@ -160,16 +296,404 @@ func (p *Parser) parseFile(filename string, deps []string) (*AST, error) {
 		}
 		i, err := p.parseFile(f, deps)
 		if err != nil {
+			var rerr *RuleError
+			if errors.As(err, &rerr) {
+				// the position already points to the imported file
+				return nil, err
+			}
 			return nil, fmt.Errorf("can't parse import file '%s': %s", f, err)
 		}
 		ast.Dependencies[f] = i
 	}
 
+	// preprocessing phase for defines, they can use the ones of the imported files
+	if err := p.parseDefines(string(content), filename, ast); err != nil {
+		return nil, err
+	}
+	for _, rule := range ast.Rules {
+		// the parameters of a template are resolved when it is called
+		formals := make(map[string]bool)
+		if rule.Formals != nil {
+			for _, f := range rule.Formals.Params {
+				if formals[f.Name] {
+					return nil, newRuleError(f.Pos, "rule '%s': parameter '%s' defined twice", rule.Identifier, f.Name)
+				}
+				formals[f.Name] = true
+				if err := ast.resolveValue(f.Default, nil); err != nil {
+					return nil, newRuleError(f.Pos, "rule '%s': %s", rule.Identifier, err)
+				}
+			}
+		}
+		err := forEachParam(rule, func(par *Param) error {
+			if err := ast.resolveValue(par.Value, formals); err != nil {
+				return newRuleError(par.Pos, "rule '%s': %s", rule.Identifier, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return ast, nil
 }
 
+// parseDefines fills the Defines of the AST with the #define directives found in content
+func (p *Parser) parseDefines(content string, filename string, ast *AST) error {
+	ast.Defines = make(map[string]*Value)
+	for _, m := range defineRegexp.FindAllStringSubmatchIndex(content, -1) {
+		name, literal := content[m[2]:m[3]], content[m[4]:m[5]]
+		pos := lexer.Position{
+			Filename: filename,
+			Offset:   m[0],
+			Line:     strings.Count(content[:m[0]], "\n") + 1,
+			Column:   1,
+		}
+		if _, ok := ast.Defines[name]; ok {
+			return &RuleError{Pos: pos, Message: fmt.Sprintf("variable '%s' already defined", name), Excerpt: excerpt(content, pos)}
+		}
+
+		// the errors in the value point to its position in the file
+		valuePos := pos
+		valuePos.Offset = m[4]
+		valuePos.Column = len([]rune(content[m[0]:m[4]])) + 1
+		value := &Value{}
+		if err := p.valueHandle.ParseString(literal, value); err != nil {
+			var perr participle.Error
+			if errors.As(err, &perr) {
+				valuePos.Offset += perr.Token().Pos.Offset
+				valuePos.Column += perr.Token().Pos.Column - 1
+				err = fmt.Errorf("%s", perr.Message())
+			}
+			return &RuleError{Pos: valuePos, Message: fmt.Sprintf("variable '%s': %s", name, err), Excerpt: excerpt(content, valuePos)}
+		}
+		if value.Rule != nil {
+			return &RuleError{Pos: valuePos, Message: fmt.Sprintf("variable '%s': a rule reference cannot be defined", name), Excerpt: excerpt(content, valuePos)}
+		}
+		if err := ast.resolveValue(value, nil); err != nil {
+			return &RuleError{Pos: valuePos, Message: fmt.Sprintf("variable '%s': %s", name, err), Excerpt: excerpt(content, valuePos)}
+		}
+		ast.Defines[name] = value
+	}
+	return nil
+}
+
+// namedReader gives the name of the file to the lexer, so the positions of the nodes contain it
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+func (r *namedReader) Name() string {
+	return r.name
+}
+
+// lookupDefine searches a variable in the file and then in the imported files.
+// A variable defined in more than one imported file is ambiguous and it has to be defined again in the file.
+func (ast *AST) lookupDefine(name string) (*Value, error) {
+	if v, ok := ast.Defines[name]; ok {
+		return v, nil
+	}
+	found := make(map[string]*Value)
+	for file, dep := range ast.Dependencies {
+		dep.findDefine(name, file, found)
+	}
+	if len(found) > 1 {
+		files := make([]string, 0, len(found))
+		for file := range found {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		return nil, fmt.Errorf("variable '$%s' is defined in more than one imported file: %s", name, strings.Join(files, ", "))
+	}
+	for _, v := range found {
+		return v, nil
+	}
+	return nil, fmt.Errorf("variable '$%s' is not defined", name)
+}
+
+// findDefine fills found with the files defining the variable, file is the name of the file of the AST
+func (ast *AST) findDefine(name string, file string, found map[string]*Value) {
+	if v, ok := ast.Defines[name]; ok {
+		found[file] = v
+		return
+	}
+	for f, dep := range ast.Dependencies {
+		dep.findDefine(name, f, found)
+	}
+}
+
+// resolveValue copies the value of the referenced variables in the Value and in the items of its lists and maps.
+// The variables in skip are left unresolved.
+func (ast *AST) resolveValue(v *Value, skip map[string]bool) error {
+	if v == nil {
+		return nil
+	}
+	if v.Var != nil {
+		if skip[*v.Var] {
+			return nil
+		}
+		def, err := ast.lookupDefine(*v.Var)
+		if err != nil {
+			return err
+		}
+		name := *v.Var
+		*v = *def
+		v.Var = &name
+		return nil
+	}
+	if v.List != nil {
+		for _, item := range v.List.Values {
+			if err := ast.resolveValue(item, skip); err != nil {
+				return err
+			}
+		}
+	}
+	if v.Map != nil {
+		for _, entry := range v.Map.Entries {
+			if err := ast.resolveValue(entry.Value, skip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // ParseFile fills the map with all the ASTs parsed from the input file
 func (p *Parser) ParseFile(filename string) (*AST, error) {
 	deps := make([]string, 0)
 	return p.parseFile(filename, deps)
 }
+
+// ruleCalls returns the names of all the rules called from the rule
+func ruleCalls(rule *RuleNode) []string {
+	calls := make([]string, 0)
+	var walk func(n *Node)
+	walkAll := func(nodes []*Node) {
+		for _, n := range nodes {
+			walk(n)
+		}
+	}
+	walk = func(n *Node) {
+		if n == nil {
+			return
+		}
+		switch {
+		case n.Filter != nil:
+			calls = append(calls, paramCalls(n.Filter.Params)...)
+			walk(n.Filter.Next)
+		case n.RuleCall != nil:
+			calls = append(calls, n.RuleCall.Name)
+			calls = append(calls, paramCalls(n.RuleCall.Args)...)
+			walk(n.RuleCall.Next)
+		case n.Branch != nil:
+			walkAll(n.Branch.Pipelines)
+			walk(n.Branch.Next)
+		case n.Condition != nil:
+			for _, c := range n.Condition.Cases {
+				calls = append(calls, paramCalls(c.Predicate.Params)...)
+				walkAll(c.Pipelines)
+			}
+			walkAll(n.Condition.Else)
+			walk(n.Condition.Next)
+		}
+	}
+
+	if rule.Feeder != nil {
+		walk(rule.Feeder.Next)
+	}
+	walk(rule.First)
+	return calls
+}
+
+// forEachParam calls fn for each parameter of the feeder and of the filters in the rule
+func forEachParam(rule *RuleNode, fn func(par *Param) error) error {
+	var walk func(n *Node) error
+	walkAll := func(nodes []*Node) error {
+		for _, n := range nodes {
+			if err := walk(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	params := func(list []*Param) error {
+		for _, par := range list {
+			if err := fn(par); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	walk = func(n *Node) error {
+		if n == nil {
+			return nil
+		}
+		switch {
+		case n.Filter != nil:
+			if err := params(n.Filter.Params); err != nil {
+				return err
+			}
+			return walk(n.Filter.Next)
+		case n.RuleCall != nil:
+			if err := params(n.RuleCall.Args); err != nil {
+				return err
+			}
+			return walk(n.RuleCall.Next)
+		case n.Branch != nil:
+			if err := walkAll(n.Branch.Pipelines); err != nil {
+				return err
+			}
+			return walk(n.Branch.Next)
+		case n.Condition != nil:
+			for _, c := range n.Condition.Cases {
+				if err := params(c.Predicate.Params); err != nil {
+					return err
+				}
+				if err := walkAll(c.Pipelines); err != nil {
+					return err
+				}
+			}
+			if err := walkAll(n.Condition.Else); err != nil {
+				return err
+			}
+			return walk(n.Condition.Next)
+		}
+		return nil
+	}
+
+	if rule.Feeder != nil {
+		if err := params(rule.Feeder.Params); err != nil {
+			return err
+		}
+		if err := walk(rule.Feeder.Next); err != nil {
+			return err
+		}
+	}
+	return walk(rule.First)
+}
+
+// instantiate returns a copy of the template where the references to its parameters are replaced by the arguments of the call
+func (rule *RuleNode) instantiate(args []*Param) (*RuleNode, error) {
+	bound := make(map[string]*Value)
+	for _, arg := range args {
+		if _, ok := bound[arg.Name]; ok {
+			return nil, fmt.Errorf("argument '%s' passed twice", arg.Name)
+		}
+		bound[arg.Name] = arg.Value
+	}
+
+	values := make(map[string]*Value)
+	if rule.Formals != nil {
+		for _, f := range rule.Formals.Params {
+			if v, ok := bound[f.Name]; ok {
+				values[f.Name] = v
+				delete(bound, f.Name)
+			} else if f.Default != nil {
+				values[f.Name] = f.Default
+			} else {
+				return nil, fmt.Errorf("missing argument '%s'", f.Name)
+			}
+		}
+	}
+	for name := range bound {
+		return nil, fmt.Errorf("unknown argument '%s'", name)
+	}
+
+	instance := deepCopy(rule).(*RuleNode)
+	var substitute func(v *Value)
+	substitute = func(v *Value) {
+		if v == nil {
+			return
+		}
+		if v.Var != nil {
+			if value, ok := values[*v.Var]; ok {
+				name := *v.Var
+				*v = *deepCopy(value).(*Value)
+				v.Var = &name
+			}
+			return
+		}
+		if v.List != nil {
+			for _, item := range v.List.Values {
+				substitute(item)
+			}
+		}
+		if v.Map != nil {
+			for _, entry := range v.Map.Entries {
+				substitute(entry.Value)
+			}
+		}
+	}
+	_ = forEachParam(instance, func(par *Param) error {
+		substitute(par.Value)
+		return nil
+	})
+	return instance, nil
+}
+
+var positionType = reflect.TypeOf(lexer.Position{})
+
+// deepCopy returns a copy of a node of the AST that doesn't share any pointer with the original
+func deepCopy(v interface{}) interface{} {
+	return copyValue(reflect.ValueOf(v), true).Interface()
+}
+
+// sameNodes compares two nodes of the AST ignoring their positions in the files
+func sameNodes(a, b interface{}) bool {
+	return reflect.DeepEqual(copyValue(reflect.ValueOf(a), false).Interface(), copyValue(reflect.ValueOf(b), false).Interface())
+}
+
+// copyValue returns a deep copy of src, with the positions of the nodes set to zero if keepPos is false
+func copyValue(src reflect.Value, keepPos bool) reflect.Value {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return reflect.Zero(src.Type())
+		}
+		dst := reflect.New(src.Type().Elem())
+		dst.Elem().Set(copyValue(src.Elem(), keepPos))
+		return dst
+	case reflect.Struct:
+		if src.Type() == positionType && !keepPos {
+			return reflect.Zero(positionType)
+		}
+		dst := reflect.New(src.Type()).Elem()
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				dst.Field(i).Set(copyValue(src.Field(i), keepPos))
+			}
+		}
+		return dst
+	case reflect.Slice:
+		if src.IsNil() {
+			return reflect.Zero(src.Type())
+		}
+		dst := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			dst.Index(i).Set(copyValue(src.Index(i), keepPos))
+		}
+		return dst
+	case reflect.Map:
+		if src.IsNil() {
+			return reflect.Zero(src.Type())
+		}
+		dst := reflect.MakeMapWithSize(src.Type(), src.Len())
+		for _, k := range src.MapKeys() {
+			dst.SetMapIndex(k, copyValue(src.MapIndex(k), keepPos))
+		}
+		return dst
+	}
+	return src
+}
+
+// paramCalls returns the names of the rules referenced in the parameters
+func paramCalls(params []*Param) []string {
+	calls := make([]string, 0)
+	for _, p := range params {
+		if p.Value != nil && p.Value.Rule != nil {
+			calls = append(calls, *p.Value.Rule)
+		}
+	}
+	return calls
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
+	"github.com/alecthomas/participle/lexer"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,11 +38,15 @@ func TestParser_ParseFile(t *testing.T) {
 	notExistFile := path.Join(os.TempDir(), "notexist")
 	cyclicFile1 := path.Join(os.TempDir(), "test1")
 	cyclicFile2 := path.Join(os.TempDir(), "test2")
+	testFile := path.Join(os.TempDir(), "test")
+	pos := func(offset, line, column int) lexer.Position {
+		return lexer.Position{Filename: testFile, Offset: offset, Line: line, Column: column}
+	}
 
 	tests := []Test{
 		{"FileNotExist", notExistFile, false, "", "", false, "", nil, fmt.Sprintf("parsing '%s': open %s: no such file or directory", notExistFile, notExistFile)},
-		{"EmptyFile", path.Join(os.TempDir(), "test"), true, "", "", false, "", &AST{Dependencies: map[string]*AST{}, Rules: []*RuleNode(nil)}, ""},
-		{"UnexpectedEOF", path.Join(os.TempDir(), "test"), true, "ident =>", "", false, "", nil, "1:9: unexpected token \"<EOF>\" (expected <ident>)"},
+		{"EmptyFile", path.Join(os.TempDir(), "test"), true, "", "", false, "", &AST{Dependencies: map[string]*AST{}, Defines: map[string]*Value{}, Rules: []*RuleNode(nil)}, ""},
+		{"UnexpectedEOF", path.Join(os.TempDir(), "test"), true, "ident =>", "", false, "", nil, testFile + ":1:9: unexpected token \"<EOF>\" (expected <ident>)\n    ident =>\n            ^"},
 		{"CyclicDep", cyclicFile1, true, "#import \"test1\"", cyclicFile2, true, "#import \"test2\"", nil, fmt.Sprintf("can't parse import file '%s': cyclic dependency on %s", cyclicFile1, cyclicFile1)},
 		{
 			"ParseOk",
@@ -53,11 +59,14 @@ func TestParser_ParseFile(t *testing.T) {
 			&AST{
 				Rules: []*RuleNode{
 					&RuleNode{
+						Pos:        pos(0, 1, 1),
 						Identifier: "rule1",
 						Feeder: &FeederNode{
+							Pos:  pos(9, 1, 10),
 							Name: "identifier",
 							Params: []*Param{
 								&Param{
+									Pos:  pos(22, 1, 23),
 									Name: "param1",
 									Value: &Value{
 										String: &v1,
@@ -65,6 +74,7 @@ func TestParser_ParseFile(t *testing.T) {
 									},
 								},
 								&Param{
+									Pos:  pos(39, 1, 40),
 									Name: "param2",
 									Value: &Value{
 										String: &v2,
@@ -72,6 +82,7 @@ func TestParser_ParseFile(t *testing.T) {
 									},
 								},
 								&Param{
+									Pos:  pos(56, 1, 57),
 									Name: "param3",
 									Value: &Value{
 										String: &v3,
@@ -84,17 +95,21 @@ func TestParser_ParseFile(t *testing.T) {
 						First: (*Node)(nil),
 					},
 					&RuleNode{
+						Pos:        pos(95, 3, 1),
 						Identifier: "rule2",
 						Feeder:     (*FeederNode)(nil),
 						First: &Node{
 							Filter: (*FilterNode)(nil),
 							RuleCall: &RuleCall{
+								Pos:  pos(104, 3, 10),
 								Name: "rule1",
 								Next: &Node{
 									Filter: &FilterNode{
+										Pos:  pos(113, 3, 19),
 										Name: "filter1",
 										Params: []*Param{
 											&Param{
+												Pos:  pos(121, 3, 27),
 												Name: "p1",
 												Value: &Value{
 													String: &v1,
@@ -102,6 +117,7 @@ func TestParser_ParseFile(t *testing.T) {
 												},
 											},
 											&Param{
+												Pos:  pos(133, 3, 39),
 												Name: "p2",
 												Value: &Value{
 													String: &v2,
@@ -112,9 +128,11 @@ func TestParser_ParseFile(t *testing.T) {
 										Next: &Node{
 											Filter: (*FilterNode)(nil),
 											RuleCall: &RuleCall{
+												Pos:  pos(148, 3, 54),
 												Name: "anotherrule",
 												Next: &Node{
 													Filter: &FilterNode{
+														Pos:    pos(163, 3, 69),
 														Name:   "ok",
 														Params: nil,
 														Next:   (*Node)(nil),
@@ -131,6 +149,7 @@ func TestParser_ParseFile(t *testing.T) {
 					},
 				},
 				Dependencies: map[string]*AST{},
+				Defines:      map[string]*Value{},
 			},
 			"",
 		},
@@ -175,3 +194,308 @@ func TestParser_ParseFile(t *testing.T) {
 		}
 	}
 }
+
+func TestParser_TypedValues(t *testing.T) {
+	type Test struct {
+		Name          string
+		Value         string
+		ExpectedValue string
+		ExpectedError bool
+	}
+
+	tests := []Test{
+		{"String", `"text"`, "text", false},
+		{"Integer", `5`, "5", false},
+		{"Float", `0.25`, "0.25", false},
+		{"Negative", `-3`, "-3", false},
+		{"True", `true`, "true", false},
+		{"False", `false`, "false", false},
+		{"Duration", `5m`, "5m", false},
+		{"ComposedDuration", `1h30m`, "1h30m", false},
+		{"SubSecondDuration", `250ms`, "250ms", false},
+		{"List", `["a", 1, true, 10s]`, `["a",1,true,"10s"]`, false},
+		{"EmptyList", `[]`, `[]`, false},
+		{"Map", `{Content-type: "application/json", "X-Count": 2}`, `{"Content-type":"application/json","X-Count":2}`, false},
+		{"EmptyMap", `{}`, `{}`, false},
+		{"Nested", `{a: [1, {b: false}]}`, `{"a":[1,{"b":false}]}`, false},
+		{"RuleInList", `[@rule]`, "", true},
+		{"Ident", `value`, "", true},
+	}
+
+	parser, _ := NewParser()
+	for _, v := range tests {
+		file := path.Join(t.TempDir(), "typed.rule")
+		if err := os.WriteFile(file, []byte(fmt.Sprintf("typed => echo(p=%s);", v.Value)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ast, err := parser.ParseFile(file)
+		if err != nil {
+			if !v.ExpectedError {
+				t.Errorf("%s: wrong error: %s", v.Name, err)
+			}
+			continue
+		}
+		value, err := paramValue(ast.Rules[0].First.Filter.Params[0])
+		if v.ExpectedError != (err != nil) {
+			t.Errorf("%s: wrong error: %v", v.Name, err)
+			continue
+		}
+		if value != v.ExpectedValue {
+			t.Errorf("%s: wrong value: expected=%#v had=%#v", v.Name, v.ExpectedValue, value)
+		}
+	}
+}
+
+func TestParser_Defines(t *testing.T) {
+	type Test struct {
+		Name          string
+		Imported      string
+		Content       string
+		ExpectedValue string
+		ExpectedError string
+	}
+
+	tests := []Test{
+		{"String", "", "#define URL \"https://example.com\"\nr => echo(p=$URL);", "https://example.com", ""},
+		{"Typed", "", "#define HEADERS {Content-type: \"application/json\", retry: 3}\nr => echo(p=$HEADERS);", `{"Content-type":"application/json","retry":3}`, ""},
+		{"InList", "", "#define A \"a\"\n#define B 2\nr => echo(p=[$A, $B]);", `["a",2]`, ""},
+		{"UsesDefine", "", "#define HOST \"example.com\"\n#define HOSTS [$HOST, \"other\"]\nr => echo(p=$HOSTS);", `["example.com","other"]`, ""},
+		{"Imported", "#define CHAT \"12345\"\n", "#import \"imported.rule\"\nr => echo(p=$CHAT);", "12345", ""},
+		{"Override", "#define CHAT \"12345\"\n", "#import \"imported.rule\"\n#define CHAT \"999\"\nr => echo(p=$CHAT);", "999", ""},
+		{"Feeder", "", "#define FREQ 5m\nr => <timer: freq=$FREQ>;", "5m", ""},
+		{"Undefined", "", "r => echo(p=$MISSING);", "", "rule 'r': variable '$MISSING' is not defined"},
+		{"NotVisibleInImported", "ir => echo(p=$CHAT);\n", "#import \"imported.rule\"\n#define CHAT \"1\"\nr => echo();", "", "rule 'ir': variable '$CHAT' is not defined"},
+		{"Redefined", "", "#define A \"a\"\n#define A \"b\"\nr => echo(p=$A);", "", "defines.rule:2:1: variable 'A' already defined\n    #define A \"b\"\n    ^"},
+		{"WrongValue", "", "#define A not a value\nr => echo(p=$A);", "", "defines.rule:1:11: variable 'A': unexpected token \"not\""},
+		{"RuleReference", "", "#define A @rule\nr => echo(p=$A);", "", "defines.rule:1:11: variable 'A': a rule reference cannot be defined"},
+	}
+
+	parser, _ := NewParser()
+	for _, v := range tests {
+		dir := t.TempDir()
+		if v.Imported != "" {
+			if err := os.WriteFile(path.Join(dir, "imported.rule"), []byte(v.Imported), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		file := path.Join(dir, "defines.rule")
+		if err := os.WriteFile(file, []byte(v.Content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		ast, err := parser.ParseFile(file)
+		if v.ExpectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), v.ExpectedError) {
+				t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: wrong error: %s", v.Name, err)
+			continue
+		}
+
+		rule := ast.Rules[0]
+		par := (*Param)(nil)
+		if rule.Feeder != nil {
+			par = rule.Feeder.Params[0]
+		} else {
+			par = rule.First.Filter.Params[0]
+		}
+		value, err := paramValue(par)
+		if err != nil {
+			t.Errorf("%s: paramValue returned '%s'", v.Name, err)
+			continue
+		}
+		if value != v.ExpectedValue {
+			t.Errorf("%s: wrong value: expected=%#v had=%#v", v.Name, v.ExpectedValue, value)
+		}
+	}
+}
+
+func TestParser_DefinesImports(t *testing.T) {
+	type Test struct {
+		Name          string
+		Files         map[string]string
+		ExpectedValue string
+		ExpectedError string
+	}
+
+	tests := []Test{
+		{"Ambiguous", map[string]string{
+			"a.rule": "#define CHAT \"1\"\n",
+			"b.rule": "#define CHAT \"2\"\n",
+		}, "", "defines.rule:3:11: rule 'r': variable '$CHAT' is defined in more than one imported file: "},
+		{"SameFile", map[string]string{
+			"a.rule":      "#import \"common.rule\"\n",
+			"b.rule":      "#import \"common.rule\"\n",
+			"common.rule": "#define CHAT \"1\"\n",
+		}, "1", ""},
+		{"Hidden", map[string]string{
+			"a.rule":      "#import \"common.rule\"\n#define CHAT \"2\"\n",
+			"b.rule":      "#import \"common.rule\"\n",
+			"common.rule": "#define CHAT \"1\"\n",
+		}, "", "variable '$CHAT' is defined in more than one imported file: "},
+	}
+
+	parser, _ := NewParser()
+	for _, v := range tests {
+		dir := t.TempDir()
+		for name, content := range v.Files {
+			if err := os.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		file := path.Join(dir, "defines.rule")
+		content := "#import \"a.rule\"\n#import \"b.rule\"\nr => echo(p=$CHAT);"
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// the result doesn't depend on the order of the imports
+		for i := 0; i < 10; i++ {
+			ast, err := parser.ParseFile(file)
+			if v.ExpectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), v.ExpectedError) {
+					t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: wrong error: %s", v.Name, err)
+				continue
+			}
+			if value, _ := paramValue(ast.Rules[0].First.Filter.Params[0]); value != v.ExpectedValue {
+				t.Errorf("%s: wrong value: expected=%#v had=%#v", v.Name, v.ExpectedValue, value)
+			}
+		}
+	}
+}
+
+func TestParser_Templates(t *testing.T) {
+	type Test struct {
+		Name          string
+		Content       string
+		ExpectedError string
+	}
+
+	tests := []Test{
+		{"Ok", "#define TO \"ops\"\nnotify(chat, text=\"{{.main}}\") => echo(to=$chat, text=$text);\nr => @notify(chat=$TO) | @notify(chat=\"dev\", text=\"x\") | @notify();", ""},
+		{"NoParams", "t() => echo();\nr => @t();", ""},
+		{"DuplicateParam", "t(a, a) => echo(p=$a);", "rule 't': parameter 'a' defined twice"},
+		{"UndefinedInTemplate", "t(a) => echo(p=$b);", "rule 't': variable '$b' is not defined"},
+		{"UndefinedDefault", "t(a=$B) => echo(p=$a);", "rule 't': variable '$B' is not defined"},
+		{"UndefinedArgument", "r => @t(a=$A);", "rule 'r': variable '$A' is not defined"},
+	}
+
+	parser, _ := NewParser()
+	for _, v := range tests {
+		file := path.Join(t.TempDir(), "templates.rule")
+		if err := os.WriteFile(file, []byte(v.Content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ast, err := parser.ParseFile(file)
+		if v.ExpectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), v.ExpectedError) {
+				t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: wrong error: %s", v.Name, err)
+			continue
+		}
+		if ast.Rules[0].Formals == nil {
+			t.Errorf("%s: the template should have parameters", v.Name)
+		}
+		if v.Name != "Ok" {
+			continue
+		}
+
+		// the parameters of the template are bound only when it is called
+		call := ast.Rules[1].First.RuleCall
+		if len(call.Args) != 1 || *call.Args[0].Value.String != "ops" {
+			t.Errorf("%s: wrong arguments: %#v", v.Name, call.Args)
+		}
+		instance, err := ast.Rules[0].instantiate(call.Args)
+		if err != nil {
+			t.Errorf("%s: instantiate returned '%s'", v.Name, err)
+			continue
+		}
+		for i, expected := range []string{"ops", "{{.main}}"} {
+			value, err := paramValue(instance.First.Filter.Params[i])
+			if err != nil || value != expected {
+				t.Errorf("%s: wrong value: expected=%#v had=%#v (%v)", v.Name, expected, value, err)
+			}
+		}
+		if _, err := paramValue(ast.Rules[0].First.Filter.Params[0]); err == nil {
+			t.Errorf("%s: the template should not be modified by instantiate", v.Name)
+		}
+		if _, err := ast.Rules[0].instantiate(nil); err == nil || err.Error() != "missing argument 'chat'" {
+			t.Errorf("%s: wrong error: %v", v.Name, err)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	type Test struct {
+		Name          string
+		Content       string
+		Expected      []string
+		ExpectedError string
+	}
+
+	tests := []Test{
+		{"Empty", "", []string{}, ""},
+		{"Rule", "r => <timer: freq=1m> | !text(pattern=\"a b\");", []string{"Ident:r", "Punct:=", "Punct:>", "Punct:<", "Ident:timer", "Punct::", "Ident:freq", "Punct:=", "Duration:1m", "Punct:>", "Punct:|", "Operators:!", "Ident:text", "Punct:(", "Ident:pattern", "Punct:=", "String:\"a b\"", "Punct:)", "Punct:;"}, ""},
+		{"Comment", "# comment\nr => echo(n=-1.5);", []string{"Ident:r", "Punct:=", "Punct:>", "Ident:echo", "Punct:(", "Ident:n", "Punct:=", "Float:-1.5", "Punct:)", "Punct:;"}, ""},
+		{"Invalid", "r => echo() % x", []string{"Ident:r", "Punct:=", "Punct:>", "Ident:echo", "Punct:(", "Punct:)"}, "1:13: invalid token '%'"},
+	}
+
+	for _, v := range tests {
+		tokens, err := Tokenize(v.Content)
+		if (err == nil && v.ExpectedError != "") || (err != nil && err.Error() != v.ExpectedError) {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+		}
+		had := make([]string, 0)
+		for _, tok := range tokens {
+			had = append(had, tok.Type+":"+tok.Value)
+		}
+		if strings.Join(had, " ") != strings.Join(v.Expected, " ") {
+			t.Errorf("%s: wrong tokens: expected=%#v had=%#v", v.Name, v.Expected, had)
+		}
+	}
+
+	tokens, _ := Tokenize("a =>\n  echo()")
+	if p := tokens[3].Pos; p.Line != 2 || p.Column != 3 || p.Offset != 7 {
+		t.Errorf("wrong position: expected=%#v had=%#v", "2:3 offset 7", p)
+	}
+}
+
+func TestParser_SetFileReader(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "main.rule")
+	lib := path.Join(dir, "lib.rule")
+	// only lib.rule exists on the disk, main.rule is given by the reader
+	if err := os.WriteFile(lib, []byte("lib => echo();"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parser, _ := NewParser()
+	parser.SetFileReader(func(filename string) ([]byte, error) {
+		if filename == file {
+			return []byte("#import \"lib.rule\"\nmain => @lib;"), nil
+		}
+		return os.ReadFile(filename)
+	})
+	ast, err := parser.ParseFile(file)
+	if err != nil {
+		t.Fatalf("wrong error: expected=%#v had=%#v", nil, err)
+	}
+	if len(ast.Rules) != 1 || ast.Rules[0].Identifier != "main" {
+		t.Errorf("wrong rules: expected=%#v had=%#v", "main", ast.Rules)
+	}
+	if dep, ok := ast.Dependencies[lib]; !ok || dep.Rules[0].Identifier != "lib" {
+		t.Errorf("wrong dependencies: expected=%#v had=%#v", lib, ast.Dependencies)
+	}
+}
@@ -2,10 +2,16 @@ package core
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
-	bus "github.com/asaskevich/EventBus"
+	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/feeders"
+	"github.com/Matrix86/driplane/filters"
+	"github.com/Matrix86/driplane/metrics"
+
 	"github.com/evilsocket/islazy/log"
 )
 
@@ -17,11 +23,21 @@ var (
 // Ruleset identifies a set of rules
 type Ruleset struct {
 	rules        map[string]*PipeRule
+	templates    map[string]*ruleTemplate
 	compiledDeps map[string][]string
 
 	feedRules []string
-	bus       bus.Bus
+	bus       *Bus
 	lastID    int32
+
+	// rules that have to be preserved during the recompilation of their files
+	keep map[string]bool
+}
+
+// ruleTemplate is a rule with parameters: its nodes are created again for each call
+type ruleTemplate struct {
+	node *RuleNode
+	file string
 }
 
 // RuleSetInstance is the singleton for the Ruleset object
@@ -29,8 +45,9 @@ func RuleSetInstance() *Ruleset {
 	once.Do(func() {
 		instance = &Ruleset{
 			rules:        make(map[string]*PipeRule),
+			templates:    make(map[string]*ruleTemplate),
 			compiledDeps: make(map[string][]string),
-			bus:          bus.New(),
+			bus:          NewBus(),
 			lastID:       0,
 		}
 	})
@@ -49,7 +66,7 @@ func (r *Ruleset) CompileAst(filename string, ast *AST, config *Configuration) (
 	for f, d := range ast.Dependencies {
 		childDeps, err := r.CompileAst(f, d, config)
 		if err != nil {
-			return nil, fmt.Errorf("compile file '%s': %s", f, err)
+			return nil, wrapError(err, "compile file '%s'", f)
 		}
 		deps = append(deps, f)
 		deps = append(deps, childDeps...)
@@ -57,11 +74,30 @@ func (r *Ruleset) CompileAst(filename string, ast *AST, config *Configuration) (
 	// track the compiled files and its dependencies
 	r.compiledDeps[filename] = deps
 
+	// templates are registered first to allow the rules to call them regardless of the order
+	for _, rn := range ast.Rules {
+		if rn.Formals == nil {
+			continue
+		}
+		if err := r.AddTemplate(filename, rn); err != nil {
+			return nil, err
+		}
+	}
+
 	for _, rn := range ast.Rules {
 		//pp.Println(rn)
+		if rn.Formals != nil {
+			continue
+		}
+		name := strings.Join([]string{filename, rn.Identifier}, ":")
+		if r.keep[name] {
+			// the rule didn't change since the last compilation
+			delete(r.keep, name)
+			continue
+		}
 		err := r.AddRule(filename, rn, config, deps)
 		if err != nil {
-			err = fmt.Errorf("adding rule '%s': %s", rn.Identifier, err)
+			err = wrapError(err, "adding rule '%s'", rn.Identifier)
 			return nil, err
 		}
 	}
@@ -78,7 +114,11 @@ func (r *Ruleset) AddRule(filename string, node *RuleNode, config *Configuration
 	// Prepend the filename to the node identifier
 	name := strings.Join([]string{filename, node.Identifier}, ":")
 	if _, ok := r.rules[name]; ok {
-		return fmt.Errorf("Ruleset.AddRule: rule '%s' redefined previously", node.Identifier)
+		return newRuleError(node.Pos, "Ruleset.AddRule: rule '%s' redefined previously", node.Identifier)
+	}
+
+	if _, ok := r.templates[name]; ok {
+		return newRuleError(node.Pos, "Ruleset.AddRule: rule '%s' redefined previously", node.Identifier)
 	}
 
 	pr, err := NewPipeRule(node, config, filename, deps)
@@ -94,3 +134,160 @@ func (r *Ruleset) AddRule(filename string, node *RuleNode, config *Configuration
 
 	return nil
 }
+
+// AddTemplate registers a rule with parameters, it will be compiled when called from another rule
+func (r *Ruleset) AddTemplate(filename string, node *RuleNode) error {
+	if node == nil || node.Identifier == "" {
+		return fmt.Errorf("Ruleset.AddTemplate: rules without name are not supported")
+	}
+	if node.Feeder != nil {
+		return newRuleError(node.Pos, "Ruleset.AddTemplate: rule '%s' has parameters and cannot contain a feeder", node.Identifier)
+	}
+
+	name := strings.Join([]string{filename, node.Identifier}, ":")
+	if _, ok := r.templates[name]; ok {
+		return newRuleError(node.Pos, "Ruleset.AddTemplate: rule '%s' redefined previously", node.Identifier)
+	}
+	if _, ok := r.rules[name]; ok {
+		return newRuleError(node.Pos, "Ruleset.AddTemplate: rule '%s' redefined previously", node.Identifier)
+	}
+
+	log.Debug("Added @%s to templates", node.Identifier)
+	r.templates[name] = &ruleTemplate{node: node, file: filename}
+	return nil
+}
+
+// removeRule deletes a rule from the set removing all its subscriptions from the bus
+func (r *Ruleset) removeRule(name string) {
+	rule, ok := r.rules[name]
+	if !ok {
+		return
+	}
+
+	r.bus.unsubscribeOwner(name)
+	for _, n := range rule.nodes {
+		switch node := n.(type) {
+		case filters.Filter:
+			node.OnEvent(&data.Event{Type: "unload"})
+			metrics.Forget(node.Rule(), node.GetIdentifier())
+		case feeders.Feeder:
+			node.OnEvent(&data.Event{Type: "unload"})
+			metrics.Forget(node.Rule(), node.GetIdentifier())
+		}
+	}
+
+	delete(r.rules, name)
+	for i, fr := range r.feedRules {
+		if fr == name {
+			r.feedRules = append(r.feedRules[:i:i], r.feedRules[i+1:]...)
+			break
+		}
+	}
+	log.Debug("Removed @%s from rules", rule.Name)
+}
+
+// unchangedRules compares the compiled rules with the ones defined in the ASTs and returns the compiled rules
+// that are still the same: same definition, same imported files and calls only to unchanged rules
+func (r *Ruleset) unchangedRules(asts map[string]*AST) map[string]bool {
+	defs := make(map[string]*RuleNode)
+	deps := make(map[string][]string)
+	for filename, ast := range asts {
+		collectRules(filename, ast, defs, deps)
+	}
+
+	result := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var check func(name string) bool
+	check = func(name string) bool {
+		if v, ok := result[name]; ok {
+			return v
+		}
+		if visiting[name] {
+			return false
+		}
+		visiting[name] = true
+
+		node, found := defs[name]
+		same := false
+		file := ""
+		if old, ok := r.rules[name]; ok {
+			same = found && sameNodes(old.node, node) && sameFiles(old.dependencies, deps[old.file])
+			file = old.file
+		} else if old, ok := r.templates[name]; ok {
+			// the instances of a template are part of the calling rules
+			same = found && sameNodes(old.node, node) && sameFiles(r.compiledDeps[old.file], deps[old.file])
+			file = old.file
+		}
+		if same {
+			for _, call := range ruleCalls(node) {
+				called := lookupRule(file, deps[file], call, func(n string) bool {
+					_, ok := defs[n]
+					return ok
+				})
+				if called == "" || !check(called) {
+					same = false
+					break
+				}
+			}
+		}
+		result[name] = same
+		return same
+	}
+
+	unchanged := make(map[string]bool)
+	for name := range r.rules {
+		if check(name) {
+			unchanged[name] = true
+		}
+	}
+	return unchanged
+}
+
+// collectRules fills defs with the rules defined in the AST and its dependencies, and deps with the files imported by each file
+func collectRules(filename string, ast *AST, defs map[string]*RuleNode, deps map[string][]string) []string {
+	if d, ok := deps[filename]; ok {
+		return d
+	}
+
+	fileDeps := make([]string, 0)
+	deps[filename] = fileDeps
+	for f, d := range ast.Dependencies {
+		fileDeps = append(fileDeps, f)
+		fileDeps = append(fileDeps, collectRules(f, d, defs, deps)...)
+	}
+	deps[filename] = fileDeps
+
+	for _, rn := range ast.Rules {
+		name := strings.Join([]string{filename, rn.Identifier}, ":")
+		if _, ok := defs[name]; !ok {
+			defs[name] = rn
+		}
+	}
+	return fileDeps
+}
+
+// lookupRule returns the identifier of the rule called from file, searching it in the dependencies first
+func lookupRule(file string, deps []string, name string, exists func(string) bool) string {
+	for _, dep := range deps {
+		id := strings.Join([]string{dep, name}, ":")
+		if exists(id) {
+			return id
+		}
+	}
+	id := strings.Join([]string{file, name}, ":")
+	if exists(id) {
+		return id
+	}
+	return ""
+}
+
+func sameFiles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	return reflect.DeepEqual(x, y)
+}
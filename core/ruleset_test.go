@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/Matrix86/driplane/filters"
 )
 
 func TestRuleSetInstanceSingleton(t *testing.T) {
@@ -384,3 +386,54 @@ func TestCompileAstFromParsedFile(t *testing.T) {
 	}
 	_ = deps
 }
+
+func TestCompileAstTemplates(t *testing.T) {
+	rs := RuleSetInstance()
+	config := &Configuration{flat: map[string]string{}}
+
+	file := filepath.Join(t.TempDir(), "templates.rule")
+	content := "tpl_notify(text, target=\"main\") => format(template=$text, target=$target) | echo();\n" +
+		"tpl_caller1 => echo() | @tpl_notify(text=\"one\");\n" +
+		"tpl_caller2 => @tpl_notify(text=\"two\") | echo();"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	parser, _ := NewParser()
+	ast, err := parser.ParseFile(file)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %s", err)
+	}
+	if _, err := rs.CompileAst(file, ast, config); err != nil {
+		t.Fatalf("CompileAst returned error: %s", err)
+	}
+
+	if _, ok := rs.templates[file+":tpl_notify"]; !ok {
+		t.Error("the template should be registered")
+	}
+	if _, ok := rs.rules[file+":tpl_notify"]; ok {
+		t.Error("the template should not be compiled as a rule")
+	}
+
+	caller1 := rs.rules[file+":tpl_caller1"]
+	caller2 := rs.rules[file+":tpl_caller2"]
+	if caller1 == nil || caller2 == nil {
+		t.Fatal("the callers should be compiled")
+	}
+	// each call has its own instance of the template's filters
+	if len(caller1.nodes) != 3 || len(caller2.nodes) != 3 {
+		t.Fatalf("wrong number of nodes: expected=3 had=%d,%d", len(caller1.nodes), len(caller2.nodes))
+	}
+	if caller1.nodes[1] == caller2.nodes[0] {
+		t.Error("the callers should not share the template's filters")
+	}
+	if len(caller2.inputs) != 1 || caller2.inputs[0] != caller2.nodes[0] {
+		t.Errorf("the first filter of the template should be the input of the caller: %#v", caller2.inputs)
+	}
+
+	// the subscriptions of the instance belong to the caller
+	first := caller1.nodes[0].(filters.Filter)
+	rs.removeRule(file + ":tpl_caller1")
+	if rs.bus.HasCallback(first.GetIdentifier()) {
+		t.Error("the subscriptions of the template instance should be removed with the caller")
+	}
+}
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Matrix86/driplane/data"
+)
+
+// RuleTester runs a rule against fixture messages without starting its feeder.
+// The messages are injected where the feeder would have sent them and the ones reaching the end of the rule are collected.
+type RuleTester struct {
+	sync.Mutex
+
+	config *Configuration
+	defs   map[string]*RuleNode
+	deps   map[string][]string
+
+	ruleName  string
+	input     string
+	outputs   []string
+	collected []*data.Message
+}
+
+// NewRuleTester compiles the rule called name defined in file, together with the rules it calls
+func NewRuleTester(config *Configuration, file string, name string) (*RuleTester, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get absolute path of %s: %s", file, err)
+	}
+
+	parser, err := NewParser()
+	if err != nil {
+		return nil, err
+	}
+	ast, err := parser.ParseFile(abs)
+	if err != nil {
+		return nil, wrapError(err, "rule parsing: file '%s'", abs)
+	}
+
+	t := &RuleTester{
+		config: config,
+		defs:   make(map[string]*RuleNode),
+		deps:   make(map[string][]string),
+	}
+	collectRules(abs, ast, t.defs, t.deps)
+
+	if name == "" {
+		if len(ast.Rules) != 1 {
+			return nil, fmt.Errorf("the file contains %d rules, you need to specify the one to test", len(ast.Rules))
+		}
+		name = ast.Rules[0].Identifier
+	}
+	id := strings.Join([]string{abs, name}, ":")
+	node, ok := t.defs[id]
+	if !ok {
+		return nil, fmt.Errorf("rule '%s' not found in '%s'", name, abs)
+	}
+
+	if node.Formals != nil {
+		// a rule with parameters is tested with their default values
+		if node, err = node.instantiate(nil); err != nil {
+			return nil, fmt.Errorf("rule '%s': %s", name, err)
+		}
+	}
+
+	t.ruleName = name
+	t.input = id + ":test"
+	if err := t.build(abs, node); err != nil {
+		return nil, err
+	}
+
+	for _, topic := range t.outputs {
+		if err := RuleSetInstance().bus.subscribeOwned(t.input, "", topic, t.collect, false); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// build connects the nodes of the rule after its feeder to the input topic of the tester.
+// If the rule starts calling a rule with a feeder, the nodes of the called rule following the feeder are connected too.
+func (t *RuleTester) build(file string, node *RuleNode) error {
+	first := node.First
+	if node.Feeder != nil {
+		first = node.Feeder.Next
+	}
+
+	prev := []string{t.input}
+	if first != nil && first.RuleCall != nil {
+		called := lookupRule(file, t.deps[file], first.RuleCall.Name, t.exists)
+		if called == "" {
+			return newRuleError(first.RuleCall.Pos, "rule '%s' not found...you need to define it", first.RuleCall.Name)
+		}
+		if feedNode := t.defs[called]; feedNode.Feeder != nil && feedNode.Formals == nil {
+			feedFile := called[:strings.LastIndex(called, ":")]
+			feedRule, err := t.newRule(feedFile, feedNode, feedNode.Feeder.Next)
+			if err != nil {
+				return err
+			}
+			if prev, err = feedRule.addNodes(feedNode.Feeder.Next, prev); err != nil {
+				return err
+			}
+			t.ruleName = feedNode.Identifier
+			first = first.RuleCall.Next
+		}
+	}
+
+	rule, err := t.newRule(file, node, first)
+	if err != nil {
+		return err
+	}
+	t.outputs, err = rule.addNodes(first, prev)
+	return err
+}
+
+// newRule returns an empty PipeRule for node, compiling first all the rules called by the nodes starting from first
+func (t *RuleTester) newRule(file string, node *RuleNode, first *Node) (*PipeRule, error) {
+	RuleSetInstance().compiledDeps[file] = t.deps[file]
+	for _, call := range ruleCalls(&RuleNode{First: first}) {
+		if err := t.compile(file, call, make(map[string]bool)); err != nil {
+			return nil, err
+		}
+	}
+	return &PipeRule{
+		Name:         node.Identifier,
+		config:       t.config,
+		node:         node,
+		dependencies: t.deps[file],
+		file:         file,
+		nodes:        make([]INode, 0),
+	}, nil
+}
+
+// compile adds to the Ruleset the rule called from file and all the rules it calls
+func (t *RuleTester) compile(file string, name string, visiting map[string]bool) error {
+	id := lookupRule(file, t.deps[file], name, t.exists)
+	if id == "" {
+		return fmt.Errorf("rule '%s' not found...you need to define it", name)
+	}
+	rs := RuleSetInstance()
+	if _, ok := rs.rules[id]; ok {
+		return nil
+	}
+	if _, ok := rs.templates[id]; ok {
+		return nil
+	}
+	if visiting[id] {
+		return fmt.Errorf("rule '%s' calls itself", name)
+	}
+	visiting[id] = true
+
+	node := t.defs[id]
+	ruleFile := id[:strings.LastIndex(id, ":")]
+	for _, call := range ruleCalls(node) {
+		if err := t.compile(ruleFile, call, visiting); err != nil {
+			return err
+		}
+	}
+	rs.compiledDeps[ruleFile] = t.deps[ruleFile]
+	if node.Formals != nil {
+		if err := rs.AddTemplate(ruleFile, node); err != nil {
+			return wrapError(err, "adding rule '%s'", name)
+		}
+		return nil
+	}
+	if err := rs.AddRule(ruleFile, node, t.config, t.deps[ruleFile]); err != nil {
+		return wrapError(err, "adding rule '%s'", name)
+	}
+	return nil
+}
+
+func (t *RuleTester) exists(id string) bool {
+	_, ok := t.defs[id]
+	return ok
+}
+
+func (t *RuleTester) collect(msg *data.Message) {
+	t.Lock()
+	defer t.Unlock()
+	t.collected = append(t.collected, msg)
+}
+
+// Run injects the messages in the rule, one at a time, and returns the messages reaching its end
+func (t *RuleTester) Run(messages []*data.Message) []*data.Message {
+	bus := RuleSetInstance().bus
+
+	t.Lock()
+	t.collected = make([]*data.Message, 0)
+	t.Unlock()
+
+	for _, msg := range messages {
+		if msg.GetTarget("rule_name") == nil {
+			msg.SetExtra("rule_name", t.ruleName)
+		}
+		bus.Publish(t.input, msg)
+		// waiting the end of the pipeline to keep the order of the results
+		bus.WaitAsync()
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	return t.collected
+}
+
+// ReadMessages reads a JSONL stream where each line is a message: the "main" key is the main text, the other keys are the extra
+func ReadMessages(r io.Reader) ([]*data.Message, error) {
+	messages := make([]*data.Message, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		main := fields["main"]
+		delete(fields, "main")
+		messages = append(messages, data.NewMessageWithExtra(main, fields))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// messageFields returns the fields of the message normalized as they would be decoded from JSON
+func messageFields(msg *data.Message) (map[string]interface{}, error) {
+	fields := msg.GetExtra()
+	fields["main"] = msg.GetMessage()
+	for k, v := range fields {
+		if b, ok := v.([]byte); ok {
+			fields[k] = string(b)
+		}
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	normalized := make(map[string]interface{})
+	err = json.Unmarshal(b, &normalized)
+	return normalized, err
+}
+
+// WriteMessages writes the messages as JSONL, in the format read by ReadMessages
+func WriteMessages(w io.Writer, messages []*data.Message) error {
+	for _, msg := range messages {
+		fields, err := messageFields(msg)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompareMessages returns the differences between the expected messages and the ones returned by the rule.
+// The order of the messages is not compared: the workers of the filters and the branches of the rules can change it.
+func CompareMessages(expected []*data.Message, had []*data.Message) ([]string, error) {
+	diffs := make([]string, 0)
+	if len(expected) != len(had) {
+		diffs = append(diffs, fmt.Sprintf("wrong number of messages: expected=%d had=%d", len(expected), len(had)))
+	}
+
+	remaining := make([]map[string]interface{}, 0, len(had))
+	for _, msg := range had {
+		h, err := messageFields(msg)
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, h)
+	}
+	for i, msg := range expected {
+		e, err := messageFields(msg)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for j, h := range remaining {
+			if reflect.DeepEqual(e, h) {
+				remaining = append(remaining[:j:j], remaining[j+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			eb, _ := json.Marshal(e)
+			diffs = append(diffs, fmt.Sprintf("expected message %d not found: %s", i+1, eb))
+		}
+	}
+	for _, h := range remaining {
+		hb, _ := json.Marshal(h)
+		diffs = append(diffs, fmt.Sprintf("unexpected message: %s", hb))
+	}
+	return diffs, nil
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Matrix86/driplane/data"
+)
+
+func writeTestRuleFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "tester.rule")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rule file: %s", err)
+	}
+	return file
+}
+
+func TestRuleTester(t *testing.T) {
+	type Test struct {
+		Name     string
+		Rules    string
+		Rule     string
+		Input    string
+		Expected string
+	}
+
+	tests := []Test{
+		{
+			"FeederInRule",
+			`tester_a => <rss: url="http://127.0.0.1:1/feed", freq="1h"> | text(target="title", pattern="security") | format(template="{{.title}}: {{.main}}");`,
+			"",
+			"{\"main\":\"one\",\"title\":\"security issue\"}\n{\"main\":\"two\",\"title\":\"other\"}\n",
+			"{\"main\":\"security issue: one\",\"rule_name\":\"tester_a\",\"title\":\"security issue\"}\n",
+		},
+		{
+			"FeederInCalledRule",
+			`Feed => <rss: url="http://127.0.0.1:1/feed", freq="1h"> | text(pattern="keep");
+			 tester_b => @Feed | format(template="{{.main}}!");`,
+			"tester_b",
+			"{\"main\":\"keep me\"}\n{\"main\":\"drop me\"}\n",
+			"{\"main\":\"keep me!\",\"rule_name\":\"tester_b\"}\n",
+		},
+		{
+			"RuleCall",
+			`upper => format(template="[{{.main}}]");
+			 tester_c => text(pattern="a") | @upper | { format(template="1{{.main}}") ; format(template="2{{.main}}") };`,
+			"tester_c",
+			"{\"main\":\"a\"}\n{\"main\":\"b\"}\n",
+			"",
+		},
+		{
+			"Template",
+			`wrap(text, target="main") => format(template=$text, target=$target);
+			 tester_t => text(pattern="a") | @wrap(text="1{{.main}}") | @wrap(text="2{{.main}}") | @wrap(text="x", target="other");`,
+			"tester_t",
+			"{\"main\":\"a\"}\n{\"main\":\"b\"}\n",
+			"{\"main\":\"21a\",\"other\":\"x\",\"rule_name\":\"wrap\"}\n",
+		},
+		{
+			"TemplateDefaults",
+			`tester_u(text="({{.main}})") => format(template=$text);`,
+			"",
+			"{\"main\":\"a\"}\n",
+			"{\"main\":\"(a)\",\"rule_name\":\"tester_u\"}\n",
+		},
+		{
+			"ConditionOnError",
+			`tester_h => format(template="error {{.main}}");
+			 tester_e => if number(op=">", value=5, on_error=@tester_h) { format(template="big {{.main}}") } else { format(template="small {{.main}}") };`,
+			"tester_e",
+			"{\"main\":\"7\"}\n{\"main\":\"1\"}\n{\"main\":\"x\"}\n",
+			"{\"main\":\"big 7\",\"rule_name\":\"tester_e\"}\n{\"main\":\"small 1\",\"rule_name\":\"tester_e\"}\n",
+		},
+		{
+			"OnlyFeeder",
+			`tester_d => <rss: url="http://127.0.0.1:1/feed", freq="1h">;`,
+			"",
+			"{\"main\":\"a\",\"title\":\"b\"}\n",
+			"{\"main\":\"a\",\"rule_name\":\"tester_d\",\"title\":\"b\"}\n",
+		},
+	}
+
+	for _, v := range tests {
+		tester, err := NewRuleTester(NewConfiguration(), writeTestRuleFile(t, v.Rules), v.Rule)
+		if err != nil {
+			t.Errorf("%s: NewRuleTester returned '%s'", v.Name, err)
+			continue
+		}
+		input, err := ReadMessages(strings.NewReader(v.Input))
+		if err != nil {
+			t.Errorf("%s: ReadMessages returned '%s'", v.Name, err)
+			continue
+		}
+		output := tester.Run(input)
+
+		if v.Name == "RuleCall" {
+			// the order of the branches is not guaranteed
+			if len(output) != 2 {
+				t.Errorf("%s: wrong number of messages: expected=2 had=%d", v.Name, len(output))
+			}
+			for _, m := range output {
+				if s := m.GetMessage().(string); s != "1[a]" && s != "2[a]" {
+					t.Errorf("%s: unexpected message %s", v.Name, s)
+				}
+			}
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := WriteMessages(&buf, output); err != nil {
+			t.Errorf("%s: WriteMessages returned '%s'", v.Name, err)
+		}
+		if buf.String() != v.Expected {
+			t.Errorf("%s: wrong output: expected=%#v had=%#v", v.Name, v.Expected, buf.String())
+		}
+	}
+}
+
+func TestNewRuleTesterErrors(t *testing.T) {
+	type Test struct {
+		Name  string
+		Rules string
+		Rule  string
+	}
+	tests := []Test{
+		{"TooManyRules", `tester_e1 => echo(); tester_e2 => echo();`, ""},
+		{"NotFound", `tester_e3 => echo();`, "missing"},
+		{"MissingCall", `tester_e4 => echo() | @missing;`, ""},
+		{"Recursive", `tester_e5 => echo() | @tester_e6; tester_e6 => echo() | @tester_e5;`, "tester_e5"},
+		{"MissingArgument", `t1(a) => format(template=$a); tester_e7 => echo() | @t1();`, "tester_e7"},
+		{"UnknownArgument", `t1(a) => format(template=$a); tester_e8 => echo() | @t1(a="x", b="y");`, "tester_e8"},
+		{"ArgumentsToRule", `r1 => echo(); tester_e9 => echo() | @r1(a="x");`, "tester_e9"},
+		{"RecursiveTemplate", `t1(a) => echo() | @t1(a=$a); tester_e10 => echo() | @t1(a="x");`, "tester_e10"},
+		{"TemplateWithFeeder", `t1(a) => <timer: freq=$a>; tester_e11 => @t1(a="1s") | echo();`, "tester_e11"},
+	}
+	for _, v := range tests {
+		if _, err := NewRuleTester(NewConfiguration(), writeTestRuleFile(t, v.Rules), v.Rule); err == nil {
+			t.Errorf("%s: expected an error", v.Name)
+		}
+	}
+}
+
+func TestCompareMessages(t *testing.T) {
+	expected := []*data.Message{
+		data.NewMessageWithExtra("a", map[string]interface{}{"n": 1.0}),
+		data.NewMessageWithExtra("b", map[string]interface{}{}),
+	}
+	same := []*data.Message{
+		data.NewMessageWithExtra("a", map[string]interface{}{"n": 1, "_hidden": "x"}),
+		data.NewMessageWithExtra("b", map[string]interface{}{}),
+	}
+	if diffs, err := CompareMessages(expected, same); err != nil || len(diffs) != 0 {
+		t.Errorf("messages should be equal: %v %v", diffs, err)
+	}
+
+	// the order of the messages is not relevant
+	reversed := []*data.Message{same[1], same[0]}
+	if diffs, err := CompareMessages(expected, reversed); err != nil || len(diffs) != 0 {
+		t.Errorf("messages in a different order should be equal: %v %v", diffs, err)
+	}
+
+	different := []*data.Message{
+		data.NewMessageWithExtra("a", map[string]interface{}{"n": 2}),
+	}
+	diffs, err := CompareMessages(expected, different)
+	if err != nil {
+		t.Fatalf("CompareMessages returned '%s'", err)
+	}
+	if len(diffs) != 4 {
+		t.Errorf("wrong number of differences: expected=4 had=%d (%v)", len(diffs), diffs)
+	}
+}
+
+func TestReadMessagesError(t *testing.T) {
+	if _, err := ReadMessages(strings.NewReader("{\"main\":\"a\"}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,499 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// WireVersion is the version of the encoding of the Messages, it changes only if an encoded Message can't be decoded
+// by the previous versions
+const WireVersion = 1
+
+// tags of the JSON objects containing the values that have no JSON type: {"$bytes": "aGVsbG8="}
+const (
+	bytesTag = "$bytes"
+	timeTag  = "$time"
+)
+
+// wireMessage is the envelope of an encoded Message, the fields only contain the types supported by wireValue
+type wireMessage struct {
+	Version  int                    `json:"version"`
+	ID       string                 `json:"id"`
+	Parent   string                 `json:"parent,omitempty"`
+	Created  time.Time              `json:"created"`
+	Hops     []string               `json:"hops,omitempty"`
+	FirstRun bool                   `json:"first_run,omitempty"`
+	Fields   map[string]interface{} `json:"fields"`
+}
+
+// MarshalJSON encodes the Message and its metadata as JSON. The []byte values are written as {"$bytes": "<base64>"},
+// the timestamps as {"$time": "<RFC 3339>"} and the floats always with a decimal point, so they are decoded with
+// their type. The keys of the maps starting with '$' are escaped doubling it.
+func (d *Message) MarshalJSON() ([]byte, error) {
+	w, err := d.wire()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range w.Fields {
+		if w.Fields[k], err = toJSON(v, k); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(w)
+}
+
+// UnmarshalJSON replaces the content of the Message with the one encoded by MarshalJSON
+func (d *Message) UnmarshalJSON(b []byte) error {
+	w := wireMessage{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&w); err != nil {
+		return fmt.Errorf("decoding the message: %s", err)
+	}
+	for k, v := range w.Fields {
+		var err error
+		if w.Fields[k], err = fromJSON(v, k); err != nil {
+			return fmt.Errorf("decoding the message: %s", err)
+		}
+	}
+	return d.load(w)
+}
+
+// MarshalBinary encodes the Message and its metadata as MessagePack, using the bin type for the []byte values and
+// the timestamp extension for the time.Time values
+func (d *Message) MarshalBinary() ([]byte, error) {
+	w, err := d.wire()
+	if err != nil {
+		return nil, err
+	}
+	b := msgp.AppendMapHeader(nil, 7)
+	b = msgp.AppendString(b, "version")
+	b = msgp.AppendInt(b, w.Version)
+	b = msgp.AppendString(b, "id")
+	b = msgp.AppendString(b, w.ID)
+	b = msgp.AppendString(b, "parent")
+	b = msgp.AppendString(b, w.Parent)
+	b = msgp.AppendString(b, "created")
+	b = msgp.AppendTimeExt(b, w.Created)
+	b = msgp.AppendString(b, "hops")
+	b = msgp.AppendArrayHeader(b, uint32(len(w.Hops)))
+	for _, hop := range w.Hops {
+		b = msgp.AppendString(b, hop)
+	}
+	b = msgp.AppendString(b, "first_run")
+	b = msgp.AppendBool(b, w.FirstRun)
+	b = msgp.AppendString(b, "fields")
+	return appendMsgpack(b, w.Fields)
+}
+
+// UnmarshalBinary replaces the content of the Message with the one encoded by MarshalBinary
+func (d *Message) UnmarshalBinary(b []byte) error {
+	w := wireMessage{}
+	n, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return fmt.Errorf("decoding the message: %s", err)
+	}
+	for i := uint32(0); i < n && err == nil; i++ {
+		var key string
+		if key, b, err = msgp.ReadStringBytes(b); err != nil {
+			break
+		}
+		switch key {
+		case "version":
+			w.Version, b, err = msgp.ReadIntBytes(b)
+		case "id":
+			w.ID, b, err = msgp.ReadStringBytes(b)
+		case "parent":
+			w.Parent, b, err = msgp.ReadStringBytes(b)
+		case "created":
+			w.Created, b, err = msgp.ReadTimeUTCBytes(b)
+		case "hops":
+			var hops uint32
+			if hops, b, err = msgp.ReadArrayHeaderBytes(b); err != nil {
+				break
+			}
+			w.Hops = make([]string, hops)
+			for j := range w.Hops {
+				if w.Hops[j], b, err = msgp.ReadStringBytes(b); err != nil {
+					break
+				}
+			}
+		case "first_run":
+			w.FirstRun, b, err = msgp.ReadBoolBytes(b)
+		case "fields":
+			var fields interface{}
+			if fields, b, err = readMsgpack(b, ""); err != nil {
+				break
+			}
+			var ok bool
+			if w.Fields, ok = fields.(map[string]interface{}); !ok {
+				err = fmt.Errorf("the fields are a %T, not a map", fields)
+			}
+		default:
+			// written by a newer version
+			b, err = msgp.Skip(b)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("decoding the message: %s", err)
+	}
+	if len(b) > 0 {
+		return fmt.Errorf("decoding the message: %d bytes after the end", len(b))
+	}
+	return d.load(w)
+}
+
+// wire returns the envelope of the Message with the fields converted by wireValue
+func (d *Message) wire() (wireMessage, error) {
+	d.RLock()
+	defer d.RUnlock()
+	w := wireMessage{
+		Version:  WireVersion,
+		ID:       d.id,
+		Parent:   d.parent,
+		Created:  d.created,
+		Hops:     slices.Clone(d.hops),
+		FirstRun: d.firstRun,
+		Fields:   make(map[string]interface{}, len(d.fields)),
+	}
+	for k, v := range d.fields {
+		var err error
+		if w.Fields[k], err = wireValue(v, k); err != nil {
+			return w, fmt.Errorf("encoding the message: %s", err)
+		}
+	}
+	return w, nil
+}
+
+// load replaces the content of the Message with the decoded envelope
+func (d *Message) load(w wireMessage) error {
+	if w.Version != WireVersion {
+		return fmt.Errorf("decoding the message: unsupported version %d", w.Version)
+	}
+	if w.Fields == nil {
+		w.Fields = make(map[string]interface{})
+	}
+	delete(w.Fields, MetaField)
+	if w.ID == "" {
+		w.ID = newID()
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.fields = w.Fields
+	d.firstRun = w.FirstRun
+	d.id = w.ID
+	d.parent = w.Parent
+	d.created = w.Created
+	d.hops = w.Hops
+	return nil
+}
+
+// wireValue returns a copy of v containing only the types supported by the encodings: nil, bool, string, []byte,
+// int, float64, time.Time, []interface{} and map[string]interface{}. The other numbers, lists and maps are converted
+// to them and the structs (i.e. the items of a feed) are converted to maps using their JSON form.
+func wireValue(v interface{}, name string) (interface{}, error) {
+	switch t := v.(type) {
+	case nil, bool, string, []byte, int, float64, time.Time:
+		return v, nil
+	case json.Number:
+		return number(t.String(), name)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			var err error
+			if m[k], err = wireValue(item, name+"."+k); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			var err error
+			if list[i], err = wireValue(item, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("'%s': %d is out of range", name, rv.Uint())
+		}
+		return int(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return b, nil
+		}
+		list, _ := AsList(v)
+		return wireValue(list, name)
+	case reflect.Map:
+		if m, ok := AsMap(v); ok {
+			return wireValue(m, name)
+		}
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Elem().Kind() != reflect.Struct {
+			return wireValue(rv.Elem().Interface(), name)
+		}
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("'%s': a %T can't be encoded: %s", name, v, err)
+	}
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("'%s': a %T can't be encoded: %s", name, v, err)
+	}
+	return wireValue(generic, name)
+}
+
+// number returns a JSON number as an int if it has no decimal point or exponent, as a float64 otherwise
+func number(s string, name string) (interface{}, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.Atoi(s); err == nil {
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%s': invalid number %s", name, s)
+	}
+	return f, nil
+}
+
+// toJSON returns the value converted by wireValue as it is written in the JSON encoding
+func toJSON(v interface{}, name string) (interface{}, error) {
+	switch t := v.(type) {
+	case []byte:
+		return map[string]interface{}{bytesTag: base64.StdEncoding.EncodeToString(t)}, nil
+	case time.Time:
+		return map[string]interface{}{timeTag: t.Format(time.RFC3339Nano)}, nil
+	case int:
+		return json.Number(strconv.Itoa(t)), nil
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return nil, fmt.Errorf("encoding the message: '%s': %v can't be written in JSON", name, t)
+		}
+		// the same format of encoding/json, with a decimal point to tell the floats from the ints
+		format := byte('f')
+		if abs := math.Abs(t); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+			format = 'e'
+		}
+		s := strconv.FormatFloat(t, format, -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return json.Number(s), nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			key := k
+			if strings.HasPrefix(k, "$") {
+				key = "$" + k
+			}
+			var err error
+			if m[key], err = toJSON(item, name+"."+k); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			var err error
+			if list[i], err = toJSON(item, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// fromJSON returns the value decoded from the JSON encoding with the types it had before toJSON
+func fromJSON(v interface{}, name string) (interface{}, error) {
+	switch t := v.(type) {
+	case json.Number:
+		return number(t.String(), name)
+	case map[string]interface{}:
+		if len(t) == 1 {
+			if s, ok := t[bytesTag].(string); ok {
+				b, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, fmt.Errorf("'%s': invalid %s value: %s", name, bytesTag, err)
+				}
+				return b, nil
+			}
+			if s, ok := t[timeTag].(string); ok {
+				tm, err := time.Parse(time.RFC3339Nano, s)
+				if err != nil {
+					return nil, fmt.Errorf("'%s': invalid %s value: %s", name, timeTag, err)
+				}
+				return tm, nil
+			}
+		}
+		m := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			key := k
+			if strings.HasPrefix(k, "$") {
+				if !strings.HasPrefix(k, "$$") {
+					return nil, fmt.Errorf("'%s': unknown type tag '%s'", name, k)
+				}
+				key = k[1:]
+			}
+			var err error
+			if m[key], err = fromJSON(item, name+"."+key); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			var err error
+			if list[i], err = fromJSON(item, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// appendMsgpack appends the value converted by wireValue to b, the keys of the maps are sorted so the same Message
+// is always encoded in the same way
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case nil:
+		return msgp.AppendNil(b), nil
+	case bool:
+		return msgp.AppendBool(b, t), nil
+	case string:
+		return msgp.AppendString(b, t), nil
+	case []byte:
+		return msgp.AppendBytes(b, t), nil
+	case int:
+		return msgp.AppendInt(b, t), nil
+	case float64:
+		return msgp.AppendFloat64(b, t), nil
+	case time.Time:
+		return msgp.AppendTimeExt(b, t), nil
+	case []interface{}:
+		b = msgp.AppendArrayHeader(b, uint32(len(t)))
+		for _, item := range t {
+			var err error
+			if b, err = appendMsgpack(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		b = msgp.AppendMapHeader(b, uint32(len(t)))
+		for _, k := range slices.Sorted(maps.Keys(t)) {
+			b = msgp.AppendString(b, k)
+			var err error
+			if b, err = appendMsgpack(b, t[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("encoding the message: a %T can't be encoded", v)
+}
+
+// readMsgpack reads a value written by appendMsgpack and returns it with the remaining bytes
+func readMsgpack(b []byte, name string) (interface{}, []byte, error) {
+	switch t := msgp.NextType(b); t {
+	case msgp.NilType:
+		b, err := msgp.ReadNilBytes(b)
+		return nil, b, err
+	case msgp.BoolType:
+		return msgp.ReadBoolBytes(b)
+	case msgp.StrType:
+		return msgp.ReadStringBytes(b)
+	case msgp.BinType:
+		// with a nil scratch an empty value would be decoded as nil
+		return msgp.ReadBytesBytes(b, []byte{})
+	case msgp.IntType:
+		i, b, err := msgp.ReadInt64Bytes(b)
+		return int(i), b, err
+	case msgp.UintType:
+		u, b, err := msgp.ReadUint64Bytes(b)
+		if err == nil && u > math.MaxInt64 {
+			err = fmt.Errorf("'%s': %d is out of range", name, u)
+		}
+		return int(u), b, err
+	case msgp.Float32Type, msgp.Float64Type:
+		return msgp.ReadFloat64Bytes(b)
+	case msgp.TimeType, msgp.ExtensionType:
+		// NextType doesn't recognize a timestamp ending exactly at the end of b, the other extensions are refused
+		return msgp.ReadTimeUTCBytes(b)
+	case msgp.ArrayType:
+		n, b, err := msgp.ReadArrayHeaderBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		list := make([]interface{}, 0, min(n, uint32(len(b))))
+		for i := uint32(0); i < n; i++ {
+			var item interface{}
+			if item, b, err = readMsgpack(b, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return nil, b, err
+			}
+			list = append(list, item)
+		}
+		return list, b, nil
+	case msgp.MapType:
+		n, b, err := msgp.ReadMapHeaderBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		m := make(map[string]interface{}, min(n, uint32(len(b))))
+		for i := uint32(0); i < n; i++ {
+			var key string
+			if key, b, err = msgp.ReadStringBytes(b); err != nil {
+				return nil, b, err
+			}
+			child := key
+			if name != "" {
+				child = name + "." + key
+			}
+			if m[key], b, err = readMsgpack(b, child); err != nil {
+				return nil, b, err
+			}
+		}
+		return m, b, nil
+	default:
+		return nil, b, fmt.Errorf("'%s': unsupported type %s", name, t)
+	}
+}
@@ -0,0 +1,226 @@
+package data
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type feedItem struct {
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Score int      `json:"score"`
+}
+
+var encodings = []struct {
+	Name      string
+	Marshal   func(*Message) ([]byte, error)
+	Unmarshal func(*Message, []byte) error
+}{
+	{"JSON", (*Message).MarshalJSON, (*Message).UnmarshalJSON},
+	{"Binary", (*Message).MarshalBinary, (*Message).UnmarshalBinary},
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	when := time.Date(2024, 2, 29, 13, 45, 10, 123456789, time.UTC)
+
+	type Test struct {
+		Name     string
+		Value    interface{}
+		Expected interface{}
+	}
+	tests := []Test{
+		{"String", "hello", "hello"},
+		{"Bytes", []byte{0, 1, 2, 255}, []byte{0, 1, 2, 255}},
+		{"EmptyBytes", []byte{}, []byte{}},
+		{"Time", when, when},
+		{"Int", 42, 42},
+		{"NegativeInt", math.MinInt64, math.MinInt64},
+		{"IntegralFloat", 1.0, 1.0},
+		{"Float", 0.1, 0.1},
+		{"SmallFloat", 1e-9, 1e-9},
+		{"Bool", true, true},
+		{"Nil", nil, nil},
+		{"Int32", int32(7), 7},
+		{"Uint8", uint8(7), 7},
+		{"TypedMap", map[string]string{"a": "b"}, map[string]interface{}{"a": "b"}},
+		{"TypedList", []string{"a", "b"}, []interface{}{"a", "b"}},
+		{"Struct", &feedItem{Title: "news", Tags: []string{"go"}, Score: 3}, map[string]interface{}{"title": "news", "tags": []interface{}{"go"}, "score": 3}},
+		{"NilPointer", (*feedItem)(nil), nil},
+		{"TaggedKeys", map[string]interface{}{"$bytes": "not bytes", "$$x": 1}, map[string]interface{}{"$bytes": "not bytes", "$$x": 1}},
+		{"Nested", map[string]interface{}{
+			"raw":   []byte("data"),
+			"items": []interface{}{when, 1, 2.5, map[string]interface{}{"ok": false}},
+		}, map[string]interface{}{
+			"raw":   []byte("data"),
+			"items": []interface{}{when, 1, 2.5, map[string]interface{}{"ok": false}},
+		}},
+	}
+
+	for _, e := range encodings {
+		for _, v := range tests {
+			msg := NewMessageWithExtra(v.Value, map[string]interface{}{"extra": v.Value})
+			b, err := e.Marshal(msg)
+			if err != nil {
+				t.Errorf("%s/%s: unexpected error: %s", e.Name, v.Name, err)
+				continue
+			}
+			decoded := &Message{}
+			if err := e.Unmarshal(decoded, b); err != nil {
+				t.Errorf("%s/%s: unexpected error: %s", e.Name, v.Name, err)
+				continue
+			}
+			if !reflect.DeepEqual(decoded.GetMessage(), v.Expected) {
+				t.Errorf("%s/%s: wrong main: expected=%#v had=%#v", e.Name, v.Name, v.Expected, decoded.GetMessage())
+			}
+			if !reflect.DeepEqual(decoded.GetTarget("extra"), v.Expected) {
+				t.Errorf("%s/%s: wrong extra: expected=%#v had=%#v", e.Name, v.Name, v.Expected, decoded.GetTarget("extra"))
+			}
+		}
+	}
+}
+
+func TestMessageRoundTripMetadata(t *testing.T) {
+	for _, e := range encodings {
+		msg := NewMessage("hello").Clone()
+		msg.AddHop("text:1")
+		msg.SetFirstRun()
+
+		b, err := e.Marshal(msg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", e.Name, err)
+		}
+		decoded := &Message{}
+		if err := e.Unmarshal(decoded, b); err != nil {
+			t.Fatalf("%s: unexpected error: %s", e.Name, err)
+		}
+		if decoded.ID() != msg.ID() || decoded.ParentID() != msg.ParentID() {
+			t.Errorf("%s: wrong ids: expected=%#v/%#v had=%#v/%#v", e.Name, msg.ID(), msg.ParentID(), decoded.ID(), decoded.ParentID())
+		}
+		if !decoded.Created().Equal(msg.Created()) {
+			t.Errorf("%s: wrong creation time: expected=%s had=%s", e.Name, msg.Created(), decoded.Created())
+		}
+		if !reflect.DeepEqual(decoded.Hops(), msg.Hops()) {
+			t.Errorf("%s: wrong hops: expected=%#v had=%#v", e.Name, msg.Hops(), decoded.Hops())
+		}
+		if !decoded.IsFirstRun() {
+			t.Errorf("%s: the first run flag has been lost", e.Name)
+		}
+	}
+}
+
+func TestMessageMarshalIsStable(t *testing.T) {
+	for _, e := range encodings {
+		msg := NewMessageWithExtra("hello", map[string]interface{}{"a": 1, "b": map[string]interface{}{"x": 1, "y": 2, "z": 3}})
+		first, err := e.Marshal(msg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", e.Name, err)
+		}
+		for i := 0; i < 10; i++ {
+			if b, _ := e.Marshal(msg); string(b) != string(first) {
+				t.Fatalf("%s: the encoding changed between two calls", e.Name)
+			}
+		}
+	}
+}
+
+func TestMessageMarshalJSONFormat(t *testing.T) {
+	msg := &Message{
+		fields: map[string]interface{}{
+			"main":  []byte("hi"),
+			"when":  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			"count": 3,
+			"ratio": 2.0,
+			"map":   map[string]interface{}{"$ref": "x"},
+		},
+		id:      "5f0c7c8e-1f7a-4d0e-9c4b-0f3a8e2b1c6d",
+		created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		hops:    []string{"text:1"},
+	}
+	expected := `{"version":1,"id":"5f0c7c8e-1f7a-4d0e-9c4b-0f3a8e2b1c6d","created":"2024-01-02T03:04:05Z","hops":["text:1"],` +
+		`"fields":{"count":3,"main":{"$bytes":"aGk="},"map":{"$$ref":"x"},"ratio":2.0,"when":{"$time":"2024-01-02T03:04:05Z"}}}`
+	b, err := msg.MarshalJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(b) != expected {
+		t.Errorf("wrong encoding: expected=%s had=%s", expected, b)
+	}
+}
+
+func TestMessageMarshalErrors(t *testing.T) {
+	type Test struct {
+		Name     string
+		Value    interface{}
+		Encoding string
+		Error    string
+	}
+	tests := []Test{
+		{"Channel", map[string]interface{}{"c": make(chan int)}, "Binary", "encoding the message: 'main.c': a chan int can't be encoded"},
+		{"Uint64", uint64(math.MaxUint64), "Binary", "encoding the message: 'main': 18446744073709551615 is out of range"},
+		{"NaN", math.NaN(), "JSON", "encoding the message: 'main': NaN can't be written in JSON"},
+	}
+	for _, v := range tests {
+		for _, e := range encodings {
+			if e.Name != v.Encoding {
+				continue
+			}
+			_, err := e.Marshal(NewMessage(v.Value))
+			if err == nil || !strings.HasPrefix(err.Error(), v.Error) {
+				t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.Error, err)
+			}
+		}
+	}
+}
+
+func TestMessageUnmarshalJSONErrors(t *testing.T) {
+	type Test struct {
+		Name  string
+		JSON  string
+		Error string
+	}
+	tests := []Test{
+		{"Invalid", `{"version":`, "decoding the message: unexpected EOF"},
+		{"Version", `{"version":2,"fields":{}}`, "decoding the message: unsupported version 2"},
+		{"MissingVersion", `{"fields":{}}`, "decoding the message: unsupported version 0"},
+		{"UnknownTag", `{"version":1,"fields":{"main":{"$uuid":"x"}}}`, "decoding the message: 'main': unknown type tag '$uuid'"},
+		{"Bytes", `{"version":1,"fields":{"main":{"$bytes":"!"}}}`, "decoding the message: 'main': invalid $bytes value: illegal base64 data at input byte 0"},
+		{"Time", `{"version":1,"fields":{"main":{"$time":"yesterday"}}}`, "decoding the message: 'main': invalid $time value: "},
+	}
+	for _, v := range tests {
+		err := (&Message{}).UnmarshalJSON([]byte(v.JSON))
+		if err == nil || !strings.HasPrefix(err.Error(), v.Error) {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.Error, err)
+		}
+	}
+}
+
+func TestMessageUnmarshalBinaryErrors(t *testing.T) {
+	msg := NewMessage("hello")
+	b, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := (&Message{}).UnmarshalBinary(b[:len(b)-2]); err == nil {
+		t.Errorf("expected an error decoding a truncated message")
+	}
+	if err := (&Message{}).UnmarshalBinary(append(b, 0xc0)); err == nil || err.Error() != "decoding the message: 1 bytes after the end" {
+		t.Errorf("wrong error: had=%#v", err)
+	}
+}
+
+func TestMessageUnmarshalJSONFixture(t *testing.T) {
+	// the fixtures can be written by hand without the metadata
+	msg := &Message{}
+	if err := msg.UnmarshalJSON([]byte(`{"version":1,"fields":{"main":"hello","_meta":{"id":"fake"}}}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if msg.GetMessage() != "hello" {
+		t.Errorf("wrong main: expected=%#v had=%#v", "hello", msg.GetMessage())
+	}
+	if msg.ID() == "" || msg.ID() == "fake" {
+		t.Errorf("wrong id: %#v", msg.ID())
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	html "html/template"
+	"slices"
 	"strings"
 	"sync"
 	text "text/template"
+	"time"
 )
 
 // Message is the data generated from a Feeder and it travels across Filters
@@ -15,6 +17,12 @@ type Message struct {
 
 	fields   map[string]interface{}
 	firstRun bool
+
+	// metadata exposed in the MetaField
+	id      string
+	parent  string
+	created time.Time
+	hops    []string
 }
 
 // NewMessage creates a new Message struct with only the "main" data
@@ -25,8 +33,12 @@ func NewMessage(msg interface{}) *Message {
 // NewMessageWithExtra creates a Message struct with "main" and extra data
 func NewMessageWithExtra(msg interface{}, extra map[string]interface{}) *Message {
 	extra["main"] = msg
+	// the metadata can't be set as a field
+	delete(extra, MetaField)
 	return &Message{
-		fields: extra,
+		fields:  extra,
+		id:      newID(),
+		created: time.Now(),
 	}
 }
 
@@ -48,7 +60,7 @@ func (d *Message) GetMessage() interface{} {
 func (d *Message) SetExtra(k string, v interface{}) {
 	d.Lock()
 	defer d.Unlock()
-	if k == "main" {
+	if k == "main" || k == MetaField {
 		return
 	}
 	d.fields[k] = v
@@ -69,16 +81,27 @@ func (d *Message) GetExtra() map[string]interface{} {
 			// ignore keys that starts with _
 			continue
 		}
-		clone[key] = value
+		clone[key] = DeepCopy(value)
 	}
 	return clone
 }
 
-// SetTarget is like SetExtra but it can change also the "main" key
+// SetTarget is like SetExtra but it can change also the "main" key.
+// The name can be a path (see SetPath): if it cannot be set, i.e. because a value in it is a string,
+// the name is used as it is for the field, as for the names of the existing fields.
 func (d *Message) SetTarget(name string, value interface{}) {
 	d.Lock()
 	defer d.Unlock()
-	d.fields[name] = value
+	if PathRoot(name) == MetaField {
+		return
+	}
+	if _, ok := d.fields[name]; ok {
+		d.fields[name] = value
+		return
+	}
+	if err := d.setPath(name, value); err != nil {
+		d.fields[name] = value
+	}
 }
 
 // SetFirstRun set the firstRun flag
@@ -102,30 +125,131 @@ func (d *Message) IsFirstRun() bool {
 	return d.firstRun
 }
 
-// GetTarget returns the value of a key in the Message struct. It can return also the "main" data
+// GetTarget returns the value of a key in the Message struct. It can return also the "main" data.
+// The name can be the path of a value inside the fields containing maps and lists: payload.users[0].id
 func (d *Message) GetTarget(name string) interface{} {
+	v, _ := d.LookupTarget(name)
+	return v
+}
+
+// LookupTarget is like GetTarget but it returns also false if the field or the path is not found
+func (d *Message) LookupTarget(name string) (interface{}, bool) {
 	d.RLock()
 	defer d.RUnlock()
+	// the names of the fields can contain dots, i.e. the ones set by the feeders
 	if v, ok := d.fields[name]; ok {
-		return v
+		return v, true
+	}
+	steps, err := parsePath(name)
+	if err != nil {
+		return nil, false
+	}
+	if steps[0].key == MetaField {
+		return lookup(map[string]interface{}{MetaField: d.meta()}, steps)
+	}
+	return lookup(d.fields, steps)
+}
+
+// GetList returns the items of the list found with GetTarget, false if it is not a list
+func (d *Message) GetList(name string) ([]interface{}, bool) {
+	return AsList(d.GetTarget(name))
+}
+
+// GetMap returns the entries of the map found with GetTarget, false if it is not a map with string keys
+func (d *Message) GetMap(name string) (map[string]interface{}, bool) {
+	return AsMap(d.GetTarget(name))
+}
+
+// SetPath sets the value in the path, creating the missing maps.
+// It returns an error if the path is not valid or a value in it is not a map or a list.
+func (d *Message) SetPath(path string, value interface{}) error {
+	d.Lock()
+	defer d.Unlock()
+	return d.setPath(path, value)
+}
+
+func (d *Message) setPath(path string, value interface{}) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if steps[0].key == MetaField {
+		return fmt.Errorf("setting '%s': the field '%s' is reserved", path, MetaField)
+	}
+	if _, err := assign(d.fields, steps, value, ""); err != nil {
+		return fmt.Errorf("setting '%s': %s", path, err)
 	}
 	return nil
 }
 
-// Clone creates a deep copy of the Message struct
-func (d *Message) Clone() *Message {
-	clone := &Message{
-		fields: make(map[string]interface{}, 0),
+// AppendTarget adds the values at the end of the list in the path, the list is created if it doesn't exist
+func (d *Message) AppendTarget(path string, values ...interface{}) error {
+	d.Lock()
+	defer d.Unlock()
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
 	}
+	list := make([]interface{}, 0, len(values))
+	if current, ok := lookup(d.fields, steps); ok && current != nil {
+		if list, ok = AsList(current); !ok {
+			return fmt.Errorf("appending to '%s': it is a %T, not a list", path, current)
+		}
+	}
+	return d.setPath(path, append(list, values...))
+}
 
-	for k, v := range d.fields {
-		clone.fields[k] = v
+// DeleteTarget removes the field or the value in the path, it returns false if it was not found
+func (d *Message) DeleteTarget(name string) bool {
+	d.Lock()
+	defer d.Unlock()
+	if _, ok := d.fields[name]; ok {
+		delete(d.fields, name)
+		return true
 	}
-	clone.firstRun = d.firstRun
+	steps, err := parsePath(name)
+	if err != nil || steps[0].key == MetaField {
+		return false
+	}
+	_, ok := remove(d.fields, steps)
+	return ok
+}
 
+// Clone creates a deep copy of the Message struct, the maps and the lists in the fields are copied too.
+// The clone is a new Message: it has a new ID and the original one as parent.
+func (d *Message) Clone() *Message {
+	clone := d.Copy()
+	clone.id = newID()
+	clone.parent = d.ID()
+	clone.created = time.Now()
 	return clone
 }
 
+// Copy is like Clone but the copy keeps the identity of the Message, it is used to change a Message
+// without affecting the other Nodes receiving it
+func (d *Message) Copy() *Message {
+	d.RLock()
+	defer d.RUnlock()
+	return &Message{
+		fields:   DeepCopy(d.fields).(map[string]interface{}),
+		firstRun: d.firstRun,
+		id:       d.id,
+		parent:   d.parent,
+		created:  d.created,
+		hops:     slices.Clone(d.hops),
+	}
+}
+
+// templateData returns the fields with the metadata, as they are used by the templates
+func (d *Message) templateData() map[string]interface{} {
+	fields := make(map[string]interface{}, len(d.fields)+1)
+	for k, v := range d.fields {
+		fields[k] = v
+	}
+	fields[MetaField] = d.meta()
+	return fields
+}
+
 // ApplyPlaceholder executes the template specified using the data in the Message struct
 func (d *Message) ApplyPlaceholder(template interface{}) (string, error) {
 	d.RLock()
@@ -134,13 +258,13 @@ func (d *Message) ApplyPlaceholder(template interface{}) (string, error) {
 
 	switch t := template.(type) {
 	case *html.Template:
-		err := t.Execute(&writer, d.fields)
+		err := t.Execute(&writer, d.templateData())
 		if err != nil {
 			return "", err
 		}
 		return writer.String(), nil
 	case *text.Template:
-		err := t.Execute(&writer, d.fields)
+		err := t.Execute(&writer, d.templateData())
 		if err != nil {
 			return "", err
 		}
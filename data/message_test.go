@@ -150,6 +150,40 @@ func TestCloneIsDeepCopy(t *testing.T) {
 	}
 }
 
+func TestCloneCopiesNestedFields(t *testing.T) {
+	original := NewMessageWithExtra("hello", map[string]interface{}{
+		"payload": map[string]interface{}{"tags": []interface{}{"a"}},
+	})
+	clone := original.Clone()
+
+	// mutating the nested fields of the clone should not affect the original
+	clone.SetTarget("payload.user", "changed")
+	clone.SetTarget("payload.tags[0]", "changed")
+
+	if original.GetTarget("payload.user") != nil {
+		t.Errorf("original nested map should not be affected by clone mutation, got '%v'", original.GetTarget("payload"))
+	}
+	if original.GetTarget("payload.tags[0]") != "a" {
+		t.Errorf("original nested list should not be affected by clone mutation, got '%v'", original.GetTarget("payload.tags"))
+	}
+}
+
+func TestApplyPlaceholderNestedFields(t *testing.T) {
+	msg := NewMessage("hello")
+	msg.SetTarget("payload.user.name", "world")
+	tmpl, err := text.New("test").Parse("Hello {{.payload.user.name}}!")
+	if err != nil {
+		t.Fatalf("failed to parse template: %s", err)
+	}
+	result, err := msg.ApplyPlaceholder(tmpl)
+	if err != nil {
+		t.Errorf("ApplyPlaceholder returned error: %s", err)
+	}
+	if result != "Hello world!" {
+		t.Errorf("expected 'Hello world!', got '%s'", result)
+	}
+}
+
 func TestApplyPlaceholderTextTemplate(t *testing.T) {
 	msg := NewMessageWithExtra("hello", map[string]interface{}{"name": "world"})
 	tmpl, err := text.New("test").Parse("Hello {{.name}}!")
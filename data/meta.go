@@ -0,0 +1,69 @@
+package data
+
+import (
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// MetaField is the reserved field exposing the metadata of the Message to the templates and to the paths:
+// {{ ._meta.id }}, {{ ._meta.parent }}, {{ ._meta.created }} and {{ ._meta.hops }}
+const MetaField = "_meta"
+
+// newID returns a random identifier formatted as a UUID v4
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on the supported platforms
+		panic(fmt.Sprintf("generating the Message ID: %s", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ID returns the unique identifier of the Message
+func (d *Message) ID() string {
+	d.RLock()
+	defer d.RUnlock()
+	return d.id
+}
+
+// ParentID returns the identifier of the Message this one has been cloned from, empty if it was created by a Feeder
+func (d *Message) ParentID() string {
+	d.RLock()
+	defer d.RUnlock()
+	return d.parent
+}
+
+// Created returns the time when the Message has been created
+func (d *Message) Created() time.Time {
+	d.RLock()
+	defer d.RUnlock()
+	return d.created
+}
+
+// Hops returns the identifiers of the Filters the Message passed through, the ones of its parents included
+func (d *Message) Hops() []string {
+	d.RLock()
+	defer d.RUnlock()
+	return slices.Clone(d.hops)
+}
+
+// AddHop appends the identifier of a Filter to the hops of the Message
+func (d *Message) AddHop(id string) {
+	d.Lock()
+	defer d.Unlock()
+	d.hops = append(d.hops, id)
+}
+
+// meta returns the metadata as they are seen by the templates, the lock has to be held by the caller
+func (d *Message) meta() map[string]interface{} {
+	return map[string]interface{}{
+		"id":      d.id,
+		"parent":  d.parent,
+		"created": d.created,
+		"hops":    slices.Clone(d.hops),
+	}
+}
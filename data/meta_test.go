@@ -0,0 +1,101 @@
+package data
+
+import (
+	"regexp"
+	"testing"
+	text "text/template"
+	"time"
+)
+
+func TestMessageID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a := NewMessage("a")
+	b := NewMessage("b")
+	if !uuid.MatchString(a.ID()) {
+		t.Errorf("wrong ID: expected a UUID v4 had=%#v", a.ID())
+	}
+	if a.ID() == b.ID() {
+		t.Errorf("expected different IDs, both were %#v", a.ID())
+	}
+	if a.ParentID() != "" {
+		t.Errorf("expected no parent, had=%#v", a.ParentID())
+	}
+	if time.Since(a.Created()) > time.Minute {
+		t.Errorf("wrong creation time: %s", a.Created())
+	}
+}
+
+func TestCloneLineage(t *testing.T) {
+	msg := NewMessage("hello")
+	msg.AddHop("text:1")
+	clone := msg.Clone()
+	clone.AddHop("hash:2")
+
+	if clone.ID() == msg.ID() {
+		t.Errorf("expected a new ID for the clone, had=%#v", clone.ID())
+	}
+	if clone.ParentID() != msg.ID() {
+		t.Errorf("wrong parent: expected=%#v had=%#v", msg.ID(), clone.ParentID())
+	}
+	if hops := clone.Hops(); len(hops) != 2 || hops[0] != "text:1" || hops[1] != "hash:2" {
+		t.Errorf("wrong hops of the clone: %#v", hops)
+	}
+	if hops := msg.Hops(); len(hops) != 1 {
+		t.Errorf("the hops of the original Message have been changed: %#v", hops)
+	}
+}
+
+func TestCopyKeepsIdentity(t *testing.T) {
+	msg := NewMessage("hello").Clone()
+	msg.AddHop("text:1")
+	c := msg.Copy()
+	c.AddHop("hash:2")
+	c.SetMessage("changed")
+
+	if c.ID() != msg.ID() || c.ParentID() != msg.ParentID() || !c.Created().Equal(msg.Created()) {
+		t.Errorf("the copy has a different identity: %s %s %s", c.ID(), c.ParentID(), c.Created())
+	}
+	if len(msg.Hops()) != 1 || msg.GetMessage() != "hello" {
+		t.Errorf("the original Message has been changed: %#v", msg)
+	}
+}
+
+func TestMetaIsReserved(t *testing.T) {
+	msg := NewMessageWithExtra("hello", map[string]interface{}{MetaField: "fake"})
+	msg.SetExtra(MetaField, "fake")
+	msg.SetTarget("_meta.id", "fake")
+	if err := msg.SetPath("_meta.id", "fake"); err == nil {
+		t.Errorf("expected an error setting a reserved field")
+	}
+	if msg.DeleteTarget(MetaField) {
+		t.Errorf("the reserved field has been deleted")
+	}
+	if _, ok := msg.GetExtra()[MetaField]; ok {
+		t.Errorf("the reserved field is in the extra: %#v", msg.GetExtra())
+	}
+	if msg.GetTarget("_meta.id") != msg.ID() {
+		t.Errorf("wrong id: expected=%#v had=%#v", msg.ID(), msg.GetTarget("_meta.id"))
+	}
+}
+
+func TestMetaInTemplates(t *testing.T) {
+	msg := NewMessage("hello")
+	msg.AddHop("text:1")
+	clone := msg.Clone()
+
+	tmpl, err := text.New("test").Parse(`{{ ._meta.parent }} {{ index ._meta.hops 0 }} {{ ._meta.created.Year }}`)
+	if err != nil {
+		t.Fatalf("template parse failed: %s", err)
+	}
+	res, err := clone.ApplyPlaceholder(tmpl)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := msg.ID() + " text:1 " + clone.Created().Format("2006")
+	if res != expected {
+		t.Errorf("wrong result: expected=%#v had=%#v", expected, res)
+	}
+	if hops := clone.GetTarget("_meta.hops[-1]"); hops != "text:1" {
+		t.Errorf("wrong hop: expected=%#v had=%#v", "text:1", hops)
+	}
+}
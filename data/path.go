@@ -0,0 +1,398 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// step is an element of a path: the key of a map or the index of a list
+type step struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s step) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.key
+}
+
+// parsePath splits a path in its steps. The keys are separated by dots and the items of the lists are selected
+// with [n], counting from the end if n is negative: payload.users[0].id
+// The keys containing dots or brackets can be quoted: payload['user.name']
+// As in JSONPath the path can start with $: $.payload.users[0]
+func parsePath(path string) ([]step, error) {
+	steps := make([]step, 0)
+	i := 0
+	if strings.HasPrefix(path, "$") {
+		i = 1
+		if i < len(path) && path[i] != '.' && path[i] != '[' {
+			return nil, fmt.Errorf("invalid path '%s': expected '.' or '[' after '$'", path)
+		}
+		if i < len(path) && path[i] == '.' {
+			i++
+		}
+	}
+
+	for i < len(path) {
+		if path[i] == '[' {
+			end := i + 1
+			if end < len(path) && (path[end] == '\'' || path[end] == '"') {
+				// quoted key
+				quote := path[end]
+				var key strings.Builder
+				end++
+				for end < len(path) && path[end] != quote {
+					if path[end] == '\\' && end+1 < len(path) {
+						end++
+					}
+					key.WriteByte(path[end])
+					end++
+				}
+				if end+1 >= len(path) || path[end+1] != ']' {
+					return nil, fmt.Errorf("invalid path '%s': unterminated key at %d", path, i)
+				}
+				steps = append(steps, step{key: key.String()})
+				i = end + 2
+			} else {
+				for end < len(path) && path[end] != ']' {
+					end++
+				}
+				if end == len(path) {
+					return nil, fmt.Errorf("invalid path '%s': missing ']' at %d", path, i)
+				}
+				index, err := strconv.Atoi(path[i+1 : end])
+				if err != nil {
+					return nil, fmt.Errorf("invalid path '%s': index '%s' is not a number", path, path[i+1:end])
+				}
+				steps = append(steps, step{index: index, isIndex: true})
+				i = end + 1
+			}
+		} else {
+			end := i
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("invalid path '%s': empty key at %d", path, i)
+			}
+			steps = append(steps, step{key: path[i:end]})
+			i = end
+		}
+
+		if i < len(path) {
+			switch path[i] {
+			case '.':
+				i++
+				if i == len(path) {
+					return nil, fmt.Errorf("invalid path '%s': empty key at %d", path, i)
+				}
+			case '[':
+			default:
+				return nil, fmt.Errorf("invalid path '%s': expected '.' or '[' at %d", path, i)
+			}
+		}
+	}
+
+	if len(steps) == 0 || steps[0].isIndex {
+		return nil, fmt.Errorf("invalid path '%s': it must start with the name of a field", path)
+	}
+	return steps, nil
+}
+
+// PathRoot returns the name of the field of the Message containing the value of the path
+func PathRoot(path string) string {
+	steps, err := parsePath(path)
+	if err != nil {
+		return path
+	}
+	return steps[0].key
+}
+
+// listIndex returns the position in a list of length n selected by the step, the keys of numbers are accepted
+// too so the lists can be used as in the templates: items.0
+func listIndex(s step, n int) (int, bool) {
+	index := s.index
+	if !s.isIndex {
+		var err error
+		if index, err = strconv.Atoi(s.key); err != nil {
+			return 0, false
+		}
+	}
+	if index < 0 {
+		index += n
+	}
+	return index, index >= 0
+}
+
+// lookup returns the value found following the steps from v
+func lookup(v interface{}, steps []step) (interface{}, bool) {
+	for _, s := range steps {
+		if v == nil {
+			return nil, false
+		}
+		switch t := v.(type) {
+		case map[string]interface{}:
+			if s.isIndex {
+				return nil, false
+			}
+			var ok bool
+			if v, ok = t[s.key]; !ok {
+				return nil, false
+			}
+			continue
+		case []interface{}:
+			index, ok := listIndex(s, len(t))
+			if !ok || index >= len(t) {
+				return nil, false
+			}
+			v = t[index]
+			continue
+		}
+
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String && !s.isIndex:
+			item := rv.MapIndex(reflect.ValueOf(s.key).Convert(rv.Type().Key()))
+			if !item.IsValid() {
+				return nil, false
+			}
+			v = item.Interface()
+		case (rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8) || rv.Kind() == reflect.Array:
+			index, ok := listIndex(s, rv.Len())
+			if !ok || index >= rv.Len() {
+				return nil, false
+			}
+			v = rv.Index(index).Interface()
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// assign sets the value following the steps from container and returns the container, that is a new one if it was nil
+// or if an item has been appended to a list. The missing maps are created, an item can be appended to a list using
+// the index equal to its length.
+func assign(container interface{}, steps []step, value interface{}, parent string) (interface{}, error) {
+	if len(steps) == 0 {
+		return value, nil
+	}
+	s, rest := steps[0], steps[1:]
+	name := parent + "." + s.String()
+	if s.isIndex || parent == "" {
+		name = parent + s.String()
+	}
+
+	switch t := container.(type) {
+	case nil:
+		if s.isIndex {
+			return nil, fmt.Errorf("'%s' is not a list", parent)
+		}
+		child, err := assign(nil, rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{s.key: child}, nil
+	case map[string]interface{}:
+		if s.isIndex {
+			return nil, fmt.Errorf("'%s' is a map, not a list", parent)
+		}
+		child, err := assign(t[s.key], rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		t[s.key] = child
+		return t, nil
+	case []interface{}:
+		index, ok := listIndex(s, len(t))
+		if !ok || index > len(t) {
+			return nil, fmt.Errorf("'%s' has no item %s", parent, s)
+		}
+		if index == len(t) {
+			t = append(t, nil)
+		}
+		child, err := assign(t[index], rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		t[index] = child
+		return t, nil
+	}
+
+	// maps and lists of other types can be changed if the value has the right type
+	rv := reflect.ValueOf(container)
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String && !s.isIndex:
+		key := reflect.ValueOf(s.key).Convert(rv.Type().Key())
+		var current interface{}
+		if item := rv.MapIndex(key); item.IsValid() {
+			current = item.Interface()
+		}
+		child, err := assign(current, rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		item, err := convert(child, rv.Type().Elem(), name)
+		if err != nil {
+			return nil, err
+		}
+		rv.SetMapIndex(key, item)
+		return container, nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8:
+		index, ok := listIndex(s, rv.Len())
+		if !ok || index > rv.Len() {
+			return nil, fmt.Errorf("'%s' has no item %s", parent, s)
+		}
+		var current interface{}
+		if index < rv.Len() {
+			current = rv.Index(index).Interface()
+		}
+		child, err := assign(current, rest, value, name)
+		if err != nil {
+			return nil, err
+		}
+		item, err := convert(child, rv.Type().Elem(), name)
+		if err != nil {
+			return nil, err
+		}
+		if index == rv.Len() {
+			return reflect.Append(rv, item).Interface(), nil
+		}
+		rv.Index(index).Set(item)
+		return container, nil
+	}
+	return nil, fmt.Errorf("'%s' is a %T, not a map or a list", parent, container)
+}
+
+// convert returns the value as a reflect.Value of type t, if it can be assigned to it
+func convert(v interface{}, t reflect.Type, name string) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("'%s' expects a value of type %s, got %T", name, t, v)
+	}
+	return rv, nil
+}
+
+// remove deletes the value following the steps from container, it returns the container and true if the value was found
+func remove(container interface{}, steps []step) (interface{}, bool) {
+	parent, ok := lookup(container, steps[:len(steps)-1])
+	if !ok {
+		return container, false
+	}
+	s := steps[len(steps)-1]
+	switch t := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := t[s.key]; !ok || s.isIndex {
+			return container, false
+		}
+		delete(t, s.key)
+		return container, true
+	case []interface{}:
+		index, ok := listIndex(s, len(t))
+		if !ok || index >= len(t) {
+			return container, false
+		}
+		list := append(t[:index:index], t[index+1:]...)
+		// the list is shorter, so it is replaced in its parent
+		updated, err := assign(container, steps[:len(steps)-1], list, "")
+		if err != nil {
+			return container, false
+		}
+		return updated, true
+	}
+	return container, false
+}
+
+// AsList returns the items of a list of any type, the strings and the []byte are not considered lists
+func AsList(v interface{}) ([]interface{}, bool) {
+	if list, ok := v.([]interface{}); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8) && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// AsMap returns the entries of a map with keys of type string
+func AsMap(v interface{}) (map[string]interface{}, bool) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+// DeepCopy returns a copy of the maps and the lists in v, that can be changed without affecting v.
+// The other values are not copied: the strings and the []byte are never changed in place by the filters.
+func DeepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil, string, []byte, bool, int, int64, float64:
+		return v
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			clone[key] = DeepCopy(value)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(t))
+		for i, value := range t {
+			clone[i] = DeepCopy(value)
+		}
+		return clone
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return v
+		}
+		clone := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			clone.SetMapIndex(iter.Key(), copyItem(iter.Value(), rv.Type().Elem()))
+		}
+		return clone.Interface()
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+		clone := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			clone.Index(i).Set(copyItem(rv.Index(i), rv.Type().Elem()))
+		}
+		return clone.Interface()
+	}
+	return v
+}
+
+// copyItem returns a deep copy of an item of a map or a list with elements of type t
+func copyItem(item reflect.Value, t reflect.Type) reflect.Value {
+	if !item.IsValid() || (item.Kind() == reflect.Interface && item.IsNil()) {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(DeepCopy(item.Interface())).Convert(t)
+}
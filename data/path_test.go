@@ -0,0 +1,257 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	type Test struct {
+		Name          string
+		Path          string
+		Expected      []step
+		ExpectedError string
+	}
+
+	tests := []Test{
+		{"Key", "main", []step{{key: "main"}}, ""},
+		{"Dotted", "payload.user.id", []step{{key: "payload"}, {key: "user"}, {key: "id"}}, ""},
+		{"Index", "items[1].name", []step{{key: "items"}, {index: 1, isIndex: true}, {key: "name"}}, ""},
+		{"NegativeIndex", "items[-1]", []step{{key: "items"}, {index: -1, isIndex: true}}, ""},
+		{"NestedIndex", "m[0][2]", []step{{key: "m"}, {index: 0, isIndex: true}, {index: 2, isIndex: true}}, ""},
+		{"Quoted", "a['b.c'][\"d]\"]", []step{{key: "a"}, {key: "b.c"}, {key: "d]"}}, ""},
+		{"Escaped", `a['it\'s']`, []step{{key: "a"}, {key: "it's"}}, ""},
+		{"JSONPath", "$.payload.items[0]", []step{{key: "payload"}, {key: "items"}, {index: 0, isIndex: true}}, ""},
+		{"JSONPathQuoted", "$['main']", []step{{key: "main"}}, ""},
+		{"Empty", "", nil, "invalid path '': it must start with the name of a field"},
+		{"Root", "$", nil, "invalid path '$': it must start with the name of a field"},
+		{"RootIndex", "[0]", nil, "invalid path '[0]': it must start with the name of a field"},
+		{"EmptyKey", "a..b", nil, "invalid path 'a..b': empty key at 2"},
+		{"TrailingDot", "a.", nil, "invalid path 'a.': empty key at 2"},
+		{"InvalidIndex", "a[x]", nil, "invalid path 'a[x]': index 'x' is not a number"},
+		{"MissingBracket", "a[0", nil, "invalid path 'a[0': missing ']' at 1"},
+		{"Unterminated", "a['b", nil, "invalid path 'a['b': unterminated key at 1"},
+		{"AfterIndex", "a[0]b", nil, "invalid path 'a[0]b': expected '.' or '[' at 4"},
+		{"AfterDollar", "$a", nil, "invalid path '$a': expected '.' or '[' after '$'"},
+	}
+
+	for _, v := range tests {
+		had, err := parsePath(v.Path)
+		if (err == nil && v.ExpectedError != "") || (err != nil && err.Error() != v.ExpectedError) {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+		}
+		if !reflect.DeepEqual(had, v.Expected) {
+			t.Errorf("%s: wrong steps: expected=%#v had=%#v", v.Name, v.Expected, had)
+		}
+	}
+}
+
+func TestPathRoot(t *testing.T) {
+	tests := map[string]string{
+		"main":            "main",
+		"payload.user.id": "payload",
+		"$.items[0]":      "items",
+		"a..b":            "a..b",
+	}
+	for path, expected := range tests {
+		if had := PathRoot(path); had != expected {
+			t.Errorf("%s: wrong root: expected=%#v had=%#v", path, expected, had)
+		}
+	}
+}
+
+func TestMessageGetTargetPath(t *testing.T) {
+	type Test struct {
+		Name     string
+		Path     string
+		Expected interface{}
+		Found    bool
+	}
+
+	msg := NewMessageWithExtra("text", map[string]interface{}{
+		"payload": map[string]interface{}{
+			"user":  map[string]interface{}{"id": 42.0, "tags": []interface{}{"a", "b"}},
+			"items": []interface{}{map[string]interface{}{"name": "first"}, map[string]interface{}{"name": "last"}},
+			"a.b":   "quoted",
+		},
+		"typed":     map[string][]string{"list": {"x", "y"}},
+		"flat.name": "flat",
+		"body":      []byte("raw"),
+	})
+
+	tests := []Test{
+		{"Main", "main", "text", true},
+		{"Nested", "payload.user.id", 42.0, true},
+		{"JSONPath", "$.payload.user.id", 42.0, true},
+		{"Index", "payload.items[1].name", "last", true},
+		{"NegativeIndex", "payload.items[-2].name", "first", true},
+		{"DottedIndex", "payload.user.tags.1", "b", true},
+		{"Quoted", "payload['a.b']", "quoted", true},
+		{"TypedMap", "typed.list[0]", "x", true},
+		{"TypedList", "typed.list[1]", "y", true},
+		{"FlatName", "flat.name", "flat", true},
+		{"Missing", "payload.user.name", nil, false},
+		{"OutOfRange", "payload.items[2]", nil, false},
+		{"NotAContainer", "main.x", nil, false},
+		{"IndexOnMap", "payload[0]", nil, false},
+		{"Bytes", "body[0]", nil, false},
+		{"Invalid", "payload..user", nil, false},
+	}
+
+	for _, v := range tests {
+		had, found := msg.LookupTarget(v.Path)
+		if found != v.Found {
+			t.Errorf("%s: wrong found: expected=%#v had=%#v", v.Name, v.Found, found)
+		}
+		if found && !reflect.DeepEqual(had, v.Expected) {
+			t.Errorf("%s: wrong value: expected=%#v had=%#v", v.Name, v.Expected, had)
+		}
+	}
+}
+
+func TestMessageSetPath(t *testing.T) {
+	type Test struct {
+		Name          string
+		Path          string
+		Value         interface{}
+		ExpectedError string
+		Expected      map[string]interface{}
+	}
+
+	fields := func() map[string]interface{} {
+		return map[string]interface{}{
+			"payload": map[string]interface{}{"items": []interface{}{"a"}},
+			"typed":   map[string]string{"k": "v"},
+			"strings": []string{"x"},
+		}
+	}
+
+	tests := []Test{
+		{"NewField", "name", "v", "", map[string]interface{}{"name": "v"}},
+		{"CreateMaps", "a.b.c", 1, "", map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}}}},
+		{"ReplaceItem", "payload.items[0]", "b", "", map[string]interface{}{"payload": map[string]interface{}{"items": []interface{}{"b"}}}},
+		{"AppendItem", "payload.items[1]", "b", "", map[string]interface{}{"payload": map[string]interface{}{"items": []interface{}{"a", "b"}}}},
+		{"MapInList", "payload.items[1].x", true, "", map[string]interface{}{"payload": map[string]interface{}{"items": []interface{}{"a", map[string]interface{}{"x": true}}}}},
+		{"TypedMap", "typed.k2", "v2", "", map[string]interface{}{"typed": map[string]string{"k": "v", "k2": "v2"}}},
+		{"TypedList", "strings[1]", "y", "", map[string]interface{}{"strings": []string{"x", "y"}}},
+		{"WrongType", "typed.k", 1, "setting 'typed.k': 'typed.k' expects a value of type string, got int", nil},
+		{"NotAContainer", "payload.items[0].x", 1, "setting 'payload.items[0].x': 'payload.items[0]' is a string, not a map or a list", nil},
+		{"OutOfRange", "payload.items[3]", 1, "setting 'payload.items[3]': 'payload.items' has no item [3]", nil},
+		{"IndexOnMap", "payload[0]", 1, "setting 'payload[0]': 'payload' is a map, not a list", nil},
+		{"IndexOnMissing", "missing[0]", 1, "setting 'missing[0]': 'missing' is not a list", nil},
+		{"Invalid", "a[", 1, "invalid path 'a[': missing ']' at 1", nil},
+	}
+
+	for _, v := range tests {
+		msg := NewMessageWithExtra("main", fields())
+		err := msg.SetPath(v.Path, v.Value)
+		if (err == nil && v.ExpectedError != "") || (err != nil && err.Error() != v.ExpectedError) {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+			continue
+		}
+		for key, expected := range v.Expected {
+			if had := msg.GetTarget(key); !reflect.DeepEqual(had, expected) {
+				t.Errorf("%s: wrong field '%s': expected=%#v had=%#v", v.Name, key, expected, had)
+			}
+		}
+	}
+}
+
+func TestMessageSetTargetPath(t *testing.T) {
+	msg := NewMessageWithExtra("text", map[string]interface{}{"flat.name": "a"})
+
+	msg.SetTarget("payload.user.id", 1)
+	if had := msg.GetTarget("payload"); !reflect.DeepEqual(had, map[string]interface{}{"user": map[string]interface{}{"id": 1}}) {
+		t.Errorf("wrong payload: had=%#v", had)
+	}
+	// the existing fields with a dot in the name are not changed in a path
+	msg.SetTarget("flat.name", "b")
+	if had := msg.GetTarget("flat.name"); had != "b" {
+		t.Errorf("wrong flat field: expected=%#v had=%#v", "b", had)
+	}
+	if had := msg.GetTarget("flat"); had != nil {
+		t.Errorf("wrong field: expected=%#v had=%#v", nil, had)
+	}
+	// the path can't be set inside a string, the name is used as it is
+	msg.SetTarget("main.x", "c")
+	if had := msg.GetMessage(); had != "text" {
+		t.Errorf("wrong main: expected=%#v had=%#v", "text", had)
+	}
+	if had := msg.GetExtra()["main.x"]; had != "c" {
+		t.Errorf("wrong field: expected=%#v had=%#v", "c", had)
+	}
+}
+
+func TestMessageListsAndMaps(t *testing.T) {
+	msg := NewMessageWithExtra("text", map[string]interface{}{
+		"tags":  []string{"a"},
+		"attrs": map[string]string{"k": "v"},
+	})
+
+	if had, ok := msg.GetList("tags"); !ok || !reflect.DeepEqual(had, []interface{}{"a"}) {
+		t.Errorf("wrong list: expected=%#v had=%#v", []interface{}{"a"}, had)
+	}
+	if _, ok := msg.GetList("main"); ok {
+		t.Errorf("wrong list: a string is not a list")
+	}
+	if had, ok := msg.GetMap("attrs"); !ok || !reflect.DeepEqual(had, map[string]interface{}{"k": "v"}) {
+		t.Errorf("wrong map: expected=%#v had=%#v", map[string]interface{}{"k": "v"}, had)
+	}
+	if _, ok := msg.GetMap("tags"); ok {
+		t.Errorf("wrong map: a list is not a map")
+	}
+
+	if err := msg.AppendTarget("tags", "b", "c"); err != nil {
+		t.Errorf("wrong error: expected=%#v had=%#v", nil, err)
+	}
+	if had := msg.GetTarget("tags"); !reflect.DeepEqual(had, []interface{}{"a", "b", "c"}) {
+		t.Errorf("wrong list: expected=%#v had=%#v", []interface{}{"a", "b", "c"}, had)
+	}
+	if err := msg.AppendTarget("new.list", 1); err != nil {
+		t.Errorf("wrong error: expected=%#v had=%#v", nil, err)
+	}
+	if had := msg.GetTarget("new.list"); !reflect.DeepEqual(had, []interface{}{1}) {
+		t.Errorf("wrong list: expected=%#v had=%#v", []interface{}{1}, had)
+	}
+	if err := msg.AppendTarget("attrs", 1); err == nil || err.Error() != "appending to 'attrs': it is a map[string]string, not a list" {
+		t.Errorf("wrong error: had=%#v", err)
+	}
+
+	if !msg.DeleteTarget("tags[0]") {
+		t.Errorf("wrong delete: expected=%#v had=%#v", true, false)
+	}
+	if had := msg.GetTarget("tags"); !reflect.DeepEqual(had, []interface{}{"b", "c"}) {
+		t.Errorf("wrong list: expected=%#v had=%#v", []interface{}{"b", "c"}, had)
+	}
+	if !msg.DeleteTarget("new.list") || msg.GetTarget("new") == nil || msg.GetTarget("new.list") != nil {
+		t.Errorf("wrong delete of new.list: had=%#v", msg.GetTarget("new"))
+	}
+	if msg.DeleteTarget("missing.key") || msg.DeleteTarget("tags[5]") {
+		t.Errorf("wrong delete: expected=%#v had=%#v", false, true)
+	}
+	if !msg.DeleteTarget("attrs") || msg.GetTarget("attrs") != nil {
+		t.Errorf("wrong delete of attrs")
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	original := map[string]interface{}{
+		"list":  []interface{}{map[string]interface{}{"a": 1}},
+		"typed": map[string][]string{"k": {"v"}},
+		"bytes": []byte("b"),
+		"nil":   nil,
+	}
+	clone := DeepCopy(original).(map[string]interface{})
+	if !reflect.DeepEqual(original, clone) {
+		t.Errorf("wrong copy: expected=%#v had=%#v", original, clone)
+	}
+
+	clone["list"].([]interface{})[0].(map[string]interface{})["a"] = 2
+	clone["typed"].(map[string][]string)["k"][0] = "changed"
+	if original["list"].([]interface{})[0].(map[string]interface{})["a"] != 1 {
+		t.Errorf("the copy of the list shares the items with the original")
+	}
+	if original["typed"].(map[string][]string)["k"][0] != "v" {
+		t.Errorf("the copy of the typed map shares the items with the original")
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"maps"
 	"net/http"
 	"reflect"
 	"strings"
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/Matrix86/driplane/utils/apt"
 
 	"github.com/evilsocket/islazy/log"
@@ -33,6 +35,10 @@ type Apt struct {
 	ticker   *time.Ticker
 	context  context.Context
 	cancel   context.CancelFunc
+	// packages of the last index read, saved in the checkpoint
+	seen map[string]bool
+	// packages propagated before a restart, skipped only by the first read of the index
+	resumed map[string]bool
 }
 
 // NewAptFeeder is the registered method to instantiate a AptFeeder
@@ -134,7 +140,13 @@ func (f *Apt) parseFeed(firstRun bool) error {
 	}
 	log.Debug("reading index file '%s'", repo.GetIndexURL())
 	f.indexURL = repo.GetIndexURL()
+	seen := make(map[string]bool, len(packages))
 	for _, item := range packages {
+		seen[item.Filename] = true
+		if f.resumed[item.Filename] {
+			continue
+		}
+
 		extra := f.getExtraFromPackage(&item)
 		main := ""
 		if item.Filename != "" {
@@ -147,15 +159,27 @@ func (f *Apt) parseFeed(firstRun bool) error {
 		}
 		f.Propagate(msg)
 	}
+	f.resumed = nil
+	// only the packages still in the index are kept, and the checkpoint is written only if they changed
+	if !maps.Equal(seen, f.seen) {
+		f.seen = seen
+		f.saveCheckpoint(f.seen)
+	}
 	return nil
 }
 
 // Start propagates a message every time a new row is published
 func (f *Apt) Start() {
+	// packages propagated in the previous run
+	resumed := f.loadCheckpoint(&f.resumed)
+	if resumed {
+		f.seen = f.resumed
+	}
+
 	f.ticker = time.NewTicker(f.frequency)
 	go func() {
 		// first start!
-		err := f.parseFeed(true)
+		err := f.parseFeed(!resumed)
 		if err != nil {
 			log.Error("apt feeder: %s", err)
 		}
@@ -191,5 +215,17 @@ func (f *Apt) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("apt", NewAptFeeder)
+	register("apt", NewAptFeeder, schema.Schema{
+		Description: "monitors the packages of an APT repository",
+		Fields:      []string{"filename", "size", "binarypackage", "md5sum", "sha1", "sha256", "descriptionmd5", "depends", "installedsize", "package", "architecture", "version", "section", "maintainer", "homepage", "description", "tag", "author", "name", "link"},
+		Params: []schema.Param{
+			{Name: "url", Type: schema.String, Description: "URL of the APT repository"},
+			{Name: "freq", Type: schema.Duration, Default: "60s", Description: "how often the repository is checked"},
+			{Name: "suite", Type: schema.String, Default: "stable", Description: "suite of the repository"},
+			{Name: "arch", Type: schema.String, Description: "architecture of the repository, the first one of the Release file if empty"},
+			{Name: "index", Type: schema.String, Description: "URL of the Packages file, it overrides url"},
+			{Name: "useragent", Type: schema.String, Description: "User-Agent of the requests"},
+			{Name: "insecure", Type: schema.Bool, Default: "false", Description: "allow repositories with insecure certificates"},
+		},
+	})
 }
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/utils"
 	"github.com/Matrix86/driplane/utils/apt"
 	"github.com/asaskevich/EventBus"
 )
@@ -490,3 +492,53 @@ func newTestBinaryPackage() apt.BinaryPackage {
 		Depends:      []string{"libc6", "libssl1.1"},
 	}
 }
+
+func TestAptCheckpoint(t *testing.T) {
+	ts := newAptFlatTestServer()
+	defer ts.Close()
+
+	store := utils.GetCheckpointStore(path.Join(t.TempDir(), "checkpoints"))
+	f, received, err := newTestApt(map[string]string{
+		"apt.index": ts.URL + "/Packages",
+	})
+	if err != nil {
+		t.Fatalf("setup failed: %s", err)
+	}
+	f.setCheckpoint(store, "rule:apt")
+
+	if err := f.parseFeed(true); err != nil {
+		t.Fatalf("parseFeed returned error: %s", err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(received))
+	}
+
+	// the packages seen in the previous run are not propagated again
+	f, received, err = newTestApt(map[string]string{
+		"apt.index": ts.URL + "/Packages",
+	})
+	if err != nil {
+		t.Fatalf("setup failed: %s", err)
+	}
+	f.setCheckpoint(store, "rule:apt")
+	if !f.loadCheckpoint(&f.resumed) {
+		t.Fatalf("checkpoint not found")
+	}
+	if len(f.resumed) != 2 {
+		t.Errorf("wrong number of seen packages: expected=2 had=%d", len(f.resumed))
+	}
+	if err := f.parseFeed(false); err != nil {
+		t.Fatalf("parseFeed returned error: %s", err)
+	}
+	if len(received) != 0 {
+		t.Errorf("expected no messages after the restart, got %d", len(received))
+	}
+
+	// the next reads behave as without checkpoints
+	if err := f.parseFeed(false); err != nil {
+		t.Fatalf("parseFeed returned error: %s", err)
+	}
+	if len(received) != 2 {
+		t.Errorf("expected 2 messages after the first read, got %d", len(received))
+	}
+}
@@ -1,9 +1,17 @@
 package feeders
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/metrics"
+	"github.com/Matrix86/driplane/schema"
+	"github.com/Matrix86/driplane/utils"
+
 	"github.com/asaskevich/EventBus"
 	"github.com/evilsocket/islazy/log"
 )
@@ -13,12 +21,27 @@ type FeederFactory func(conf map[string]string) (Feeder, error)
 
 var feederFactories = make(map[string]FeederFactory)
 
+var feederSchemas = make(map[string]schema.Schema)
+
+// Orders of the delivery of the messages of a Feeder to the filters of its rule
+const (
+	OrderParallel = "parallel"
+	OrderFIFO     = "fifo"
+)
+
+// commonParams are the parameters accepted by all the feeders
+var commonParams = []schema.Param{
+	{Name: "order", Type: schema.String, Default: OrderParallel, Values: []string{OrderParallel, OrderFIFO}, Description: "with fifo the messages go through the filters of the rule one at a time, in the order they were sent by the feeder"},
+}
+
 // Feeder defines Base methods of the object
 type Feeder interface {
 	setName(name string)
 	setBus(bus EventBus.Bus)
 	setID(id int32)
 	setRuleName(name string)
+	setCheckpoint(store *utils.CheckpointStore, key string)
+	setOrder(order string)
 
 	Name() string
 	Rule() string
@@ -27,6 +50,7 @@ type Feeder interface {
 	IsRunning() bool
 	GetIdentifier() string
 	OnEvent(e *data.Event)
+	Order() string
 }
 
 // Base is inherited from the feeders
@@ -36,6 +60,11 @@ type Base struct {
 	id        int32
 	isRunning bool
 	bus       EventBus.Bus
+
+	checkpoints   *utils.CheckpointStore
+	checkpointKey string
+
+	order string
 }
 
 // Propagate sends the Message to the connected Filters
@@ -43,6 +72,7 @@ func (f *Base) Propagate(data *data.Message) {
 	data.SetExtra("source_feeder", f.Name())
 	data.SetExtra("source_feeder_rule", f.Rule())
 	data.SetExtra("rule_name", f.Rule())
+	metrics.FeederPropagated(f.Rule(), f.GetIdentifier())
 	f.bus.Publish(f.GetIdentifier(), data)
 }
 
@@ -62,6 +92,62 @@ func (f *Base) setRuleName(name string) {
 	f.rule = name
 }
 
+func (f *Base) setCheckpoint(store *utils.CheckpointStore, key string) {
+	f.checkpoints = store
+	f.checkpointKey = key
+}
+
+func (f *Base) setOrder(order string) {
+	f.order = order
+}
+
+// Order returns how the messages of the Feeder are delivered to the filters of its rule: parallel or fifo
+func (f *Base) Order() string {
+	return f.order
+}
+
+// loadCheckpoint reads the state saved by a previous run of the Feeder in v.
+// It returns false if the checkpoints are disabled or nothing has been saved yet.
+func (f *Base) loadCheckpoint(v interface{}) bool {
+	if f.checkpoints == nil {
+		return false
+	}
+	found, err := f.checkpoints.Load(f.checkpointKey, v)
+	if err != nil {
+		log.Error("%s: loading checkpoint: %s", f.Name(), err)
+		return false
+	}
+	if found {
+		log.Debug("%s: checkpoint '%s' loaded", f.Name(), f.checkpointKey)
+	}
+	return found
+}
+
+// saveCheckpoint stores the state of the Feeder so it can be restored after a restart
+func (f *Base) saveCheckpoint(v interface{}) {
+	if f.checkpoints == nil {
+		return
+	}
+	if err := f.checkpoints.Save(f.checkpointKey, v); err != nil {
+		log.Error("%s: saving checkpoint: %s", f.Name(), err)
+	}
+}
+
+// checkpointKey identifies the state of a feeder using the rule name and the feeder parameters,
+// so changing the parameters of the feeder discards the old state. The order of the delivery doesn't change the state.
+func checkpointKey(rule string, name string, conf map[string]string) string {
+	prefix := strings.TrimSuffix(name, "feeder") + "."
+	params := make([]string, 0)
+	for k, v := range conf {
+		if strings.HasPrefix(k, prefix) && k != prefix+"order" {
+			params = append(params, k+"="+v)
+		}
+	}
+	sort.Strings(params)
+	hash := sha256.Sum256([]byte(strings.Join(params, "\n")))
+	return fmt.Sprintf("%s:%s:%x", rule, name, hash[:8])
+}
+
 // GetIdentifier returns the Node identifier ID used in the bus
 func (f *Base) GetIdentifier() string {
 	return fmt.Sprintf("%s:%d", f.name, f.id)
@@ -88,7 +174,7 @@ func (f *Base) IsRunning() bool {
 	return f.isRunning
 }
 
-func register(name string, f FeederFactory) {
+func register(name string, f FeederFactory, s schema.Schema) {
 	feederName := name + "feeder"
 	if f == nil {
 		log.Fatal("Factory method doesn't exists")
@@ -97,21 +183,66 @@ func register(name string, f FeederFactory) {
 		log.Fatal("Factory method with the same name already exists")
 	}
 	feederFactories[feederName] = f
+	feederSchemas[feederName] = s
 }
 
 // Init
 func init() {
 }
 
+// Names returns the sorted names of the registered feeders, as they are written in the rules
+func Names() []string {
+	names := make([]string, 0, len(feederFactories))
+	for name := range feederFactories {
+		names = append(names, strings.TrimSuffix(name, "feeder"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the schema of the parameters accepted by a registered feeder, common parameters included
+func Describe(name string) (schema.Schema, bool) {
+	s, ok := feederSchemas[name+"feeder"]
+	if !ok {
+		return s, false
+	}
+	s.Params = append(slices.Clone(s.Params), commonParams...)
+	return s, true
+}
+
+// orderParam parses the order parameter accepted by all the feeders, the default can be changed in the general
+// section of the configuration (general.order)
+func orderParam(name string, conf map[string]string) (string, error) {
+	order, ok := conf[strings.TrimSuffix(name, "feeder")+".order"]
+	if !ok {
+		if order, ok = conf["general.order"]; !ok {
+			return OrderParallel, nil
+		}
+	}
+	if order != OrderParallel && order != OrderFIFO {
+		return "", fmt.Errorf("order parameter has to be '%s' or '%s': '%s'", OrderParallel, OrderFIFO, order)
+	}
+	return order, nil
+}
+
 // NewFeeder creates a new registered Feeder from it's name
 func NewFeeder(rule string, name string, conf map[string]string, bus EventBus.Bus, id int32) (Feeder, error) {
 	if _, ok := feederFactories[name]; ok {
+		order, err := orderParam(name, conf)
+		if err != nil {
+			return nil, err
+		}
+
 		f, err := feederFactories[name](conf)
 		if err == nil && f != nil {
+			f.setOrder(order)
 			f.setName(name)
 			f.setRuleName(rule)
 			f.setBus(bus)
 			f.setID(id)
+			if file := conf["general.checkpoint_file"]; file != "" {
+				f.setCheckpoint(utils.GetCheckpointStore(file), checkpointKey(rule, name, conf))
+			}
 		}
 
 		return f, err
@@ -2,9 +2,13 @@ package feeders
 
 import (
 	"fmt"
+	"path"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/utils"
 	"github.com/asaskevich/EventBus"
 )
 
@@ -233,3 +237,121 @@ func TestNewFeederFactoryReturnsNil(t *testing.T) {
 		t.Errorf("expected nil feeder when factory returns nil")
 	}
 }
+
+func TestCheckpointKey(t *testing.T) {
+	conf := map[string]string{
+		"rss.url":            "https://example.com/feed",
+		"rss.freq":           "1m",
+		"general.rules_path": "/rules",
+	}
+	key := checkpointKey("rule1", "rssfeeder", conf)
+	if !strings.HasPrefix(key, "rule1:rssfeeder:") {
+		t.Errorf("wrong key: %s", key)
+	}
+
+	conf["general.rules_path"] = "/other"
+	if k := checkpointKey("rule1", "rssfeeder", conf); k != key {
+		t.Errorf("general parameters should not change the key: expected=%s had=%s", key, k)
+	}
+	conf["rss.url"] = "https://example.com/other"
+	if k := checkpointKey("rule1", "rssfeeder", conf); k == key {
+		t.Errorf("feeder parameters should change the key")
+	}
+	if k := checkpointKey("rule2", "rssfeeder", conf); k == checkpointKey("rule1", "rssfeeder", conf) {
+		t.Errorf("rule name should change the key")
+	}
+	key = checkpointKey("rule1", "rssfeeder", conf)
+	conf["rss.order"] = OrderFIFO
+	if k := checkpointKey("rule1", "rssfeeder", conf); k != key {
+		t.Errorf("the order should not change the key: expected=%s had=%s", key, k)
+	}
+}
+
+func TestNewFeederOrder(t *testing.T) {
+	type Test struct {
+		Name          string
+		Config        map[string]string
+		ExpectedOrder string
+		ExpectedError bool
+	}
+	tests := []Test{
+		{"Default", map[string]string{}, OrderParallel, false},
+		{"Param", map[string]string{"timer.order": "fifo"}, OrderFIFO, false},
+		{"General", map[string]string{"general.order": "fifo"}, OrderFIFO, false},
+		{"ParamOverGeneral", map[string]string{"timer.order": "parallel", "general.order": "fifo"}, OrderParallel, false},
+		{"Wrong", map[string]string{"timer.order": "lifo"}, "", true},
+	}
+
+	for _, v := range tests {
+		f, err := NewFeeder("rule1", "timerfeeder", v.Config, EventBus.New(), 1)
+		if v.ExpectedError != (err != nil) {
+			t.Errorf("%s: wrong error: %v", v.Name, err)
+			continue
+		}
+		if err == nil && f.Order() != v.ExpectedOrder {
+			t.Errorf("%s: wrong order: expected=%#v had=%#v", v.Name, v.ExpectedOrder, f.Order())
+		}
+	}
+}
+
+func TestNewFeederCheckpoint(t *testing.T) {
+	filename := path.Join(t.TempDir(), "checkpoints")
+	f, err := NewFeeder("rule1", "rssfeeder", map[string]string{
+		"rss.url":                 "https://example.com/feed",
+		"general.checkpoint_file": filename,
+	}, EventBus.New(), 1)
+	if err != nil {
+		t.Fatalf("NewFeeder returned '%s'", err)
+	}
+	rss := f.(*RSS)
+	if rss.checkpoints != utils.GetCheckpointStore(filename) {
+		t.Errorf("checkpoint store not set")
+	}
+
+	f, err = NewFeeder("rule1", "rssfeeder", map[string]string{}, EventBus.New(), 1)
+	if err != nil {
+		t.Fatalf("NewFeeder returned '%s'", err)
+	}
+	if f.(*RSS).checkpoints != nil {
+		t.Errorf("checkpoints should be disabled")
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("the names should be sorted: %#v", names)
+	}
+	for _, expected := range []string{"rss", "timer", "file"} {
+		found := false
+		for _, n := range names {
+			found = found || n == expected
+		}
+		if !found {
+			t.Errorf("feeder '%s' not found in %#v", expected, names)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	for _, name := range Names() {
+		s, ok := Describe(name)
+		if !ok {
+			t.Errorf("%s: schema not found", name)
+			continue
+		}
+		if s.Description == "" {
+			t.Errorf("%s: the schema should have a description", name)
+		}
+		for _, p := range s.Params {
+			if p.Default != "" {
+				if err := p.Check(p.Default); err != nil {
+					t.Errorf("%s: wrong default: %s", name, err)
+				}
+			}
+		}
+	}
+	if _, ok := Describe("notexist"); ok {
+		t.Errorf("schema of a not registered feeder should not be found")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 	"github.com/hpcloud/tail"
@@ -85,5 +86,12 @@ func (f *File) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("file", NewFileFeeder)
+	register("file", NewFileFeeder, schema.Schema{
+		Description: "sends the lines added to a file",
+		Fields:      []string{"file_name"},
+		Params: []schema.Param{
+			{Name: "filename", Type: schema.String, Required: true, Description: "path of the file"},
+			{Name: "toend", Type: schema.Bool, Default: "false", Description: "send only the lines added after the start"},
+		},
+	})
 }
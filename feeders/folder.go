@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/Matrix86/driplane/utils"
 
 	"github.com/Matrix86/cloudwatcher"
@@ -146,5 +147,14 @@ func (f *Folder) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("folder", NewFolderFeeder)
+	register("folder", NewFolderFeeder, schema.Schema{
+		Description:   "sends the files created or changed in a local or remote folder",
+		DynamicFields: true,
+		Params: []schema.Param{
+			{Name: "name", Type: schema.String, Description: "path of the folder"},
+			{Name: "type", Type: schema.String, Required: true, Description: "service to use", Values: []string{"local", "dropbox", "gdrive", "s3", "git"}},
+			{Name: "freq", Type: schema.Duration, Default: "2s", Description: "how often the folder is checked"},
+		},
+		Open: true,
+	})
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/emersion/go-message/mail"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/evilsocket/islazy/log"
 )
 
@@ -200,12 +201,16 @@ func (f *Imap) fetchMessages() error {
 		return fmt.Errorf("fetching: %s", err)
 	}
 	f.lastCheck = time.Now()
+	f.saveCheckpoint(f.lastCheck)
 
 	return nil
 }
 
 // Start propagates a message every time a new fs event happens in the folder
 func (f *Imap) Start() {
+	// restarting from the last check of the previous run
+	f.loadCheckpoint(&f.lastCheck)
+
 	f.ticker = time.NewTicker(f.frequency)
 	go func() {
 		for {
@@ -236,5 +241,18 @@ func (f *Imap) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("imap", NewImapFeeder)
+	register("imap", NewImapFeeder, schema.Schema{
+		Description: "sends the e-mails received in an IMAP mailbox",
+		Fields:      []string{"from", "to", "reply_to", "in_reply_to", "cc", "bcc", "sender", "message_id", "subject", "date", "is_attachment", "body", "attachment_filename", "attachment_body"},
+		Params: []schema.Param{
+			{Name: "host", Type: schema.String, Description: "host of the IMAP server"},
+			{Name: "port", Type: schema.Int, Description: "port of the IMAP server"},
+			{Name: "username", Type: schema.String, Description: "username of the account"},
+			{Name: "password", Type: schema.String, Description: "password of the account"},
+			{Name: "mailbox", Type: schema.String, Default: "INBOX", Description: "mailbox to read"},
+			{Name: "freq", Type: schema.Duration, Default: "1m", Description: "how often the mailbox is checked"},
+			{Name: "start_from_beginning", Type: schema.Bool, Default: "true", Description: "read all the e-mails in the mailbox from the beginning"},
+			{Name: "get_attachments", Type: schema.Bool, Default: "false", Description: "read also the attachments"},
+		},
+	})
 }
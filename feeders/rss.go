@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 	"github.com/mmcdole/gofeed"
@@ -143,16 +144,20 @@ func (f *RSS) parseFeed(firstRun bool) error {
 
 	f.lastParsing = lastPubDate
 	log.Debug("Latest item has been published on %s...updating date", lastPubDate.Format("2006-01-02 15:04:05"))
+	f.saveCheckpoint(f.lastParsing)
 
 	return nil
 }
 
 // Start propagates a message every time a new row is published
 func (f *RSS) Start() {
+	// restarting from the last item seen in the previous run
+	resumed := f.loadCheckpoint(&f.lastParsing)
+
 	f.ticker = time.NewTicker(f.frequency)
 	go func() {
 		// first start!
-		_ = f.parseFeed(true)
+		_ = f.parseFeed(!resumed)
 
 		for {
 			select {
@@ -181,5 +186,14 @@ func (f *RSS) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("rss", NewRSSFeeder)
+	register("rss", NewRSSFeeder, schema.Schema{
+		Description: "sends the new items of an RSS feed",
+		Fields:      []string{"feed_title", "feed_link", "feed_feedlink", "feed_updated", "feed_published", "feed_author", "feed_language", "feed_copyright", "feed_generator", "title", "description", "content", "link", "links", "updated", "published", "guid", "categories", "author_name", "author_email"},
+		Params: []schema.Param{
+			{Name: "url", Type: schema.String, Description: "URL of the feed"},
+			{Name: "freq", Type: schema.Duration, Default: "60s", Description: "how often the feed is parsed"},
+			{Name: "start_from_beginning", Type: schema.Bool, Default: "false", Description: "send all the items of the feed on the first run"},
+			{Name: "ignore_pubdate", Type: schema.Bool, Default: "false", Description: "ignore the pubdate and send all the items every time"},
+		},
+	})
 }
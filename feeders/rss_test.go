@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path"
 	"testing"
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/utils"
 	"github.com/asaskevich/EventBus"
 )
 
@@ -459,3 +461,46 @@ func TestGetPublishDate(t *testing.T) {
 		t.Errorf("lastParsing should be set after parsing feed with dated items")
 	}
 }
+
+func TestRSSCheckpoint(t *testing.T) {
+	ts := newRSSTestServer(testRSSFeed)
+	defer ts.Close()
+
+	store := utils.GetCheckpointStore(path.Join(t.TempDir(), "checkpoints"))
+	f, received, err := newTestRSS(map[string]string{
+		"rss.url": ts.URL,
+	})
+	if err != nil {
+		t.Fatalf("setup failed: %s", err)
+	}
+	f.setCheckpoint(store, "rule:rss")
+
+	if err := f.parseFeed(true); err != nil {
+		t.Fatalf("parseFeed returned error: %s", err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(received))
+	}
+
+	// a new feeder restarts from the last item seen by the previous one
+	f, received, err = newTestRSS(map[string]string{
+		"rss.url": ts.URL,
+	})
+	if err != nil {
+		t.Fatalf("setup failed: %s", err)
+	}
+	f.setCheckpoint(store, "rule:rss")
+	if !f.loadCheckpoint(&f.lastParsing) {
+		t.Fatalf("checkpoint not found")
+	}
+	expected := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	if !f.lastParsing.Equal(expected) {
+		t.Errorf("wrong lastParsing: expected=%s had=%s", expected, f.lastParsing)
+	}
+	if err := f.parseFeed(false); err != nil {
+		t.Fatalf("parseFeed returned error: %s", err)
+	}
+	if len(received) != 0 {
+		t.Errorf("expected no messages after the restart, got %d", len(received))
+	}
+}
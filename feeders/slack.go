@@ -14,6 +14,7 @@ import (
 	"sync"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/evilsocket/islazy/log"
 	"github.com/evilsocket/islazy/tui"
 	"github.com/localtunnel/go-localtunnel"
@@ -115,7 +116,7 @@ func NewSlackFeeder(conf map[string]string) (Feeder, error) {
 		}
 		log.Debug("Slack: listen on events: '%s'", strings.Join(keywords, ","))
 	}
-	if val, ok := conf["ignore_bot"]; ok && val == "false" {
+	if val, ok := conf["slack.ignore_bot"]; ok && val == "false" {
 		s.ignoreBot = false
 	}
 
@@ -440,5 +441,21 @@ func (s *Slack) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("slack", NewSlackFeeder)
+	register("slack", NewSlackFeeder, schema.Schema{
+		Description:   "receives the events of a Slack app",
+		DynamicFields: true,
+		Params: []schema.Param{
+			{Name: "bot_token", Type: schema.String, Description: "bot token (xoxb-*)"},
+			{Name: "app_token", Type: schema.String, Description: "app token (xapp-*)"},
+			{Name: "verification_token", Type: schema.String, Description: "token to verify the requests"},
+			{Name: "addr", Type: schema.String, Default: ":3000", Description: "address of the server in the form IP:PORT"},
+			{Name: "socket_mode", Type: schema.Bool, Default: "false", Description: "enable the Socket Mode"},
+			{Name: "lt_enable", Type: schema.Bool, Default: "false", Description: "enable localtunnel for the server"},
+			{Name: "lt_baseurl", Type: schema.String, Default: "https://localtunnel.me", Description: "URL of the localtunnel server"},
+			{Name: "lt_subdomain", Type: schema.String, Description: "subdomain to use with localtunnel"},
+			{Name: "events", Type: schema.String, Description: "comma separated list of the events to handle"},
+			{Name: "ignore_bot", Type: schema.Bool, Default: "true", Description: "ignore the messages created by other bots"},
+			{Name: "debug", Type: schema.Bool, Default: "false", Description: "log the Slack API calls"},
+		},
+	})
 }
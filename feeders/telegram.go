@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/evilsocket/islazy/log"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/auth"
@@ -635,5 +636,14 @@ func (t *Telegram) OnEvent(event *data.Event) {
 
 // Auto factory adding
 func init() {
-	register("telegram", NewTelegramFeeder)
+	register("telegram", NewTelegramFeeder, schema.Schema{
+		Description:   "receives the messages of a Telegram account",
+		DynamicFields: true,
+		Params: []schema.Param{
+			{Name: "app_id", Type: schema.Int, Required: true, Description: "app ID"},
+			{Name: "app_hash", Type: schema.String, Required: true, Description: "app hash"},
+			{Name: "phone_number", Type: schema.String, Required: true, Description: "phone number of the account, with the country code"},
+			{Name: "session_folder", Type: schema.String, Description: "folder where the sessions are stored"},
+		},
+	})
 }
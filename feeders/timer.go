@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 )
@@ -73,5 +74,11 @@ func (f *Timer) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("timer", NewTimerFeeder)
+	register("timer", NewTimerFeeder, schema.Schema{
+		Description: "sends a Message at regular intervals",
+		Fields:      []string{"timestamp", "rfc3339"},
+		Params: []schema.Param{
+			{Name: "freq", Type: schema.Duration, Default: "60s", Description: "interval between the Messages"},
+		},
+	})
 }
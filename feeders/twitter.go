@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 	twitter "github.com/g8rswimmer/go-twitter/v2"
@@ -380,5 +381,17 @@ func (t *Twitter) OnEvent(event *data.Event) {
 
 // Auto factory adding
 func init() {
-	register("twitter", NewTwitterFeeder)
+	register("twitter", NewTwitterFeeder, schema.Schema{
+		Description: "streams the tweets matching keywords, users or rules",
+		Fields:      []string{"link", "language", "username", "name", "author_id", "source_client", "quoted", "retweet", "response", "matched_rules", "original_link", "original_username", "original_name", "original_text", "original_userid", "reply_for_user"},
+		Params: []schema.Param{
+			{Name: "bearerToken", Type: schema.String, Description: "Twitter API bearer token"},
+			{Name: "keywords", Type: schema.String, Description: "comma separated keywords"},
+			{Name: "users", Type: schema.String, Description: "comma separated users"},
+			{Name: "rules", Type: schema.String, Description: "custom rules in the form tag:rule, separated by |"},
+			{Name: "languages", Type: schema.String, Description: "comma separated languages"},
+			{Name: "disable_retweet", Type: schema.Bool, Default: "false", Description: "ignore the retweets"},
+			{Name: "disable_quoted", Type: schema.Bool, Default: "false", Description: "ignore the quoted tweets"},
+		},
+	})
 }
@@ -2,6 +2,7 @@ package feeders
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/Matrix86/driplane/utils"
 
 	"github.com/evilsocket/islazy/log"
@@ -36,6 +38,15 @@ type Web struct {
 	stopChan    chan bool
 	ticker      *time.Ticker
 	lastParsing time.Time
+	// hash of the last page sent and true until the first read after a restart from a checkpoint
+	lastHash string
+	resumed  bool
+}
+
+// webCheckpoint is the state of the Web feeder saved between the runs
+type webCheckpoint struct {
+	LastParsing time.Time `json:"last_parsing"`
+	Hash        string    `json:"hash"`
 }
 
 // NewWebFeeder is the registered method to instantiate a WebFeeder
@@ -188,24 +199,42 @@ func (f *Web) parseURL(firstRun bool) error {
 		return fmt.Errorf("unexpected status: %s", r.Status)
 	}
 
-	msg := data.NewMessageWithExtra(txt, extra)
-	if firstRun {
-		msg.SetFirstRun()
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(txt)))
+	if f.resumed && hash == f.lastHash {
+		// the page has already been sent before the restart
+		log.Debug("%s: the page didn't change since the last run", f.Name())
+	} else {
+		msg := data.NewMessageWithExtra(txt, extra)
+		if firstRun {
+			msg.SetFirstRun()
+		}
+		f.Propagate(msg)
 	}
-	f.Propagate(msg)
+	f.resumed = false
+	f.lastHash = hash
 
 	f.lastParsing = time.Now()
 	log.Debug("Finished at %s...updating date", f.lastParsing.Format("2006-01-02 15:04:05"))
+	f.saveCheckpoint(webCheckpoint{LastParsing: f.lastParsing, Hash: f.lastHash})
 
 	return nil
 }
 
 // Start propagates a message every time the URL is read
 func (f *Web) Start() {
+	// the page has already been read in a previous run
+	var checkpoint webCheckpoint
+	resumed := f.loadCheckpoint(&checkpoint)
+	if resumed {
+		f.lastParsing = checkpoint.LastParsing
+		f.lastHash = checkpoint.Hash
+		f.resumed = true
+	}
+
 	f.ticker = time.NewTicker(f.frequency)
 	go func() {
 		// first start!
-		_ = f.parseURL(true)
+		_ = f.parseURL(!resumed)
 
 		for {
 			select {
@@ -234,5 +263,19 @@ func (f *Web) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("web", NewWebFeeder)
+	register("web", NewWebFeeder, schema.Schema{
+		Description: "sends the content of a web page at regular intervals",
+		Fields:      []string{"url", "title", "description", "image", "sitename"},
+		Params: []schema.Param{
+			{Name: "url", Type: schema.String, Description: "URL of the page"},
+			{Name: "freq", Type: schema.Duration, Default: "60s", Description: "how often the page is requested"},
+			{Name: "text_only", Type: schema.Bool, Default: "false", Description: "remove all the tags from the page"},
+			{Name: "method", Type: schema.String, Default: "GET", Description: "HTTP method of the requests"},
+			{Name: "headers", Type: schema.Map, Description: "headers of the requests"},
+			{Name: "data", Type: schema.Map, Description: "POST fields of the requests"},
+			{Name: "rawData", Type: schema.String, Description: "raw body of the requests"},
+			{Name: "status", Type: schema.Int, Description: "send the page only if the response has this status"},
+			{Name: "cookies", Type: schema.String, Description: "path of the JSON file containing the cookies to use"},
+		},
+	})
 }
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path"
 	"testing"
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/utils"
 	"github.com/asaskevich/EventBus"
 )
 
@@ -602,3 +604,54 @@ func TestWebStartPropagatesOnFirstRun(t *testing.T) {
 		t.Errorf("expected a message on Start() but got none")
 	}
 }
+
+func TestWebCheckpoint(t *testing.T) {
+	page := testWebPage
+	ts := newWebTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, page)
+	})
+	defer ts.Close()
+
+	store := utils.GetCheckpointStore(path.Join(t.TempDir(), "checkpoints"))
+	start := func() (*Web, chan *data.Message) {
+		f, received, err := newTestWeb(map[string]string{
+			"web.url":  ts.URL,
+			"web.freq": "10s",
+		})
+		if err != nil {
+			t.Fatalf("setup failed: %s", err)
+		}
+		f.setCheckpoint(store, "rule:web")
+		f.Start()
+		return f, received
+	}
+
+	f, received := start()
+	select {
+	case <-received:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("expected a message on the first start")
+	}
+	f.Stop()
+
+	// the unchanged page is not sent again after a restart
+	f, received = start()
+	select {
+	case <-received:
+		t.Errorf("the unchanged page should not be sent after a restart")
+	case <-time.After(300 * time.Millisecond):
+	}
+	f.Stop()
+
+	page = "<html><body>changed</body></html>"
+	f, received = start()
+	defer f.Stop()
+	select {
+	case msg := <-received:
+		if msg.IsFirstRun() {
+			t.Errorf("the message after a restart should not be marked as first run")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Errorf("the changed page should be sent after a restart")
+	}
+}
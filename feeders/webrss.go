@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/evilsocket/islazy/log"
 	"github.com/gocolly/colly/v2"
 )
@@ -175,5 +176,18 @@ func (f *WebRSS) OnEvent(event *data.Event) {}
 
 // Auto factory adding
 func init() {
-	register("webrss", NewWebRSSFeeder)
+	register("webrss", NewWebRSSFeeder, schema.Schema{
+		Description: "scrapes a web page and sends its articles as the items of a feed",
+		Fields:      []string{"title", "description", "published_at", "link"},
+		Params: []schema.Param{
+			{Name: "url", Type: schema.String, Required: true, Description: "URL of the page"},
+			{Name: "item_selector", Type: schema.String, Required: true, Description: "CSS selector of the article blocks"},
+			{Name: "title_selector", Type: schema.String, Required: true, Description: "CSS selector of the title in the block"},
+			{Name: "link_selector", Type: schema.String, Required: true, Description: "CSS selector of the link in the block"},
+			{Name: "desc_selector", Type: schema.String, Description: "CSS selector of the description in the block"},
+			{Name: "date_selector", Type: schema.String, Description: "CSS selector of the date in the block"},
+			{Name: "link_attr", Type: schema.String, Default: "href", Description: "attribute of the link containing the URL"},
+			{Name: "freq", Type: schema.Duration, Default: "60m", Description: "how often the page is scraped"},
+		},
+	})
 }
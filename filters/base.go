@@ -2,9 +2,17 @@ package filters
 
 import (
 	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/metrics"
 	"github.com/Matrix86/driplane/plugins"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/asaskevich/EventBus"
 	"github.com/evilsocket/islazy/log"
@@ -16,6 +24,36 @@ type FilterFactory func(conf map[string]string) (Filter, error)
 
 var filterFactories = make(map[string]FilterFactory)
 
+var filterSchemas = make(map[string]schema.Schema)
+
+// commonParams are the parameters accepted by all the filters
+var commonParams = []schema.Param{
+	{Name: "retry", Type: schema.Int, Default: "0", Description: "how many times the filter is retried after an error"},
+	{Name: "retry_backoff", Type: schema.Duration, Default: "1s", Description: "delay before the first retry, doubled after each attempt"},
+	{Name: "retry_max_delay", Type: schema.Duration, Default: "30s", Description: "maximum delay between two attempts"},
+	{Name: "on_error", Type: schema.Rule, Description: "rule receiving the messages that caused an error"},
+	{Name: "workers", Type: schema.Int, Default: "4", Description: "how many messages the filter processes at the same time"},
+	{Name: "queue_size", Type: schema.Int, Default: "1000", Description: "how many messages can wait to be processed by the filter"},
+	{Name: "overflow", Type: schema.String, Default: OverflowBlock, Values: []string{OverflowBlock, OverflowDropOldest, OverflowDropNewest}, Description: "what happens to a message received when the queue is full: the sender waits (block) or a message is discarded (drop-oldest, drop-newest)"},
+}
+
+// Policies applied when a message is sent to a Filter with a full queue
+const (
+	OverflowBlock      = "block"
+	OverflowDropOldest = "drop-oldest"
+	OverflowDropNewest = "drop-newest"
+)
+
+// Queue contains the options of the queue of the messages waiting to be processed by a Filter
+type Queue struct {
+	Workers  int
+	Size     int
+	Overflow string
+}
+
+// targetParam is the parameter used by the filters to choose the field of the Message to work on
+var targetParam = schema.Param{Name: "target", Type: schema.String, Default: "main", Description: "the field of the Message used by the filter (main, an extra field or a path inside them, i.e. payload.user.id)", Output: true}
+
 // Filter defines Base methods of the object
 type Filter interface {
 	setRuleName(name string)
@@ -23,14 +61,21 @@ type Filter interface {
 	setBus(bus EventBus.Bus)
 	setID(id int32)
 	setIsNegative(b bool)
+	setRetry(retries int, backoff time.Duration, maxDelay time.Duration)
+	setQueue(q Queue)
 
 	Rule() string
 	Name() string
 	DoFilter(msg *data.Message) (bool, error)
 	Pipe(msg *data.Message)
 	GetIdentifier() string
+	ElseIdentifier() string
+	EnableElse()
+	ErrorIdentifier() string
+	EnableError()
 	Log(format string, args ...interface{})
 	OnEvent(e *data.Event)
+	Queue() Queue
 }
 
 // Base is inherited from the feeders
@@ -40,7 +85,15 @@ type Base struct {
 	id       int32
 	bus      EventBus.Bus
 	negative bool
+	hasElse  bool
+	hasError bool
 	cbFilter func(msg *data.Message) (bool, error)
+
+	retries       int
+	retryBackoff  time.Duration
+	retryMaxDelay time.Duration
+
+	queue Queue
 }
 
 // Rule returns the rule in which the Filter is found
@@ -73,30 +126,115 @@ func (f *Base) setIsNegative(b bool) {
 	f.negative = b
 }
 
+func (f *Base) setRetry(retries int, backoff time.Duration, maxDelay time.Duration) {
+	f.retries = retries
+	f.retryBackoff = backoff
+	f.retryMaxDelay = maxDelay
+}
+
+func (f *Base) setQueue(q Queue) {
+	f.queue = q
+}
+
+// Queue returns the options of the queue of the messages waiting to be processed by the Filter
+func (f *Base) Queue() Queue {
+	return f.queue
+}
+
+// retryDelay returns the time to wait before the attempt: exponential backoff with jitter
+func (f *Base) retryDelay(attempt int) time.Duration {
+	delay := f.retryMaxDelay
+	if attempt <= 32 {
+		if d := f.retryBackoff << uint(attempt-1); d > 0 && d < f.retryMaxDelay {
+			delay = d
+		}
+	}
+	// the delay is randomized between delay/2 and delay
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
 // GetIdentifier returns the Node identifier ID used in the bus
 func (f *Base) GetIdentifier() string {
 	return fmt.Sprintf("%s:%d", f.name, f.id)
 }
 
+// ElseIdentifier returns the Node identifier used in the bus for the Messages that don't match the Filter
+func (f *Base) ElseIdentifier() string {
+	return fmt.Sprintf("%s:else", f.GetIdentifier())
+}
+
+// EnableElse makes the Filter propagate the Messages that don't match on the ElseIdentifier topic
+func (f *Base) EnableElse() {
+	f.hasElse = true
+}
+
+// ErrorIdentifier returns the Node identifier used in the bus for the Messages that caused an error
+func (f *Base) ErrorIdentifier() string {
+	return fmt.Sprintf("%s:error", f.GetIdentifier())
+}
+
+// EnableError makes the Filter propagate the Messages that caused an error on the ErrorIdentifier topic
+func (f *Base) EnableError() {
+	f.hasError = true
+}
+
 // Log print a debug line prepending the name of the rule and of the filter
 func (f *Base) Log(format string, args ...interface{}) {
 	str := fmt.Sprintf("[%s::%s] %s", f.Rule(), f.Name(), format)
 	log.Debug(str, args...)
 }
 
+// copyMessage returns a copy of the Message keeping its identity, with the Filter added to its hops
+func (f *Base) copyMessage(msg *data.Message) *data.Message {
+	m := msg.Copy()
+	m.AddHop(f.GetIdentifier())
+	return m
+}
+
 // Pipe gets a Message from the previous Node and Propagate it to the next one if the Filter's callback will return true
 func (f *Base) Pipe(msg *data.Message) {
-	clone := msg.Clone()
-	log.Debug("[%s::%s] received: %#v", f.rule, f.name, clone)
+	clone := f.copyMessage(msg)
+	log.Debug("[%s::%s] received %s: %#v", f.rule, f.name, clone.ID(), clone)
+	metrics.FilterReceived(f.rule, f.GetIdentifier())
+	start := time.Now()
 	b, err := f.cbFilter(clone)
+	for attempt := 1; err != nil && attempt <= f.retries; attempt++ {
+		delay := f.retryDelay(attempt)
+		log.Warning("[%s::%s] %s: retrying in %s (%d/%d)", f.rule, f.name, err, delay, attempt, f.retries)
+		time.Sleep(delay)
+		clone = f.copyMessage(msg)
+		b, err = f.cbFilter(clone)
+	}
 	if err != nil {
 		log.Error("[%s::%s] %s", f.rule, f.name, err)
+		if f.hasError {
+			m := f.copyMessage(msg)
+			m.SetExtra("error", err.Error())
+			m.SetExtra("error_filter", f.GetIdentifier())
+			m.SetExtra("error_rule", f.Rule())
+			f.bus.Publish(f.ErrorIdentifier(), m)
+			// the message follows only the on_error route
+			metrics.FilterDone(f.rule, f.GetIdentifier(), false, err, time.Since(start))
+			return
+		}
 	}
 
 	// golang does not provide a logical XOR so we have to "implement" it manually
-	if f.negative != b {
+	matched := f.negative != b
+	metrics.FilterDone(f.rule, f.GetIdentifier(), matched, err, time.Since(start))
+	if matched {
 		log.Debug("[%s::%s] filter matched", f.rule, f.name)
 		f.Propagate(clone)
+	} else if f.hasElse {
+		log.Debug("[%s::%s] filter not matched, sending to else", f.rule, f.name)
+		// the else path receives the Message as it was before the Filter
+		m := f.copyMessage(msg)
+		m.SetExtra("rule_name", f.Rule())
+		f.bus.Publish(f.ElseIdentifier(), m)
 	}
 }
 
@@ -106,7 +244,7 @@ func (f *Base) Propagate(data *data.Message) {
 	f.bus.Publish(f.GetIdentifier(), data)
 }
 
-func register(name string, f FilterFactory) {
+func register(name string, f FilterFactory, s schema.Schema) {
 	filterName := name + "filter"
 	if f == nil {
 		log.Fatal("Filter method doesn't exists")
@@ -115,6 +253,7 @@ func register(name string, f FilterFactory) {
 		log.Fatal("Filter factory method with the same name already exists")
 	}
 	filterFactories[filterName] = f
+	filterSchemas[filterName] = s
 }
 
 func init() {
@@ -130,9 +269,106 @@ func init() {
 	}
 }
 
+// retryParams parses the retry parameters accepted by all the filters
+func retryParams(conf map[string]string) (int, time.Duration, time.Duration, error) {
+	retries := 0
+	backoff := time.Second
+	maxDelay := 30 * time.Second
+
+	if v, ok := conf["retry"]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return 0, 0, 0, fmt.Errorf("retry parameter has to be a positive number: '%s'", v)
+		}
+		retries = int(f)
+	}
+	if v, ok := conf["retry_backoff"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("retry_backoff cannot be parsed '%s': %s", v, err)
+		}
+		backoff = d
+	}
+	if v, ok := conf["retry_max_delay"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("retry_max_delay cannot be parsed '%s': %s", v, err)
+		}
+		maxDelay = d
+	}
+	if backoff > maxDelay {
+		backoff = maxDelay
+	}
+	return retries, backoff, maxDelay, nil
+}
+
+// queueParams parses the queue parameters accepted by all the filters, the defaults can be changed in the general
+// section of the configuration (i.e. general.workers)
+func queueParams(conf map[string]string) (Queue, error) {
+	q := Queue{Workers: 4, Size: 1000, Overflow: OverflowBlock}
+	param := func(name string) (string, bool) {
+		if v, ok := conf[name]; ok {
+			return v, true
+		}
+		v, ok := conf["general."+name]
+		return v, ok
+	}
+
+	if v, ok := param("workers"); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 1 {
+			return q, fmt.Errorf("workers parameter has to be a number greater than 0: '%s'", v)
+		}
+		q.Workers = int(f)
+	}
+	if v, ok := param("queue_size"); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 1 {
+			return q, fmt.Errorf("queue_size parameter has to be a number greater than 0: '%s'", v)
+		}
+		q.Size = int(f)
+	}
+	if v, ok := param("overflow"); ok {
+		if v != OverflowBlock && v != OverflowDropOldest && v != OverflowDropNewest {
+			return q, fmt.Errorf("overflow parameter has to be '%s', '%s' or '%s': '%s'", OverflowBlock, OverflowDropOldest, OverflowDropNewest, v)
+		}
+		q.Overflow = v
+	}
+	return q, nil
+}
+
+// Names returns the sorted names of the registered filters, as they are written in the rules
+func Names() []string {
+	names := make([]string, 0, len(filterFactories))
+	for name := range filterFactories {
+		names = append(names, strings.TrimSuffix(name, "filter"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the schema of the parameters accepted by a registered filter, common parameters included
+func Describe(name string) (schema.Schema, bool) {
+	s, ok := filterSchemas[name+"filter"]
+	if !ok {
+		return s, false
+	}
+	s.Params = append(slices.Clone(s.Params), commonParams...)
+	return s, true
+}
+
 // NewFilter creates a new registered Filter from it's name
 func NewFilter(rule string, name string, conf map[string]string, bus EventBus.Bus, id int32, neg bool) (Filter, error) {
 	if _, ok := filterFactories[name]; ok {
+		retries, backoff, maxDelay, err := retryParams(conf)
+		if err != nil {
+			return nil, err
+		}
+		queue, err := queueParams(conf)
+		if err != nil {
+			return nil, err
+		}
+
 		f, err := filterFactories[name](conf)
 		if err == nil && f != nil {
 			f.setRuleName(rule)
@@ -140,6 +376,8 @@ func NewFilter(rule string, name string, conf map[string]string, bus EventBus.Bu
 			f.setBus(bus)
 			f.setID(id)
 			f.setIsNegative(neg)
+			f.setRetry(retries, backoff, maxDelay)
+			f.setQueue(queue)
 		}
 		return f, err
 	}
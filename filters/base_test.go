@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/evilsocket/islazy/log"
 
@@ -218,3 +220,329 @@ func TestBase_Rule(t *testing.T) {
 		t.Errorf("wrong rule: expected=%#v had=%#v", expected, b.Rule())
 	}
 }
+
+func TestBase_PipeElse(t *testing.T) {
+	type Test struct {
+		Name          string
+		HasElse       bool
+		Negative      bool
+		Match         bool
+		ExpectedTopic string
+	}
+
+	tests := []Test{
+		{"MatchWithElse", true, false, true, "echo:1"},
+		{"NoMatchWithElse", true, false, false, "echo:1:else"},
+		{"NoMatchWithoutElse", false, false, false, ""},
+		{"NegativeWithElse", true, true, true, "echo:1:else"},
+	}
+
+	for _, v := range tests {
+		bus := NewFakeBus()
+		match := v.Match
+		b := Base{
+			rule:     "Rule1",
+			name:     "echo",
+			id:       1,
+			bus:      bus,
+			negative: v.Negative,
+			hasElse:  v.HasElse,
+			cbFilter: func(msg *data.Message) (bool, error) {
+				msg.SetMessage("changed")
+				return match, nil
+			},
+		}
+		b.Pipe(data.NewMessage("test"))
+
+		if v.ExpectedTopic == "" {
+			if len(bus.Collected) != 0 {
+				t.Errorf("%s: no message expected, had=%d", v.Name, len(bus.Collected))
+			}
+			continue
+		}
+		if len(bus.Collected) != 1 {
+			t.Fatalf("%s: expected 1 message, had=%d", v.Name, len(bus.Collected))
+		}
+		if bus.Topics[0] != v.ExpectedTopic {
+			t.Errorf("%s: wrong topic: expected=%#v had=%#v", v.Name, v.ExpectedTopic, bus.Topics[0])
+		}
+		if bus.Topics[0] == b.ElseIdentifier() && bus.Collected[0].GetMessage() != "test" {
+			t.Errorf("%s: the else path should receive the original message, had=%#v", v.Name, bus.Collected[0].GetMessage())
+		}
+	}
+}
+
+func TestBase_PipeLineage(t *testing.T) {
+	type Test struct {
+		Name          string
+		Match         bool
+		Fanout        bool
+		ExpectedTopic string
+	}
+
+	tests := []Test{
+		{"Match", true, false, "echo:1"},
+		{"NoMatch", false, false, "echo:1:else"},
+		{"Fanout", false, true, "echo:1"},
+	}
+
+	for _, v := range tests {
+		bus := NewFakeBus()
+		msg := data.NewMessage("test")
+		msg.AddHop("text:0")
+		b := &Base{
+			rule:    "Rule1",
+			name:    "echo",
+			id:      1,
+			bus:     bus,
+			hasElse: !v.Fanout,
+		}
+		match, fanout := v.Match, v.Fanout
+		b.cbFilter = func(m *data.Message) (bool, error) {
+			if fanout {
+				b.Propagate(m.Clone())
+			}
+			return match, nil
+		}
+		b.Pipe(msg)
+
+		if len(bus.Collected) != 1 {
+			t.Fatalf("%s: expected 1 message, had=%d", v.Name, len(bus.Collected))
+		}
+		had := bus.Collected[0]
+		if bus.Topics[0] != v.ExpectedTopic {
+			t.Errorf("%s: wrong topic: expected=%#v had=%#v", v.Name, v.ExpectedTopic, bus.Topics[0])
+		}
+		if hops := had.Hops(); len(hops) != 2 || hops[0] != "text:0" || hops[1] != "echo:1" {
+			t.Errorf("%s: wrong hops: expected=%#v had=%#v", v.Name, []string{"text:0", "echo:1"}, hops)
+		}
+		if v.Fanout && (had.ID() == msg.ID() || had.ParentID() != msg.ID()) {
+			t.Errorf("%s: wrong lineage: expected parent=%#v had id=%#v parent=%#v", v.Name, msg.ID(), had.ID(), had.ParentID())
+		}
+		if !v.Fanout && had.ID() != msg.ID() {
+			t.Errorf("%s: wrong id: expected=%#v had=%#v", v.Name, msg.ID(), had.ID())
+		}
+		if len(msg.Hops()) != 1 {
+			t.Errorf("%s: the received message has been changed: %#v", v.Name, msg.Hops())
+		}
+	}
+}
+
+func TestBase_PipeError(t *testing.T) {
+	type Test struct {
+		Name     string
+		HasError bool
+		Err      error
+		Expected int
+	}
+
+	tests := []Test{
+		{"ErrorRouted", true, fmt.Errorf("triggered error"), 1},
+		{"ErrorNotRouted", false, fmt.Errorf("triggered error"), 0},
+		{"NoError", true, nil, 0},
+	}
+
+	for _, v := range tests {
+		bus := NewFakeBus()
+		e := v.Err
+		b := Base{
+			rule:     "Rule1",
+			name:     "httpfilter",
+			id:       3,
+			bus:      bus,
+			hasError: v.HasError,
+			cbFilter: func(msg *data.Message) (bool, error) {
+				msg.SetMessage("changed")
+				return false, e
+			},
+		}
+		b.Pipe(data.NewMessage("test"))
+
+		if len(bus.Collected) != v.Expected {
+			t.Fatalf("%s: wrong number of messages: expected=%d had=%d", v.Name, v.Expected, len(bus.Collected))
+		}
+		if v.Expected == 0 {
+			continue
+		}
+		msg := bus.Collected[0]
+		if bus.Topics[0] != "httpfilter:3:error" {
+			t.Errorf("%s: wrong topic: had=%#v", v.Name, bus.Topics[0])
+		}
+		if msg.GetMessage() != "test" {
+			t.Errorf("%s: the error path should receive the original message, had=%#v", v.Name, msg.GetMessage())
+		}
+		if msg.GetTarget("error") != "triggered error" || msg.GetTarget("error_filter") != "httpfilter:3" || msg.GetTarget("error_rule") != "Rule1" {
+			t.Errorf("%s: wrong error extras: %#v", v.Name, msg.GetExtra())
+		}
+	}
+}
+
+func TestBase_PipeRetry(t *testing.T) {
+	type Test struct {
+		Name          string
+		Retries       int
+		Failures      int
+		ExpectedCalls int
+		ExpectedMsgs  int
+	}
+
+	tests := []Test{
+		{"NoRetry", 0, 1, 1, 0},
+		{"SuccessAfterRetry", 3, 2, 3, 1},
+		{"TooManyFailures", 2, 5, 3, 0},
+		{"NoFailures", 3, 0, 1, 1},
+	}
+
+	for _, v := range tests {
+		bus := NewFakeBus()
+		calls := 0
+		failures := v.Failures
+		b := Base{
+			rule: "Rule1",
+			name: "httpfilter",
+			id:   1,
+			bus:  bus,
+			cbFilter: func(msg *data.Message) (bool, error) {
+				calls++
+				if calls <= failures {
+					return false, fmt.Errorf("failure %d", calls)
+				}
+				return true, nil
+			},
+		}
+		b.setRetry(v.Retries, time.Millisecond, 5*time.Millisecond)
+		b.Pipe(data.NewMessage("test"))
+
+		if calls != v.ExpectedCalls {
+			t.Errorf("%s: wrong number of calls: expected=%d had=%d", v.Name, v.ExpectedCalls, calls)
+		}
+		if len(bus.Collected) != v.ExpectedMsgs {
+			t.Errorf("%s: wrong number of messages: expected=%d had=%d", v.Name, v.ExpectedMsgs, len(bus.Collected))
+		}
+	}
+}
+
+func TestBase_RetryDelay(t *testing.T) {
+	b := Base{}
+	b.setRetry(10, 100*time.Millisecond, time.Second)
+
+	for attempt := 1; attempt <= 40; attempt++ {
+		max := 100 * time.Millisecond << uint(attempt-1)
+		if attempt > 4 {
+			max = time.Second
+		}
+		d := b.retryDelay(attempt)
+		if d < max/2 || d > max {
+			t.Errorf("attempt %d: delay %s not in [%s, %s]", attempt, d, max/2, max)
+		}
+	}
+}
+
+func TestNewFilterRetryParams(t *testing.T) {
+	bus := NewFakeBus()
+	type Test struct {
+		Name          string
+		Config        map[string]string
+		ExpectedError bool
+	}
+	tests := []Test{
+		{"Valid", map[string]string{"retry": "3E+00", "retry_backoff": "2s", "retry_max_delay": "1m"}, false},
+		{"WrongRetry", map[string]string{"retry": "many"}, true},
+		{"NegativeRetry", map[string]string{"retry": "-1"}, true},
+		{"WrongBackoff", map[string]string{"retry_backoff": "soon"}, true},
+		{"WrongMaxDelay", map[string]string{"retry_max_delay": "later"}, true},
+	}
+
+	for _, v := range tests {
+		f, err := NewFilter("Rule1", "echofilter", v.Config, bus, 1, false)
+		if v.ExpectedError != (err != nil) {
+			t.Errorf("%s: wrong error: %v", v.Name, err)
+			continue
+		}
+		if err == nil {
+			e := f.(*Echo)
+			if e.retries != 3 || e.retryBackoff != 2*time.Second || e.retryMaxDelay != time.Minute {
+				t.Errorf("%s: wrong retry params: %d %s %s", v.Name, e.retries, e.retryBackoff, e.retryMaxDelay)
+			}
+		}
+	}
+}
+
+func TestNewFilterQueueParams(t *testing.T) {
+	bus := NewFakeBus()
+	type Test struct {
+		Name          string
+		Config        map[string]string
+		ExpectedQueue Queue
+		ExpectedError bool
+	}
+	tests := []Test{
+		{"Default", map[string]string{}, Queue{Workers: 4, Size: 1000, Overflow: OverflowBlock}, false},
+		{"Params", map[string]string{"workers": "1", "queue_size": "10", "overflow": "drop-oldest"}, Queue{Workers: 1, Size: 10, Overflow: OverflowDropOldest}, false},
+		{"General", map[string]string{"general.workers": "8", "general.overflow": "drop-newest"}, Queue{Workers: 8, Size: 1000, Overflow: OverflowDropNewest}, false},
+		{"ParamsOverGeneral", map[string]string{"workers": "2", "general.workers": "8"}, Queue{Workers: 2, Size: 1000, Overflow: OverflowBlock}, false},
+		{"ZeroWorkers", map[string]string{"workers": "0"}, Queue{}, true},
+		{"WrongSize", map[string]string{"queue_size": "big"}, Queue{}, true},
+		{"WrongOverflow", map[string]string{"overflow": "drop"}, Queue{}, true},
+	}
+
+	for _, v := range tests {
+		f, err := NewFilter("Rule1", "echofilter", v.Config, bus, 1, false)
+		if v.ExpectedError != (err != nil) {
+			t.Errorf("%s: wrong error: %v", v.Name, err)
+			continue
+		}
+		if err == nil && f.Queue() != v.ExpectedQueue {
+			t.Errorf("%s: wrong queue: expected=%#v had=%#v", v.Name, v.ExpectedQueue, f.Queue())
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("the names should be sorted: %#v", names)
+	}
+	for _, expected := range []string{"echo", "text", "format"} {
+		found := false
+		for _, n := range names {
+			found = found || n == expected
+		}
+		if !found {
+			t.Errorf("filter '%s' not found in %#v", expected, names)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	for _, name := range Names() {
+		s, ok := Describe(name)
+		if !ok {
+			t.Errorf("%s: schema not found", name)
+			continue
+		}
+		if s.Description == "" {
+			t.Errorf("%s: the schema should have a description", name)
+		}
+		for _, common := range []string{"retry", "retry_backoff", "retry_max_delay", "on_error"} {
+			if s.Get(common) == nil {
+				t.Errorf("%s: common parameter '%s' not found", name, common)
+			}
+		}
+		for _, p := range s.Params {
+			if p.Default != "" {
+				if err := p.Check(p.Default); err != nil {
+					t.Errorf("%s: wrong default: %s", name, err)
+				}
+			}
+		}
+	}
+
+	// the common parameters are not added to the registered schema
+	if s, _ := Describe("echo"); len(s.Params) != len(filterSchemas["echofilter"].Params)+len(commonParams) {
+		t.Errorf("wrong number of params: expected=%d had=%d", len(filterSchemas["echofilter"].Params)+len(commonParams), len(s.Params))
+	}
+	if _, ok := Describe("notexist"); ok {
+		t.Errorf("schema of a not registered filter should not be found")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/Matrix86/driplane/utils"
 
 	"github.com/evilsocket/islazy/log"
@@ -125,10 +126,25 @@ func (f *Cache) DoFilter(msg *data.Message) (bool, error) {
 func (f *Cache) OnEvent(event *data.Event) {
 	if event.Type == "shutdown" {
 		f.cache.Close()
+	} else if event.Type == "unload" && f.cacheName == "" {
+		// named caches are shared with other rules, so only the private one can be closed
+		f.cache.Close()
 	}
 }
 
 // Set the name of the filter
 func init() {
-	register("cache", NewCacheFilter)
+	register("cache", NewCacheFilter, schema.Schema{
+		Description: "keeps the received values in a TTL based cache and propagates only the ones not seen before",
+		Params: []schema.Param{
+			targetParam,
+			{Name: "refresh_on_get", Type: schema.Bool, Default: "true", Description: "the TTL is refreshed if the key has been looked up"},
+			{Name: "ttl", Type: schema.Duration, Default: "24h", Description: "how long after the key will be deleted"},
+			{Name: "sync_time", Type: schema.Duration, Default: "5m", Description: "how often the cache is written on file"},
+			{Name: "name", Type: schema.String, Description: "name of a global cache shared by all the rules"},
+			{Name: "global", Type: schema.Bool, Default: "false", Description: "share the cache with all the rules"},
+			{Name: "file", Type: schema.String, Description: "file used to load and store the cache"},
+			{Name: "ignore_first_run", Type: schema.Bool, Default: "false", Description: "propagate the messages of the first run of the feeder without caching them"},
+		},
+	})
 }
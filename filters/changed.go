@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 // Changed is a Filter that call the propagation method only if
@@ -62,5 +63,10 @@ func (f *Changed) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("changed", NewChangedFilter)
+	register("changed", NewChangedFilter, schema.Schema{
+		Description: "propagates the Message only if the target is different from the previous one",
+		Params: []schema.Param{
+			targetParam,
+		},
+	})
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 )
@@ -55,5 +56,12 @@ func (f *Echo) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("echo", NewEchoFilter)
+	register("echo", NewEchoFilter, schema.Schema{
+		Description: "prints the Message on the logs",
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "extra", Type: schema.Bool, Default: "false", Description: "print also all the extra fields"},
+			targetParam,
+		},
+	})
 }
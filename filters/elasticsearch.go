@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	elasticsearch "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
@@ -147,5 +148,16 @@ func (f *ElasticSearch) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("elasticsearch", NewElasticSearchFilter)
+	register("elasticsearch", NewElasticSearchFilter, schema.Schema{
+		Description: "writes the Message on ElasticSearch and returns the document ID",
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "address", Type: schema.String, Default: "localhost:9200", Description: "address of the ElasticSearch server"},
+			{Name: "username", Type: schema.String, Description: "username for the authentication"},
+			{Name: "password", Type: schema.String, Description: "password for the authentication"},
+			{Name: "index", Type: schema.String, Description: "index where the documents are written"},
+			{Name: "retries", Type: schema.Int, Default: "1", Description: "how many times the write is retried"},
+			targetParam,
+		},
+	})
 }
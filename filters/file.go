@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/evilsocket/islazy/log"
 )
 
@@ -52,5 +53,10 @@ func (f *File) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("file", NewFileFilter)
+	register("file", NewFileFilter, schema.Schema{
+		Description: "reads the file in the received path and returns its content",
+		Params: []schema.Param{
+			targetParam,
+		},
+	})
 }
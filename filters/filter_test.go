@@ -1,25 +1,33 @@
 package filters
 
-import "github.com/Matrix86/driplane/data"
+import (
+	"reflect"
+
+	"github.com/Matrix86/driplane/data"
+)
 
 type FakeBus struct {
 	Collected []*data.Message
+	Topics    []string
 }
 
 func NewFakeBus() *FakeBus {
 	return &FakeBus{
 		Collected: make([]*data.Message, 0),
+		Topics:    make([]string, 0),
 	}
 }
 
 func (b *FakeBus) Reset() {
 	b.Collected = make([]*data.Message, 0)
+	b.Topics = make([]string, 0)
 }
 
 func (b *FakeBus) Publish(topic string, args ...interface{}) {
 	for _, k := range args {
 		if v, ok := k.(*data.Message); ok {
 			b.Collected = append(b.Collected, v)
+			b.Topics = append(b.Topics, topic)
 		}
 	}
 }
@@ -31,3 +39,18 @@ func (b *FakeBus) SubscribeAsync(topic string, fn interface{}, transactional boo
 func (b *FakeBus) SubscribeOnce(topic string, fn interface{}) error                      { return nil }
 func (b *FakeBus) SubscribeOnceAsync(topic string, fn interface{}) error                 { return nil }
 func (b *FakeBus) Unsubscribe(topic string, handler interface{}) error                   { return nil }
+
+// sameMessages compares the fields of the Messages, ignoring their metadata
+func sameMessages(expected, had []*data.Message) bool {
+	if len(expected) != len(had) {
+		return false
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(expected[i].GetMessage(), had[i].GetMessage()) ||
+			!reflect.DeepEqual(expected[i].GetExtra(), had[i].GetExtra()) ||
+			expected[i].IsFirstRun() != had[i].IsFirstRun() {
+			return false
+		}
+	}
+	return true
+}
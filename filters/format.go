@@ -8,6 +8,7 @@ import (
 	text "text/template"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 // Format is a Filter that apply a Golang Template to the input Message
@@ -103,5 +104,14 @@ func (f *Format) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("format", NewFormatFilter)
+	register("format", NewFormatFilter, schema.Schema{
+		Description: "formats the Message with a Golang template",
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "type", Type: schema.String, Default: "text", Description: "type of template to use", Values: []string{"text", "html"}},
+			{Name: "template", Type: schema.String, Description: "the template to use"},
+			{Name: "file", Type: schema.String, Description: "file containing the template to use"},
+			targetParam,
+		},
+	})
 }
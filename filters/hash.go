@@ -5,6 +5,7 @@ import (
 	"regexp"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 // Hash is a Filter that searches for hashes in the Message
@@ -109,5 +110,16 @@ func (f *Hash) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("hash", NewHashFilter)
+	register("hash", NewHashFilter, schema.Schema{
+		Description: "searches or extracts hashes from the Message",
+		Fields:      []string{"fulltext"},
+		Params: []schema.Param{
+			targetParam,
+			{Name: "extract", Type: schema.Bool, Default: "false", Description: "the main field of the output Message will be the extracted hash"},
+			{Name: "md5", Type: schema.Bool, Default: "true", Description: "search md5 hashes"},
+			{Name: "sha1", Type: schema.Bool, Default: "true", Description: "search sha1 hashes"},
+			{Name: "sha256", Type: schema.Bool, Default: "true", Description: "search sha256 hashes"},
+			{Name: "sha512", Type: schema.Bool, Default: "true", Description: "search sha512 hashes"},
+		},
+	})
 }
@@ -3,6 +3,7 @@ package filters
 import (
 	"fmt"
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/PuerkitoBio/goquery"
 	"strings"
 
@@ -110,5 +111,14 @@ func (f *HTML) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("html", NewHTMLFilter)
+	register("html", NewHTMLFilter, schema.Schema{
+		Description: "extracts information from an HTML page",
+		Fields:      []string{"fulltext"},
+		Params: []schema.Param{
+			targetParam,
+			{Name: "selector", Type: schema.String, Description: "the selector to find in the HTML page"},
+			{Name: "get", Type: schema.String, Default: "html", Description: "what to retrieve from the selected tags", Values: []string{"html", "text", "attr"}},
+			{Name: "attr", Type: schema.String, Description: "name of the attribute to extract if get is attr"},
+		},
+	})
 }
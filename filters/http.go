@@ -15,6 +15,7 @@ import (
 	"text/template"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/Matrix86/driplane/utils"
 
 	"github.com/evilsocket/islazy/log"
@@ -26,6 +27,7 @@ type HTTP struct {
 
 	urlFromInput bool
 	textOnly     bool
+	decodeJSON   bool
 	getBody      bool
 	checkStatus  int
 	method       string
@@ -58,6 +60,12 @@ func NewHTTPFilter(p map[string]string) (Filter, error) {
 	if v, ok := f.params["text_only"]; ok && v == "true" {
 		f.textOnly = true
 	}
+	if v, ok := f.params["decode"]; ok {
+		if v != "json" {
+			return nil, fmt.Errorf("decode: unknown format '%s'", v)
+		}
+		f.decodeJSON = true
+	}
 	if v, ok := f.params["url"]; ok {
 		t, err := template.New("httpFilterUrlString").Parse(v)
 		if err != nil {
@@ -211,6 +219,13 @@ func (f *HTTP) DoFilter(msg *data.Message) (bool, error) {
 			txt := f.readBody(r)
 			if f.textOnly {
 				txt = utils.ExtractTextFromHTML(string(txt.([]byte)))
+			} else if f.decodeJSON {
+				// the objects and the arrays can be read with a path by the next filters
+				var decoded interface{}
+				if err := json.Unmarshal(txt.([]byte), &decoded); err != nil {
+					return false, fmt.Errorf("decoding the response as JSON: %s", err)
+				}
+				txt = decoded
 			}
 			msg.SetMessage(txt)
 		}
@@ -234,5 +249,19 @@ func (f *HTTP) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("http", NewHTTPFilter)
+	register("http", NewHTTPFilter, schema.Schema{
+		Description: "sends HTTP requests",
+		Params: []schema.Param{
+			{Name: "url", Type: schema.String, Description: "URL of the request (supports templates)"},
+			{Name: "download_to", Type: schema.String, Description: "path where the response body is downloaded (supports templates)"},
+			{Name: "text_only", Type: schema.Bool, Default: "false", Description: "remove all the tags from the body of the response"},
+			{Name: "decode", Type: schema.String, Values: []string{"json"}, Description: "decode the body of the response, the JSON objects and arrays are set in main as maps and lists"},
+			{Name: "method", Type: schema.String, Default: "GET", Description: "HTTP method of the request"},
+			{Name: "headers", Type: schema.Map, Description: "headers of the request"},
+			{Name: "data", Type: schema.Map, Description: "POST fields of the request (supports templates)"},
+			{Name: "rawData", Type: schema.String, Description: "raw body of the request (supports templates)"},
+			{Name: "status", Type: schema.Int, Description: "propagate the Message only if the response has this status"},
+			{Name: "cookies", Type: schema.String, Description: "path of the JSON file containing the cookies to use"},
+		},
+	})
 }
@@ -305,6 +305,55 @@ func TestHTTPDoFilterTextOnly(t *testing.T) {
 	}
 }
 
+func TestHTTPDoFilterDecodeJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"user": {"id": 7, "tags": ["a", "b"]}}`)
+	}))
+	defer ts.Close()
+
+	filter, err := NewHTTPFilter(map[string]string{
+		"url":    ts.URL,
+		"decode": "json",
+	})
+	if err != nil {
+		t.Fatalf("constructor returned error: %s", err)
+	}
+	f := filter.(*HTTP)
+	msg := data.NewMessage("test")
+	ok, err := f.DoFilter(msg)
+	if err != nil {
+		t.Fatalf("DoFilter returned error: %s", err)
+	}
+	if !ok {
+		t.Errorf("DoFilter should return true")
+	}
+	if id := msg.GetTarget("main.user.id"); id != 7.0 {
+		t.Errorf("expected main.user.id 7, got '%v'", id)
+	}
+	if tag := msg.GetTarget("main.user.tags[1]"); tag != "b" {
+		t.Errorf("expected main.user.tags[1] 'b', got '%v'", tag)
+	}
+}
+
+func TestHTTPDoFilterDecodeInvalidJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "not json")
+	}))
+	defer ts.Close()
+
+	if _, err := NewHTTPFilter(map[string]string{"url": ts.URL, "decode": "xml"}); err == nil {
+		t.Errorf("constructor should return an error for an unknown format")
+	}
+	filter, _ := NewHTTPFilter(map[string]string{
+		"url":    ts.URL,
+		"decode": "json",
+	})
+	f := filter.(*HTTP)
+	if ok, err := f.DoFilter(data.NewMessage("test")); err == nil || ok {
+		t.Errorf("DoFilter should return an error if the body is not JSON")
+	}
+}
+
 func TestHTTPDoFilterURLTemplate(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "templated")
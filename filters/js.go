@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/plugin"
 	"github.com/robertkrimen/otto"
@@ -75,13 +76,13 @@ func (f *Js) jsResponse2Msg(obj interface{}, msg *data.Message) {
 		msg.SetMessage(t)
 
 	case map[string]interface{}:
-		for key, vi := range t {
-			if value, ok := vi.(string); ok {
-				if key == "main" {
-					msg.SetMessage(value)
-				} else {
-					msg.SetExtra(key, value)
-				}
+		// the objects and the arrays returned by the plugin are kept as maps and lists,
+		// the keys can be paths to set a value inside them
+		for key, value := range t {
+			if key == "main" {
+				msg.SetMessage(value)
+			} else {
+				msg.SetTarget(key, value)
 			}
 		}
 	}
@@ -111,7 +112,7 @@ func (f *Js) DoFilter(msg *data.Message) (bool, error) {
 
 				if triggered {
 					if v, ok := result["data"]; ok {
-						if array, ok := v.([]map[string]interface {}); ok {
+						if array, ok := data.AsList(v); ok {
 							triggered = false // avoiding to send the original message more than once
 							for _, x := range array {
 								clone := msg.Clone()
@@ -137,5 +138,12 @@ func (f *Js) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("js", NewJsFilter)
+	register("js", NewJsFilter, schema.Schema{
+		Description:   "calls a function of a JavaScript plugin",
+		DynamicFields: true,
+		Params: []schema.Param{
+			{Name: "path", Type: schema.String, Required: true, Description: "path of the JavaScript file"},
+			{Name: "function", Type: schema.String, Description: "function called for each Message"},
+		},
+	})
 }
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/Matrix86/driplane/data"
+
+	"github.com/asaskevich/EventBus"
 )
 
 func TestNewJsFilterMissingPath(t *testing.T) {
@@ -252,6 +254,54 @@ func TestJsDoFilterWithMapData(t *testing.T) {
 	}
 }
 
+func TestJsDoFilterWithStructuredData(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "jsfilter_structured_*")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	jsContent := `function DoFilter(text, extra, params) {
+		return { "filtered": true, "data": [
+			{"main": {"id": text.user.id}, "user.name": "first"},
+			{"main": "second", "tags": ["a", "b"]}
+		] };
+	}`
+	jsFile := filepath.Join(tmpDir, "structured.js")
+	os.WriteFile(jsFile, []byte(jsContent), 0644)
+
+	filter, err := NewJsFilter(map[string]string{
+		"path": jsFile,
+	})
+	if err != nil {
+		t.Fatalf("constructor returned error: %s", err)
+	}
+
+	f := filter.(*Js)
+	fb := NewFakeBus()
+	f.setBus(EventBus.Bus(fb))
+	msg := data.NewMessage(map[string]interface{}{"user": map[string]interface{}{"id": "u1"}})
+	ok, err := f.DoFilter(msg)
+	if err != nil {
+		t.Fatalf("DoFilter returned error: %s", err)
+	}
+	if ok {
+		t.Errorf("DoFilter should return false when the messages are propagated one by one")
+	}
+	if len(fb.Collected) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(fb.Collected))
+	}
+	if id := fb.Collected[0].GetTarget("main.id"); id != "u1" {
+		t.Errorf("expected main.id 'u1', got '%v'", id)
+	}
+	if name := fb.Collected[0].GetTarget("user.name"); name != "first" {
+		t.Errorf("expected user.name 'first', got '%v'", name)
+	}
+	if tag := fb.Collected[1].GetTarget("tags[1]"); tag != "b" {
+		t.Errorf("expected tags[1] 'b', got '%v'", tag)
+	}
+}
+
 func TestJsOnEvent(t *testing.T) {
 	tmpDir, _ := os.MkdirTemp("", "jsfilter_event_*")
 	defer os.RemoveAll(tmpDir)
@@ -1,11 +1,13 @@
 package filters
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/antchfx/jsonquery"
 	"github.com/evilsocket/islazy/log"
@@ -18,6 +20,7 @@ type JSON struct {
 
 	selector string
 	target   string
+	output   string
 
 	params map[string]string
 }
@@ -27,6 +30,7 @@ func NewJSONFilter(p map[string]string) (Filter, error) {
 	f := &JSON{
 		params:   p,
 		target:   "main",
+		output:   "main",
 		selector: "",
 	}
 	f.cbFilter = f.DoFilter
@@ -41,6 +45,9 @@ func NewJSONFilter(p map[string]string) (Filter, error) {
 	if v, ok := f.params["target"]; ok {
 		f.target = v
 	}
+	if v, ok := f.params["output"]; ok {
+		f.output = v
+	}
 
 	return f, nil
 }
@@ -50,21 +57,33 @@ func (f *JSON) DoFilter(msg *data.Message) (bool, error) {
 	//var err error
 	var text string
 
-	if v, ok := msg.GetTarget(f.target).(string); ok {
+	target := msg.GetTarget(f.target)
+	_, isMap := data.AsMap(target)
+	_, isList := data.AsList(target)
+	switch v := target.(type) {
+	case string:
 		text = str.Trim(v)
-	} else if v, ok := msg.GetTarget(f.target).([]byte); ok {
-		text = string(v)
-	} else {
-		// ERROR this filter can't be used with different types
-		return false, fmt.Errorf("received data is not a string")
+	case []byte:
+		text = str.Trim(string(v))
+	default:
+		if !isMap && !isList {
+			// ERROR this filter can't be used with different types
+			return false, fmt.Errorf("received data is not a string")
+		}
+		// the structured data set by the filters before are searched as a JSON document
+		raw, err := json.Marshal(target)
+		if err != nil {
+			return false, fmt.Errorf("received data can't be encoded in JSON: %s", err)
+		}
+		text = string(raw)
 	}
 
 	if len(text) > 0 {
 		var jsonData string
 
-		if text[0] == '{' {
+		if text[0] == '{' || text[0] == '[' {
 			// json text
-			jsonData = str.Trim(text)
+			jsonData = text
 		} else {
 			log.Error("'%v' is not a json document", text)
 			return false, nil
@@ -75,7 +94,8 @@ func (f *JSON) DoFilter(msg *data.Message) (bool, error) {
 			for _, node := range jsonquery.Find(doc, f.selector) {
 				atLeastOne = true
 				clone := msg.Clone()
-				clone.SetMessage(node.Value())
+				// objects and arrays are propagated as maps and lists
+				clone.SetTarget(f.output, node.Value())
 				f.Propagate(clone)
 			}
 
@@ -96,5 +116,12 @@ func (f *JSON) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("json", NewJSONFilter)
+	register("json", NewJSONFilter, schema.Schema{
+		Description: "extracts information from a JSON document",
+		Params: []schema.Param{
+			targetParam,
+			{Name: "selector", Type: schema.String, Required: true, Description: "the selector to find the data in the JSON"},
+			{Name: "output", Type: schema.String, Default: "main", Description: "the field or the path where the data found is set, objects and arrays are set as maps and lists", Output: true},
+		},
+	})
 }
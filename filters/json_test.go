@@ -242,3 +242,65 @@ func TestJSON_DoFilterOnBadJSON(t *testing.T) {
 		t.Errorf("cannot cast to proper Filter...")
 	}
 }
+
+func TestJSON_DoFilterStructured(t *testing.T) {
+	filter, err := NewJSONFilter(map[string]string{
+		"selector": "items/*",
+		"target":   "payload",
+		"output":   "item",
+	})
+	if err != nil {
+		t.Errorf("constructor returned '%s'", err)
+	}
+	if e, ok := filter.(*JSON); ok {
+		fb := NewFakeBus()
+		filter.setBus(EventBus.Bus(fb))
+
+		m := data.NewMessageWithExtra("text", map[string]interface{}{
+			"payload": map[string]interface{}{"items": []interface{}{map[string]interface{}{"id": 1.0}, map[string]interface{}{"id": 2.0}}},
+		})
+		x, err := e.DoFilter(m)
+		if err != nil {
+			t.Errorf("DoFilter returned an error '%s'", err)
+		}
+		if !x {
+			t.Errorf("DoFilter should return true")
+		}
+		if len(fb.Collected) != 2 {
+			t.Fatalf("wrong number of messages: expected=%#v had=%#v", 2, len(fb.Collected))
+		}
+		for i, c := range fb.Collected {
+			if c.GetMessage() != "text" {
+				t.Errorf("the main field has been altered by the filter")
+			}
+			if id := c.GetTarget("item.id"); id != float64(i+1) {
+				t.Errorf("wrong item: expected=%#v had=%#v", float64(i+1), id)
+			}
+		}
+	} else {
+		t.Errorf("cannot cast to proper Filter...")
+	}
+}
+
+func TestJSON_DoFilterOnArray(t *testing.T) {
+	filter, err := NewJSONFilter(map[string]string{
+		"selector": "*/name",
+	})
+	if err != nil {
+		t.Errorf("constructor returned '%s'", err)
+	}
+	if e, ok := filter.(*JSON); ok {
+		fb := NewFakeBus()
+		filter.setBus(EventBus.Bus(fb))
+
+		m := data.NewMessage(`[{"name": "a"}, {"name": "b"}]`)
+		if _, err := e.DoFilter(m); err != nil {
+			t.Errorf("DoFilter returned an error '%s'", err)
+		}
+		if len(fb.Collected) != 2 || fb.Collected[0].GetMessage() != "a" || fb.Collected[1].GetMessage() != "b" {
+			t.Errorf("names have not been extracted correctly")
+		}
+	} else {
+		t.Errorf("cannot cast to proper Filter...")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"text/template"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	anyllm "github.com/mozilla-ai/any-llm-go"
 	"github.com/mozilla-ai/any-llm-go/providers"
@@ -246,5 +247,20 @@ func (f *LLM) OnEvent(event *data.Event) {}
 
 // init registers the filter
 func init() {
-	register("llm", NewLLMFilter)
+	register("llm", NewLLMFilter, schema.Schema{
+		Description: "sends the Message to a Large Language Model and propagates the response",
+		Fields:      []string{"llm_model", "llm_prompt_tokens", "llm_completion_tokens", "llm_total_tokens", "llm_raw_response"},
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "model", Type: schema.String, Required: true, Description: "the model name to use"},
+			{Name: "prompt", Type: schema.String, Required: true, Description: "the user prompt sent to the model (supports templates)"},
+			{Name: "system_prompt", Type: schema.String, Description: "the system prompt (supports templates)"},
+			{Name: "provider", Type: schema.String, Default: "openai", Description: "the LLM provider to use", Values: []string{"openai", "anthropic", "ollama", "deepseek", "groq", "mistral", "gemini", "llamacpp", "llamafile"}},
+			{Name: "api_key", Type: schema.String, Description: "API key for the provider"},
+			{Name: "api_url", Type: schema.String, Description: "custom base URL of the API"},
+			{Name: "temperature", Type: schema.Number, Default: "0.7", Description: "sampling temperature of the model"},
+			{Name: "max_tokens", Type: schema.Int, Default: "1024", Description: "maximum number of tokens in the response"},
+			targetParam,
+		},
+	})
 }
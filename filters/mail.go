@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/evilsocket/islazy/log"
 
 	gomail "gopkg.in/gomail.v2"
@@ -134,5 +135,20 @@ func (f *Mail) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("mail", NewMailFilter)
+	register("mail", NewMailFilter, schema.Schema{
+		Description: "sends an e-mail",
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "body", Type: schema.String, Description: "body of the e-mail (supports templates)"},
+			{Name: "username", Type: schema.String, Description: "username for the host authentication"},
+			{Name: "password", Type: schema.String, Description: "password for the host authentication"},
+			{Name: "host", Type: schema.String, Description: "host of the server used to send the e-mail"},
+			{Name: "port", Type: schema.Int, Description: "port of the server"},
+			{Name: "fromAddr", Type: schema.String, Description: "source e-mail address"},
+			{Name: "fromName", Type: schema.String, Description: "source name"},
+			{Name: "to", Type: schema.String, Description: "destination e-mail addresses, comma separated"},
+			{Name: "subject", Type: schema.String, Description: "subject of the e-mail"},
+			{Name: "use_auth", Type: schema.Bool, Default: "false", Description: "send the credentials to the server"},
+		},
+	})
 }
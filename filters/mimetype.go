@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"text/template"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -75,5 +76,13 @@ func (f *Mimetype) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("mime", NewMimetypeFilter)
+	register("mime", NewMimetypeFilter, schema.Schema{
+		Description: "detects the MIME type and the extension of a file",
+		Fields:      []string{"mimetype_ext", "fulltext"},
+		PassThrough: true,
+		Params: []schema.Param{
+			targetParam,
+			{Name: "filename", Type: schema.String, Description: "the file to detect (supports templates)"},
+		},
+	})
 }
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 // Number is a Filter to treat a string from the input Message as numeric value and apply some operator on it
@@ -144,5 +145,12 @@ func (f *Number) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("number", NewNumberFilter)
+	register("number", NewNumberFilter, schema.Schema{
+		Description: "compares a numeric field of the Message with a value",
+		Params: []schema.Param{
+			targetParam,
+			{Name: "op", Type: schema.String, Description: "the compare operator", Values: []string{">", ">=", "<", "<=", "!=", "=="}},
+			{Name: "value", Type: schema.Number, Description: "the number to compare with"},
+		},
+	})
 }
@@ -7,8 +7,6 @@ import (
 	"github.com/asaskevich/EventBus"
 
 	"github.com/Matrix86/driplane/data"
-
-	"github.com/stretchr/testify/assert"
 )
 
 func TestNewNumberFilter(t *testing.T) {
@@ -116,11 +114,11 @@ func TestNumber_DoFilter(t *testing.T) {
 					t.Errorf("%s: wrong error: expected=nil had=%#v", v.Name, err)
 				}
 				if v.MultipleMessage {
-					if assert.Equal(t, fb.Collected, v.ExpectedMessages) == false {
+					if !sameMessages(v.ExpectedMessages, fb.Collected) {
 						t.Errorf("%s: wrong: expected=%#v had=%#v", v.Name, v.ExpectedMessages, fb.Collected)
 					}
 				} else {
-					if len(v.ExpectedMessages) != 0 && assert.Equal(t, v.ExpectedMessages[0], orig) == false {
+					if len(v.ExpectedMessages) != 0 && !sameMessages(v.ExpectedMessages[:1], []*data.Message{orig}) {
 						t.Errorf("%s: wrong: expected=%#v had=%#v", v.Name, v.ExpectedMessages, fb.Collected)
 					}
 				}
@@ -4,6 +4,7 @@ import (
 	"text/template"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 )
@@ -68,5 +69,12 @@ func (f *Override) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("override", NewOverrideFilter)
+	register("override", NewOverrideFilter, schema.Schema{
+		Description: "changes a field of the Message",
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "name", Type: schema.String, Output: true, Description: "name of the field to change (supports templates)"},
+			{Name: "value", Type: schema.String, Description: "new value of the field (supports templates)"},
+		},
+	})
 }
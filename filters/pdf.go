@@ -6,6 +6,7 @@ import (
 	"text/template"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/ledongthuc/pdf"
 )
@@ -98,5 +99,13 @@ func (f *PDF) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("pdf", NewPDFFilter)
+	register("pdf", NewPDFFilter, schema.Schema{
+		Description: "extracts the text from a PDF file",
+		Fields:      []string{"fulltext"},
+		PassThrough: true,
+		Params: []schema.Param{
+			targetParam,
+			{Name: "filename", Type: schema.String, Description: "the PDF file to parse (supports templates)"},
+		},
+	})
 }
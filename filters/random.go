@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 )
@@ -72,5 +73,13 @@ func (f *Random) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("random", NewRandomFilter)
+	register("random", NewRandomFilter, schema.Schema{
+		Description: "injects a random number in the Message",
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "output", Type: schema.String, Default: "main", Description: "the field of the Message that will contain the number", Output: true},
+			{Name: "min", Type: schema.Int, Default: "0", Description: "min value of the number"},
+			{Name: "max", Type: schema.Int, Default: "999999", Description: "max value of the number"},
+		},
+	})
 }
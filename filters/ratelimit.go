@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/evilsocket/islazy/log"
 	"golang.org/x/time/rate"
 )
@@ -59,13 +60,18 @@ func (f *RateLimit) DoFilter(msg *data.Message) (bool, error) {
 
 // OnEvent is called when an event occurs
 func (f *RateLimit) OnEvent(event *data.Event) {
-	if event.Type == "shutdown" {
-		log.Debug("shutdown event received")
+	if event.Type == "shutdown" || event.Type == "unload" {
+		log.Debug("%s event received", event.Type)
 		f.cancelContext()
 	}
 }
 
 // Set the name of the filter
 func init() {
-	register("ratelimit", NewRateLimitFilter)
+	register("ratelimit", NewRateLimitFilter, schema.Schema{
+		Description: "limits the number of Messages per second going through it",
+		Params: []schema.Param{
+			{Name: "rate", Type: schema.Int, Default: "0", Description: "how many Messages per second are propagated"},
+		},
+	})
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/slack-go/slack"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 	"github.com/Matrix86/driplane/utils"
 )
 
@@ -343,5 +344,17 @@ func (f *Slack) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("slack", NewSlackFilter)
+	register("slack", NewSlackFilter, schema.Schema{
+		Description: "sends messages and files and downloads files from Slack",
+		Params: []schema.Param{
+			{Name: "action", Type: schema.String, Default: "send_message", Description: "action to perform", Values: []string{"send_message", "send_file", "download_file", "user_info"}},
+			{Name: "botToken", Type: schema.String, Description: "Slack bot token"},
+			{Name: "to", Type: schema.String, Description: "channel or user receiving the message (supports templates)"},
+			{Name: "text", Type: schema.String, Description: "text of the message (supports templates)"},
+			{Name: "blocks", Type: schema.Bool, Default: "false", Description: "the text contains Slack blocks"},
+			{Name: "filename", Type: schema.String, Description: "path of the file to send or to download to (supports templates)"},
+			{Name: "url", Type: schema.String, Description: "Slack private url of the file to download (supports templates)"},
+			targetParam,
+		},
+	})
 }
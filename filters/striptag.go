@@ -5,6 +5,7 @@ import (
 	"github.com/Matrix86/driplane/utils"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 // StripTag is a filter that removes HTML tags from a text.
@@ -53,5 +54,12 @@ func (f *StripTag) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("striptag", NewStripTagFilter)
+	register("striptag", NewStripTagFilter, schema.Schema{
+		Description: "removes the HTML tags from the Message",
+		Fields:      []string{"fulltext"},
+		PassThrough: true,
+		Params: []schema.Param{
+			targetParam,
+		},
+	})
 }
@@ -5,6 +5,7 @@ import (
 	"text/template"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/evilsocket/islazy/log"
 )
@@ -61,5 +62,11 @@ func (f *System) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("system", NewSystemFilter)
+	register("system", NewSystemFilter, schema.Schema{
+		Description: "executes a command on the host for each Message",
+		PassThrough: true,
+		Params: []schema.Param{
+			{Name: "cmd", Type: schema.String, Description: "command to execute (supports templates)"},
+		},
+	})
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/gotd/td/tg"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 const dateLayout = "2006-01-02_15-04-05"
@@ -308,5 +309,15 @@ func (f *Telegram) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("telegram", NewTelegramFilter)
+	register("telegram", NewTelegramFilter, schema.Schema{
+		Description: "sends messages and downloads files from Telegram",
+		Fields:      []string{"msg_filename"},
+		Params: []schema.Param{
+			{Name: "action", Type: schema.String, Default: "send_message", Description: "action to perform", Values: []string{"send_message", "download_file"}},
+			{Name: "to", Type: schema.String, Description: "username or phone number of the recipient (supports templates)"},
+			{Name: "to_chatid", Type: schema.String, Description: "chat receiving the message"},
+			{Name: "text", Type: schema.String, Description: "text of the message (supports templates)"},
+			{Name: "filename", Type: schema.String, Description: "path where the file is downloaded (supports templates)"},
+		},
+	})
 }
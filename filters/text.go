@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 // Text is a Filter to search and extract strings from the input Message
@@ -112,5 +113,14 @@ func (f *Text) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("text", NewTextFilter)
+	register("text", NewTextFilter, schema.Schema{
+		Description: "searches or extracts strings from the Message",
+		Fields:      []string{"fulltext"},
+		Params: []schema.Param{
+			targetParam,
+			{Name: "pattern", Type: schema.String, Required: true, Description: "the string or the regular expression to match"},
+			{Name: "regexp", Type: schema.Bool, Default: "false", Description: "the pattern is a regular expression"},
+			{Name: "extract", Type: schema.Bool, Default: "false", Description: "the main field of the output Message will be the extracted string"},
+		},
+	})
 }
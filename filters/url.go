@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 )
 
 // URL is a Filter to search urls in the input Message
@@ -103,5 +104,15 @@ func (f *URL) OnEvent(event *data.Event){}
 
 // Set the name of the filter
 func init() {
-	register("url", NewURLFilter)
+	register("url", NewURLFilter, schema.Schema{
+		Description: "searches or extracts URLs from the Message",
+		Fields:      []string{"fulltext"},
+		Params: []schema.Param{
+			targetParam,
+			{Name: "http", Type: schema.Bool, Default: "true", Description: "search http URLs"},
+			{Name: "https", Type: schema.Bool, Default: "true", Description: "search https URLs"},
+			{Name: "ftp", Type: schema.Bool, Default: "true", Description: "search ftp URLs"},
+			{Name: "extract", Type: schema.Bool, Default: "true", Description: "the main field of the output Message will be the extracted URL"},
+		},
+	})
 }
@@ -7,6 +7,7 @@ import (
 	"text/template"
 
 	"github.com/Matrix86/driplane/data"
+	"github.com/Matrix86/driplane/schema"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -107,5 +108,13 @@ func (f *XLS) OnEvent(event *data.Event) {}
 
 // Set the name of the filter
 func init() {
-	register("xls", NewXLSFilter)
+	register("xls", NewXLSFilter, schema.Schema{
+		Description: "extracts the content of an Excel file",
+		Fields:      []string{"xls_sheet", "xls_filename"},
+		PassThrough: true,
+		Params: []schema.Param{
+			targetParam,
+			{Name: "filename", Type: schema.String, Description: "the file to parse (supports templates)"},
+		},
+	})
 }
@@ -0,0 +1,602 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Matrix86/driplane/core"
+	"github.com/Matrix86/driplane/feeders"
+	"github.com/Matrix86/driplane/filters"
+	"github.com/Matrix86/driplane/schema"
+)
+
+var importRegexp = regexp.MustCompile(`^#import\s+"([^"]+)"`)
+
+// Kinds of the elements found in a position of a rule file
+const (
+	ctxNone = iota
+	// name of the rule being defined
+	ctxRuleName
+	ctxFilter
+	ctxFeeder
+	// rule called with @
+	ctxRule
+	ctxParam
+	ctxFeederParam
+	// argument of a call to a rule with parameters
+	ctxArg
+	ctxValue
+	// variable referenced with $
+	ctxVariable
+)
+
+// frame is a bracket opened before the position
+type frame struct {
+	open string
+	// ctxParam, ctxFeederParam or ctxArg if the bracket contains parameters, ctxFilter if it contains pipelines
+	kind int
+	// filter, feeder or rule receiving the parameters
+	owner string
+	// parameters written in the bracket
+	params []string
+}
+
+// cursor describes a position of a rule file
+type cursor struct {
+	kind int
+	// identifier under the position, nil if there is none
+	token *core.Token
+	// part of the identifier before the position
+	prefix string
+	// frame containing the parameter or the value
+	frame *frame
+	// parameter receiving the value
+	param string
+	// the value is inside a string
+	quoted bool
+	// rule defined around the position
+	rule string
+}
+
+// locate finds the kind of element in the offset of the text, using only the tokens before it: it works also while the text cannot be parsed
+func locate(text string, offset int) cursor {
+	tokens, _ := core.Tokenize(text)
+	c := cursor{}
+	prev := tokens
+	for i := range tokens {
+		t := &tokens[i]
+		start, end := t.Pos.Offset, t.Pos.Offset+len(t.Value)
+		if t.Type == "Ident" && start <= offset && offset <= end {
+			c.token, c.prefix, prev = t, t.Value[:offset-start], tokens[:i]
+			break
+		}
+		if t.Type == "String" && start < offset && offset < end {
+			c.token, c.prefix, c.quoted, prev = t, t.Value[1:offset-start], true, tokens[:i]
+			break
+		}
+		if start >= offset {
+			prev = tokens[:i]
+			break
+		}
+	}
+
+	stack := make([]*frame, 0)
+	top := func() *frame {
+		if len(stack) == 0 {
+			return nil
+		}
+		return stack[len(stack)-1]
+	}
+	value := func(i int) string {
+		if i < 0 || i >= len(prev) {
+			return ""
+		}
+		return prev[i].Value
+	}
+	ruleStart, ruleIndex := true, -1
+	for i, t := range prev {
+		if t.Type == "Ident" {
+			if len(stack) == 0 && ruleStart {
+				c.rule, ruleStart, ruleIndex = t.Value, false, i
+			} else if f := top(); f != nil && f.open == "<" && f.owner == "" {
+				f.owner = t.Value
+			}
+			continue
+		}
+		if t.Type != "Punct" {
+			continue
+		}
+		switch t.Value {
+		case "(":
+			kind := ctxParam
+			if value(i-2) == "@" {
+				kind = ctxArg
+			} else if len(stack) == 0 && i == ruleIndex+1 {
+				// parameters of the rule being defined
+				kind = ctxNone
+			}
+			stack = append(stack, &frame{open: "(", kind: kind, owner: value(i - 1)})
+		case "<":
+			stack = append(stack, &frame{open: "<", kind: ctxFeederParam})
+		case "[":
+			stack = append(stack, &frame{open: "["})
+		case "{":
+			kind := ctxFilter
+			if p := value(i - 1); p == "=" || p == ":" || p == "[" || p == "," {
+				kind = ctxNone
+			}
+			stack = append(stack, &frame{open: "{", kind: kind})
+		case ">", ")", "]", "}":
+			opening := map[string]string{">": "<", ")": "(", "]": "[", "}": "{"}[t.Value]
+			if f := top(); f != nil && f.open == opening {
+				stack = stack[:len(stack)-1]
+			}
+		case "=":
+			if f := top(); f != nil && (f.open == "(" || f.open == "<") && i > 0 && prev[i-1].Type == "Ident" {
+				f.params = append(f.params, prev[i-1].Value)
+			}
+		case ";":
+			if len(stack) == 0 {
+				ruleStart, c.rule = true, ""
+			}
+		}
+	}
+
+	n := len(prev)
+	if n > 0 && prev[n-1].Value == "\"" && prev[n-1].Type == "Punct" {
+		// unterminated string: the value is being written
+		c.quoted = true
+		n--
+	}
+	t1, t2 := value(n-1), value(n-2)
+	f := top()
+	switch {
+	case n == 0 || (t1 == ";" && f == nil):
+		c.kind = ctxRuleName
+	case t1 == "@":
+		c.kind = ctxRule
+	case t1 == "$":
+		c.kind = ctxVariable
+	case t1 == "<":
+		c.kind = ctxFeeder
+	case t1 == "=" && t2 != "" && prev[n-2].Type == "Ident" && f != nil && (f.open == "(" || f.open == "<"):
+		c.kind, c.frame, c.param = ctxValue, f, t2
+	case c.quoted:
+		c.kind = ctxNone
+	case (t1 == ">" && t2 == "=" && f == nil) || t1 == "|" || t1 == "!" || t1 == "if":
+		c.kind = ctxFilter
+	case (t1 == "{" || t1 == ";") && f != nil && f.open == "{" && f.kind == ctxFilter:
+		c.kind = ctxFilter
+	case (t1 == "(" || t1 == ",") && f != nil && f.open == "(":
+		c.kind, c.frame = f.kind, f
+	case (t1 == ":" || t1 == ",") && f != nil && f.open == "<":
+		c.kind, c.frame = ctxFeederParam, f
+	}
+	return c
+}
+
+// ruleDef is a rule defined in a file
+type ruleDef struct {
+	file string
+	node *core.RuleNode
+}
+
+// visibleRules returns the rules that can be called from the file: the ones of the imported files first, as they are searched by driplane
+func visibleRules(file string, ast *core.AST) []ruleDef {
+	defs := make([]ruleDef, 0)
+	seen := make(map[string]bool)
+	var collect func(file string, ast *core.AST)
+	collect = func(file string, ast *core.AST) {
+		if seen[file] {
+			return
+		}
+		seen[file] = true
+		deps := make([]string, 0, len(ast.Dependencies))
+		for dep := range ast.Dependencies {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			collect(dep, ast.Dependencies[dep])
+		}
+		for _, rule := range ast.Rules {
+			defs = append(defs, ruleDef{file: file, node: rule})
+		}
+	}
+	if ast != nil {
+		collect(file, ast)
+	}
+
+	// the rules with the same name are shadowed by the first one
+	result := make([]ruleDef, 0, len(defs))
+	names := make(map[string]bool)
+	for _, d := range defs {
+		if !names[d.node.Identifier] {
+			names[d.node.Identifier] = true
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func findRule(file string, ast *core.AST, name string) *ruleDef {
+	for _, d := range visibleRules(file, ast) {
+		if d.node.Identifier == name {
+			return &d
+		}
+	}
+	return nil
+}
+
+// visibleDefines returns the variables defined in the file and in the imported ones
+func visibleDefines(ast *core.AST) []string {
+	names := make([]string, 0)
+	var collect func(ast *core.AST)
+	collect = func(ast *core.AST) {
+		for name := range ast.Defines {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		for _, dep := range ast.Dependencies {
+			collect(dep)
+		}
+	}
+	if ast != nil {
+		collect(ast)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describe returns the schema of the filter or of the feeder owning the parameters of the frame
+func describe(f *frame) (schema.Schema, bool) {
+	if f.kind == ctxFeederParam {
+		return feeders.Describe(f.owner)
+	}
+	return filters.Describe(f.owner)
+}
+
+// completion returns the suggestions for the identifier in the position
+func (s *Server) completion(doc *document, pos Position) []CompletionItem {
+	c := locate(doc.text, offsetAt(doc.text, pos))
+	items := make([]CompletionItem, 0)
+	add := func(item CompletionItem) {
+		if strings.HasPrefix(item.Label, c.prefix) {
+			items = append(items, item)
+		}
+	}
+
+	switch c.kind {
+	case ctxFilter:
+		for _, name := range filters.Names() {
+			sch, _ := filters.Describe(name)
+			add(CompletionItem{Label: name, Kind: KindFunction, Detail: "filter", Documentation: markdown(sch.Description)})
+		}
+	case ctxFeeder:
+		for _, name := range feeders.Names() {
+			sch, _ := feeders.Describe(name)
+			add(CompletionItem{Label: name, Kind: KindModule, Detail: "feeder", Documentation: markdown(sch.Description)})
+		}
+	case ctxRule:
+		for _, d := range visibleRules(doc.path, doc.ast) {
+			add(CompletionItem{Label: d.node.Identifier, Kind: KindReference, Detail: signature(d.node), Documentation: markdown(s.definedIn(d))})
+		}
+	case ctxParam, ctxFeederParam:
+		sch, ok := describe(c.frame)
+		if !ok {
+			break
+		}
+		for _, p := range sch.Params {
+			if !slices.Contains(c.frame.params, p.Name) {
+				add(CompletionItem{Label: p.Name, Kind: KindProperty, Detail: paramDetail(p), Documentation: markdown(paramDoc(p)), InsertText: p.Name + "="})
+			}
+		}
+	case ctxArg:
+		if d := findRule(doc.path, doc.ast, c.frame.owner); d != nil && d.node.Formals != nil {
+			for _, p := range d.node.Formals.Params {
+				if !slices.Contains(c.frame.params, p.Name) {
+					add(CompletionItem{Label: p.Name, Kind: KindProperty, Detail: formalDetail(p), InsertText: p.Name + "="})
+				}
+			}
+		}
+	case ctxValue:
+		if c.frame.kind == ctxArg {
+			break
+		}
+		sch, ok := describe(c.frame)
+		if !ok {
+			break
+		}
+		p := sch.Get(c.param)
+		if p == nil {
+			break
+		}
+		values := p.Values
+		if p.Type == schema.Bool && !c.quoted {
+			values = []string{"true", "false"}
+		}
+		for _, v := range values {
+			item := CompletionItem{Label: v, Kind: KindValue}
+			if !c.quoted && p.Type != schema.Bool {
+				item.InsertText = strconv.Quote(v)
+			}
+			add(item)
+		}
+		if p.Type == schema.Rule && !c.quoted {
+			for _, d := range visibleRules(doc.path, doc.ast) {
+				add(CompletionItem{Label: "@" + d.node.Identifier, Kind: KindReference, Detail: signature(d.node)})
+			}
+		}
+	case ctxVariable:
+		for _, name := range visibleDefines(doc.ast) {
+			add(CompletionItem{Label: name, Kind: KindVariable, Detail: "#define"})
+		}
+		if d := findRule(doc.path, doc.ast, c.rule); d != nil && d.node.Formals != nil {
+			for _, p := range d.node.Formals.Params {
+				add(CompletionItem{Label: p.Name, Kind: KindVariable, Detail: "parameter of " + c.rule})
+			}
+		}
+	}
+	return items
+}
+
+// hover returns the documentation of the filter, feeder, parameter or rule in the position
+func (s *Server) hover(doc *document, pos Position) *Hover {
+	c := locate(doc.text, offsetAt(doc.text, pos))
+	if c.token == nil || c.quoted {
+		return nil
+	}
+	name := c.token.Value
+
+	text := ""
+	switch c.kind {
+	case ctxFilter:
+		if sch, ok := filters.Describe(name); ok {
+			text = schemaDoc("filter", name, sch)
+		}
+	case ctxFeeder:
+		if sch, ok := feeders.Describe(name); ok {
+			text = schemaDoc("feeder", name, sch)
+		}
+	case ctxParam, ctxFeederParam:
+		if sch, ok := describe(c.frame); ok {
+			if p := sch.Get(name); p != nil {
+				text = fmt.Sprintf("**%s** `%s`\n\n%s", c.frame.owner, p.Name, paramDoc(*p))
+			}
+		}
+	case ctxArg:
+		if d := findRule(doc.path, doc.ast, c.frame.owner); d != nil && d.node.Formals != nil {
+			for _, p := range d.node.Formals.Params {
+				if p.Name == name {
+					text = fmt.Sprintf("parameter `%s` of `%s`", formalDetail(p), signature(d.node))
+				}
+			}
+		}
+	case ctxRule, ctxRuleName:
+		if d := findRule(doc.path, doc.ast, name); d != nil {
+			text = fmt.Sprintf("**rule** `%s`\n\n%s", signature(d.node), s.definedIn(*d))
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	r := tokenRange(doc.text, c.token)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}
+}
+
+// definition returns the location of the rule called or of the file imported in the position
+func (s *Server) definition(doc *document, pos Position) *Location {
+	lines := strings.Split(doc.text, "\n")
+	if pos.Line < len(lines) {
+		if m := importRegexp.FindStringSubmatch(lines[pos.Line]); m != nil {
+			return &Location{URI: pathToURI(importPath(doc.path, m[1]))}
+		}
+	}
+
+	c := locate(doc.text, offsetAt(doc.text, pos))
+	if c.token == nil || c.quoted || (c.kind != ctxRule && c.kind != ctxRuleName) {
+		return nil
+	}
+	d := findRule(doc.path, doc.ast, c.token.Value)
+	if d == nil {
+		return nil
+	}
+	content, err := s.readFile(d.file)
+	if err != nil {
+		return nil
+	}
+	start := positionAt(string(content), d.node.Pos.Offset)
+	end := start
+	end.Character += utf16Len(d.node.Identifier)
+	return &Location{URI: pathToURI(d.file), Range: Range{Start: start, End: end}}
+}
+
+// definedIn returns where the rule is defined
+func (s *Server) definedIn(d ruleDef) string {
+	text := fmt.Sprintf("defined in `%s:%d`", filepath.Base(d.file), d.node.Pos.Line)
+	if d.node.Feeder != nil {
+		text += fmt.Sprintf(", it receives the messages of the feeder `%s`", d.node.Feeder.Name)
+	}
+	return text
+}
+
+// importPath returns the absolute path of a file imported by the file in path
+func importPath(path string, imported string) string {
+	if !filepath.IsAbs(imported) {
+		imported = filepath.Join(filepath.Dir(path), imported)
+	}
+	if abs, err := filepath.Abs(imported); err == nil {
+		return abs
+	}
+	return imported
+}
+
+func markdown(text string) *MarkupContent {
+	if text == "" {
+		return nil
+	}
+	return &MarkupContent{Kind: "markdown", Value: text}
+}
+
+// signature returns the name of the rule with its parameters
+func signature(node *core.RuleNode) string {
+	if node.Formals == nil {
+		return node.Identifier
+	}
+	params := make([]string, 0, len(node.Formals.Params))
+	for _, p := range node.Formals.Params {
+		params = append(params, formalDetail(p))
+	}
+	return node.Identifier + "(" + strings.Join(params, ", ") + ")"
+}
+
+func formalDetail(p *core.FormalParam) string {
+	if p.Default == nil {
+		return p.Name
+	}
+	return p.Name + "=" + valueText(p.Default)
+}
+
+// valueText returns a value as it can be written in a rule
+func valueText(v *core.Value) string {
+	switch {
+	case v.Var != nil:
+		return "$" + *v.Var
+	case v.String != nil:
+		return strconv.Quote(*v.String)
+	case v.Duration != nil:
+		return *v.Duration
+	case v.Number != nil:
+		return strconv.FormatFloat(*v.Number, 'f', -1, 64)
+	case v.Bool != nil:
+		return *v.Bool
+	case v.Rule != nil:
+		return "@" + *v.Rule
+	case v.List != nil:
+		items := make([]string, 0, len(v.List.Values))
+		for _, item := range v.List.Values {
+			items = append(items, valueText(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case v.Map != nil:
+		entries := make([]string, 0, len(v.Map.Entries))
+		for _, e := range v.Map.Entries {
+			entries = append(entries, strconv.Quote(e.Key)+": "+valueText(e.Value))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return ""
+}
+
+func paramDetail(p schema.Param) string {
+	switch {
+	case p.Required:
+		return fmt.Sprintf("%s, required", p.Type)
+	case p.Default != "":
+		return fmt.Sprintf("%s, default %s", p.Type, p.Default)
+	}
+	return string(p.Type)
+}
+
+// paramDoc returns the documentation of a parameter in markdown
+func paramDoc(p schema.Param) string {
+	text := fmt.Sprintf("*%s*\n\n%s", paramDetail(p), p.Description)
+	if len(p.Values) > 0 {
+		text += "\n\naccepted values: `" + strings.Join(p.Values, "`, `") + "`"
+	}
+	return text
+}
+
+// schemaDoc returns the documentation of a filter or a feeder in markdown, with the table of its parameters
+func schemaDoc(kind string, name string, s schema.Schema) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** `%s`\n\n%s\n", kind, name, s.Description)
+	if len(s.Params) > 0 {
+		b.WriteString("\n| parameter | type | default | description |\n|---|---|---|---|\n")
+		for _, p := range s.Params {
+			def := p.Default
+			if p.Required {
+				def = "required"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", p.Name, p.Type, def, strings.ReplaceAll(p.Description, "|", "\\|"))
+		}
+	}
+	if s.Open {
+		b.WriteString("\nother parameters are accepted and passed as they are\n")
+	}
+	if len(s.Fields) > 0 {
+		fmt.Fprintf(&b, "\nfields set on the messages: `%s`\n", strings.Join(s.Fields, "`, `"))
+	}
+	return b.String()
+}
+
+// offsetAt returns the byte offset of a position in the text
+func offsetAt(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+	units := 0
+	for offset < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+	return offset
+}
+
+// positionAt returns the position of a byte offset in the text
+func positionAt(text string, offset int) Position {
+	offset = min(max(offset, 0), len(text))
+	line := strings.Count(text[:offset], "\n")
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	return Position{Line: line, Character: utf16Len(text[start:offset])}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+func tokenRange(text string, t *core.Token) Range {
+	return Range{Start: positionAt(text, t.Pos.Offset), End: positionAt(text, t.Pos.Offset+len(t.Value))}
+}
+
+// wordRange returns the range of the identifier starting in the line and column (1-based, counting runes) reported by the parser and by the linter
+func wordRange(text string, line int, column int) Range {
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return Range{}
+	}
+	runes := []rune(strings.TrimRight(lines[line-1], "\r"))
+	start := min(max(column-1, 0), len(runes))
+	end := start
+	for end < len(runes) && (runes[end] == '_' || runes[end] == '-' || ('a' <= runes[end] && runes[end] <= 'z') || ('A' <= runes[end] && runes[end] <= 'Z') || ('0' <= runes[end] && runes[end] <= '9')) {
+		end++
+	}
+	if end == start && end < len(runes) {
+		end++
+	}
+	return Range{
+		Start: Position{Line: line - 1, Character: utf16Len(string(runes[:start]))},
+		End:   Position{Line: line - 1, Character: utf16Len(string(runes[:end]))},
+	}
+}
@@ -0,0 +1,135 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	type Test struct {
+		Name   string
+		Text   string
+		Kind   int
+		Prefix string
+		Owner  string
+		Param  string
+		Rule   string
+		Quoted bool
+	}
+
+	// the cursor is in the position of the ^
+	tests := []Test{
+		{"Start", "^", ctxRuleName, "", "", "", "", false},
+		{"RuleName", "ru^le => echo();", ctxRuleName, "ru", "", "", "", false},
+		{"AfterArrow", "r => ^", ctxFilter, "", "", "", "r", false},
+		{"FilterPrefix", "r => ec^", ctxFilter, "ec", "", "", "r", false},
+		{"AfterPipe", "r => echo() | te^xt()", ctxFilter, "te", "", "", "r", false},
+		{"Negated", "r => !^", ctxFilter, "", "", "", "r", false},
+		{"Predicate", "r => if te^", ctxFilter, "te", "", "", "r", false},
+		{"ElseIf", "r => if a() { b() } else if ^", ctxFilter, "", "", "", "r", false},
+		{"Branch", "r => { echo() ; ^", ctxFilter, "", "", "", "r", false},
+		{"Pipeline", "r => if a() { ^", ctxFilter, "", "", "", "r", false},
+		{"Feeder", "r => <ti^", ctxFeeder, "ti", "", "", "r", false},
+		{"FeederParam", "r => <timer: ^", ctxFeederParam, "", "timer", "", "r", false},
+		{"FeederSecondParam", "r => <rss: url=\"x\", fr^", ctxFeederParam, "fr", "rss", "", "r", false},
+		{"FeederValue", "r => <folder: type=^", ctxValue, "", "folder", "type", "r", false},
+		{"AfterFeeder", "r => <timer: freq=1m> | ^", ctxFilter, "", "", "", "r", false},
+		{"Call", "r => @^", ctxRule, "", "", "", "r", false},
+		{"CallPrefix", "a => echo();\nr => echo() | @no^", ctxRule, "no", "", "", "r", false},
+		{"Param", "r => text(^", ctxParam, "", "text", "", "r", false},
+		{"SecondParam", "r => text(pattern=\"a\", ta^", ctxParam, "ta", "text", "", "r", false},
+		{"Value", "r => http(method=^", ctxValue, "", "http", "method", "r", false},
+		{"QuotedValue", "r => http(method=\"PO^", ctxValue, "PO", "http", "method", "r", true},
+		{"InsideString", "r => http(method=\"PO^ST\")", ctxValue, "PO", "http", "method", "r", true},
+		{"OnError", "r => http(url=\"x\", on_error=@^", ctxRule, "", "", "", "r", false},
+		{"Arg", "r => @notify(^", ctxArg, "", "notify", "", "r", false},
+		{"ArgValue", "r => @notify(chat=^", ctxValue, "", "notify", "chat", "r", false},
+		{"Formals", "t(^", ctxNone, "", "t", "", "t", false},
+		{"Variable", "t(a) => echo(to=$^", ctxVariable, "", "", "", "t", false},
+		{"MapValue", "r => echo(m={a: ^", ctxNone, "", "", "", "r", false},
+		{"NextRule", "r => echo();\n^", ctxRuleName, "", "", "", "", false},
+		{"Comment", "# r => echo(\nx => ^", ctxFilter, "", "", "", "x", false},
+	}
+
+	for _, v := range tests {
+		offset := strings.Index(v.Text, "^")
+		c := locate(strings.Replace(v.Text, "^", "", 1), offset)
+		if c.kind != v.Kind {
+			t.Errorf("%s: wrong kind: expected=%#v had=%#v", v.Name, v.Kind, c.kind)
+		}
+		if c.prefix != v.Prefix {
+			t.Errorf("%s: wrong prefix: expected=%#v had=%#v", v.Name, v.Prefix, c.prefix)
+		}
+		owner := ""
+		if c.frame != nil {
+			owner = c.frame.owner
+		}
+		if owner != v.Owner {
+			t.Errorf("%s: wrong owner: expected=%#v had=%#v", v.Name, v.Owner, owner)
+		}
+		if c.param != v.Param {
+			t.Errorf("%s: wrong param: expected=%#v had=%#v", v.Name, v.Param, c.param)
+		}
+		if c.rule != v.Rule {
+			t.Errorf("%s: wrong rule: expected=%#v had=%#v", v.Name, v.Rule, c.rule)
+		}
+		if c.quoted != v.Quoted {
+			t.Errorf("%s: wrong quoted: expected=%#v had=%#v", v.Name, v.Quoted, c.quoted)
+		}
+	}
+}
+
+func TestOffsetAt(t *testing.T) {
+	type Test struct {
+		Text     string
+		Position Position
+		Expected int
+	}
+
+	tests := []Test{
+		{"abc", Position{0, 0}, 0},
+		{"abc", Position{0, 2}, 2},
+		{"abc", Position{0, 10}, 3},
+		{"ab\ncd", Position{1, 1}, 4},
+		{"ab\ncd", Position{5, 0}, 5},
+		{"ab\ncd", Position{0, 5}, 2},
+		// è is 2 bytes and 1 UTF-16 unit, 😀 is 4 bytes and 2 UTF-16 units
+		{"è😀x", Position{0, 1}, 2},
+		{"è😀x", Position{0, 3}, 6},
+	}
+
+	for _, v := range tests {
+		if had := offsetAt(v.Text, v.Position); had != v.Expected {
+			t.Errorf("%q %v: wrong offset: expected=%#v had=%#v", v.Text, v.Position, v.Expected, had)
+		}
+	}
+
+	if had := positionAt("ab\ncd", 4); had != (Position{1, 1}) {
+		t.Errorf("wrong position: expected=%#v had=%#v", Position{1, 1}, had)
+	}
+	if had := positionAt("a\nè😀x", 8); had != (Position{1, 3}) {
+		t.Errorf("wrong position: expected=%#v had=%#v", Position{1, 3}, had)
+	}
+}
+
+func TestWordRange(t *testing.T) {
+	type Test struct {
+		Line     int
+		Column   int
+		Expected Range
+	}
+
+	text := "r => tex-t_1(a=1);\n😀 ab"
+	tests := []Test{
+		{1, 6, Range{Position{0, 5}, Position{0, 12}}},
+		{1, 13, Range{Position{0, 12}, Position{0, 13}}},
+		{2, 3, Range{Position{1, 3}, Position{1, 5}}},
+		{3, 1, Range{}},
+	}
+
+	for _, v := range tests {
+		if had := wordRange(text, v.Line, v.Column); had != v.Expected {
+			t.Errorf("%d:%d: wrong range: expected=%#v had=%#v", v.Line, v.Column, v.Expected, had)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadMessage(t *testing.T) {
+	type Test struct {
+		Name          string
+		Input         string
+		Expected      string
+		ExpectedError string
+	}
+
+	tests := []Test{
+		{"Ok", "Content-Length: 2\r\n\r\n{}", "{}", ""},
+		{"ContentType", "Content-Length: 2\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n[]", "[]", ""},
+		{"EOF", "", "", "EOF"},
+		{"NoLength", "Content-Type: x\r\n\r\n{}", "", "invalid Content-Length ''"},
+		{"InvalidLength", "Content-Length: a\r\n\r\n{}", "", "invalid Content-Length 'a'"},
+		{"Short", "Content-Length: 10\r\n\r\n{}", "", "reading content: unexpected EOF"},
+	}
+
+	for _, v := range tests {
+		content, err := readMessage(bufio.NewReader(strings.NewReader(v.Input)))
+		if (err == nil && v.ExpectedError != "") || (err != nil && err.Error() != v.ExpectedError) {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.ExpectedError, err)
+		}
+		if string(content) != v.Expected {
+			t.Errorf("%s: wrong content: expected=%#v had=%#v", v.Name, v.Expected, string(content))
+		}
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeMessage(&b, notification{JSONRPC: "2.0", Method: "m", Params: nil}); err != nil {
+		t.Fatalf("wrong error: expected=%#v had=%#v", nil, err)
+	}
+	expected := "Content-Length: 44\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"m\",\"params\":null}"
+	if b.String() != expected {
+		t.Errorf("wrong message: expected=%#v had=%#v", expected, b.String())
+	}
+
+	// the written messages can be read back
+	r := bufio.NewReader(&b)
+	b.WriteString(expected)
+	for i := 0; i < 2; i++ {
+		if _, err := readMessage(r); err != nil {
+			t.Errorf("wrong error: expected=%#v had=%#v", nil, err)
+		}
+	}
+	if _, err := readMessage(r); err != io.EOF {
+		t.Errorf("wrong error: expected=%#v had=%#v", io.EOF, err)
+	}
+}
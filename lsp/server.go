@@ -0,0 +1,322 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Matrix86/driplane/core"
+
+	"github.com/evilsocket/islazy/log"
+)
+
+// ErrExitWithoutShutdown is returned by Serve if the client asks to exit without asking to shutdown first
+var ErrExitWithoutShutdown = errors.New("exit received before shutdown")
+
+// document is a rule file opened in the editor
+type document struct {
+	uri     string
+	path    string
+	version int
+	text    string
+	// last AST parsed without errors, used while the text cannot be parsed
+	ast *core.AST
+}
+
+// Server is a language server for the rule files, speaking JSON-RPC on a stream
+type Server struct {
+	sync.Mutex
+
+	config    *core.Configuration
+	documents map[string]*document
+	out       io.Writer
+	shutdown  bool
+}
+
+// NewServer creates a Server, the configuration is used by the checks on the rules (i.e. the cache ttl)
+func NewServer(config *core.Configuration) *Server {
+	if config == nil {
+		config = core.NewConfiguration()
+	}
+	return &Server{
+		config:    config,
+		documents: make(map[string]*document),
+	}
+}
+
+// Serve reads the requests from in and writes the responses and the notifications on out, until the client exits
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		content, err := readMessage(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			s.replyError(nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		result, err := s.handle(req.Method, req.Params)
+		if req.ID == nil {
+			if err != nil {
+				log.Debug("lsp: %s: %s", req.Method, err)
+			}
+			continue
+		}
+		if err != nil {
+			var rerr *responseError
+			if !errors.As(err, &rerr) {
+				rerr = &responseError{Code: codeInvalidParams, Message: err.Error()}
+			}
+			s.replyError(req.ID, rerr)
+			continue
+		}
+		s.send(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+	}
+}
+
+func (s *Server) send(v interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	if err := writeMessage(s.out, v); err != nil {
+		log.Error("lsp: %s", err)
+	}
+}
+
+func (s *Server) replyError(id *json.RawMessage, err *responseError) {
+	s.send(errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+// handle executes the method and returns its result
+func (s *Server) handle(method string, params json.RawMessage) (interface{}, error) {
+	if s.shutdown && method != "shutdown" {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "the server is shutting down"}
+	}
+
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					// the changes are sent as ranges of the document
+					"change": 2,
+					"save":   true,
+				},
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"@", "<", "|", "(", ",", ":", "=", "$", "\""},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": core.Name, "version": core.Version},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		path, err := uriToPath(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		s.documents[p.TextDocument.URI] = &document{uri: p.TextDocument.URI, path: path, version: p.TextDocument.Version, text: p.TextDocument.Text}
+		s.publishDiagnostics()
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc, ok := s.documents[p.TextDocument.URI]
+		if !ok {
+			return nil, fmt.Errorf("document '%s' is not open", p.TextDocument.URI)
+		}
+		for _, change := range p.ContentChanges {
+			if change.Range == nil {
+				doc.text = change.Text
+				continue
+			}
+			start, end := offsetAt(doc.text, change.Range.Start), offsetAt(doc.text, change.Range.End)
+			if end < start {
+				start, end = end, start
+			}
+			doc.text = doc.text[:start] + change.Text + doc.text[end:]
+		}
+		doc.version = p.TextDocument.Version
+		s.publishDiagnostics()
+		return nil, nil
+	case "textDocument/didSave":
+		s.publishDiagnostics()
+		return nil, nil
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.documents, p.TextDocument.URI)
+		s.send(notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}}})
+		s.publishDiagnostics()
+		return nil, nil
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc, ok := s.documents[p.TextDocument.URI]
+		if !ok {
+			return nil, fmt.Errorf("document '%s' is not open", p.TextDocument.URI)
+		}
+		switch method {
+		case "textDocument/completion":
+			return s.completion(doc, p.Position), nil
+		case "textDocument/hover":
+			return s.hover(doc, p.Position), nil
+		}
+		return s.definition(doc, p.Position), nil
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration", "workspace/didChangeWatchedFiles":
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' not supported", method)}
+}
+
+// publishDiagnostics checks all the open documents: a change in a file can affect the files importing it
+func (s *Server) publishDiagnostics() {
+	uris := make([]string, 0, len(s.documents))
+	for uri := range s.documents {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		doc := s.documents[uri]
+		s.send(notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params:  publishDiagnosticsParams{URI: uri, Diagnostics: s.diagnostics(doc)},
+		})
+	}
+}
+
+// readFile returns the text of the open documents and the content on the disk of the other files
+func (s *Server) readFile(filename string) ([]byte, error) {
+	for _, doc := range s.documents {
+		if doc.path == filename {
+			return []byte(doc.text), nil
+		}
+	}
+	return os.ReadFile(filename)
+}
+
+// diagnostics parses the rule files in the directory of the document, as they are loaded by driplane,
+// and runs the checks of the linter on them. It returns the problems found in the document.
+func (s *Server) diagnostics(doc *document) []Diagnostic {
+	dir := filepath.Dir(doc.path)
+	files, _ := filepath.Glob(filepath.Join(dir, "*.rule"))
+	if !slices.Contains(files, doc.path) {
+		// the document is not saved yet or it is not a .rule file
+		files = append(files, doc.path)
+	}
+
+	parser, _ := core.NewParser()
+	parser.SetFileReader(s.readFile)
+	result := make([]Diagnostic, 0)
+	asts := make(map[string]*core.AST)
+	for _, file := range files {
+		ast, err := parser.ParseFile(file)
+		if err != nil {
+			if file == doc.path {
+				result = append(result, s.errorDiagnostic(doc, err))
+			}
+			continue
+		}
+		asts[file] = ast
+		if file == doc.path {
+			doc.ast = ast
+		}
+	}
+
+	config := core.NewConfiguration()
+	for k, v := range s.config.GetConfig() {
+		config.Set(k, v)
+	}
+	if config.Get("general.rules_path") == "" {
+		config.Set("general.rules_path", dir)
+	}
+	for _, d := range core.NewLinter(config, asts).Run() {
+		if d.File != doc.path {
+			continue
+		}
+		severity := SeverityWarning
+		if d.Severity == core.SeverityError {
+			severity = SeverityError
+		}
+		result = append(result, Diagnostic{
+			Range:    wordRange(doc.text, d.Line, d.Column),
+			Severity: severity,
+			Code:     d.Check,
+			Source:   core.Name,
+			Message:  d.Message,
+		})
+	}
+	return result
+}
+
+// errorDiagnostic converts a parsing error in a Diagnostic, the errors of the imported files are reported on the #import line
+func (s *Server) errorDiagnostic(doc *document, err error) Diagnostic {
+	d := Diagnostic{Severity: SeverityError, Code: "syntax", Source: core.Name, Message: err.Error()}
+	var rerr *core.RuleError
+	if errors.As(err, &rerr) && rerr.Pos.Filename == doc.path {
+		d.Range = wordRange(doc.text, rerr.Pos.Line, rerr.Pos.Column)
+		d.Message = rerr.Message
+		return d
+	}
+	for i, line := range strings.Split(doc.text, "\n") {
+		m := importRegexp.FindStringSubmatch(line)
+		if m != nil && strings.Contains(err.Error(), importPath(doc.path, m[1])) {
+			d.Range = Range{Start: Position{Line: i}, End: Position{Line: i, Character: utf16Len(strings.TrimRight(line, "\r"))}}
+			break
+		}
+	}
+	return d
+}
+
+// uriToPath returns the path of a file:// URI
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI '%s': only files are supported", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// pathToURI returns the file:// URI of a path
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
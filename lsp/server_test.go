@@ -0,0 +1,246 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient sends the requests to a Server and collects its answers
+type testClient struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan map[string]json.RawMessage
+	done     chan error
+	lastID   int
+}
+
+func newTestClient(t *testing.T) *testClient {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &testClient{t: t, in: inW, messages: make(chan map[string]json.RawMessage, 100), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(nil).Serve(inR, outW)
+		outW.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(outR)
+		for {
+			content, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(content, &m); err != nil {
+				t.Errorf("wrong message: %s", content)
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+func (c *testClient) send(id int, method string, params interface{}) {
+	m := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id > 0 {
+		m["id"] = id
+	}
+	if err := writeMessage(c.in, m); err != nil {
+		c.t.Fatalf("%s: %s", method, err)
+	}
+}
+
+// next returns the next message sent by the server
+func (c *testClient) next() map[string]json.RawMessage {
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("the server closed the stream")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("no message received from the server")
+	}
+	return nil
+}
+
+// call sends a request and returns the response, the notifications received before it are ignored
+func (c *testClient) call(method string, params interface{}) map[string]json.RawMessage {
+	c.lastID++
+	c.send(c.lastID, method, params)
+	for {
+		m := c.next()
+		if _, ok := m["id"]; ok {
+			return m
+		}
+	}
+}
+
+// diagnostics returns the codes of the next diagnostics published for the uri
+func (c *testClient) diagnostics(uri string) []string {
+	for {
+		m := c.next()
+		var p publishDiagnosticsParams
+		if string(m["method"]) != `"textDocument/publishDiagnostics"` || json.Unmarshal(m["params"], &p) != nil || p.URI != uri {
+			continue
+		}
+		codes := make([]string, 0)
+		for _, d := range p.Diagnostics {
+			codes = append(codes, d.Code)
+		}
+		return codes
+	}
+}
+
+func position(uri string, line int, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	lib := "#define CHAT \"ops\"\nnotify(chat=$CHAT, text=\"{{.main}}\") => echo(to=$chat);\nfeed => <rss: url=\"http://localhost\">;\n"
+	if err := os.WriteFile(filepath.Join(dir, "lib.rule"), []byte(lib), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// main.rule is not saved on the disk
+	uri := pathToURI(filepath.Join(dir, "main.rule"))
+	libURI := pathToURI(filepath.Join(dir, "lib.rule"))
+	text := "#import \"lib.rule\"\n" +
+		"main => @feed | tex(pattern=\"a\") | cache() | @notify(chat=\"dev\");\n" +
+		"other => @feed | html(selector=\"a\", get=\"text\", on_error=@notify);\n" +
+		"files => <folder: type=\"local\", name=\".\">;\n"
+
+	c := newTestClient(t)
+	res := c.call("initialize", map[string]interface{}{})
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	if err := json.Unmarshal(res["result"], &init); err != nil || init.Capabilities["hoverProvider"] != true || init.Capabilities["definitionProvider"] != true {
+		t.Errorf("wrong capabilities: %s", res["result"])
+	}
+	c.send(0, "initialized", map[string]interface{}{})
+
+	c.send(0, "textDocument/didOpen", map[string]interface{}{"textDocument": textDocumentItem{URI: uri, LanguageID: "driplane", Version: 1, Text: text}})
+	if had := c.diagnostics(uri); !reflect.DeepEqual(had, []string{"unknown-name", "cache-ttl"}) {
+		t.Errorf("wrong diagnostics: expected=%#v had=%#v", []string{"unknown-name", "cache-ttl"}, had)
+	}
+
+	type Test struct {
+		Name     string
+		Method   string
+		Line     int
+		Char     int
+		Expected string
+	}
+	tests := []Test{
+		{"CompleteFilter", "textDocument/completion", 1, 18, "telegram text"},
+		{"CompleteRule", "textDocument/completion", 1, 9, "notify feed main other files"},
+		{"CompleteArgs", "textDocument/completion", 1, 53, "chat text"},
+		{"CompleteValues", "textDocument/completion", 2, 41, "html text attr"},
+		{"CompleteRuleValue", "textDocument/completion", 2, 57, "@notify @feed @main @other @files"},
+		{"CompleteFeederValue", "textDocument/completion", 3, 24, "local dropbox gdrive s3 git"},
+		{"CompleteFeederParam", "textDocument/completion", 3, 32, "name freq order"},
+		{"CompleteNothing", "textDocument/completion", 0, 3, ""},
+		{"HoverFilter", "textDocument/hover", 2, 18, "**filter** `html`"},
+		{"HoverParam", "textDocument/hover", 2, 37, "**html** `get`"},
+		{"HoverFeeder", "textDocument/hover", 3, 12, "**feeder** `folder`"},
+		{"HoverRule", "textDocument/hover", 1, 10, "**rule** `feed`\n\ndefined in `lib.rule:3`, it receives the messages of the feeder `rss`"},
+		{"HoverTemplate", "textDocument/hover", 1, 48, "**rule** `notify(chat=$CHAT, text=\"{{.main}}\")`"},
+		{"HoverUnknown", "textDocument/hover", 1, 17, "null"},
+		{"DefinitionRule", "textDocument/definition", 1, 50, libURI + " 1:0-1:6"},
+		{"DefinitionOnError", "textDocument/definition", 2, 60, libURI + " 1:0-1:6"},
+		{"DefinitionImport", "textDocument/definition", 0, 3, libURI + " 0:0-0:0"},
+		{"DefinitionNone", "textDocument/definition", 1, 18, "null"},
+	}
+	for _, v := range tests {
+		res := c.call(v.Method, position(uri, v.Line, v.Char))
+		had := string(res["result"])
+		switch v.Method {
+		case "textDocument/completion":
+			var items []CompletionItem
+			if err := json.Unmarshal(res["result"], &items); err != nil {
+				t.Errorf("%s: wrong result: %s", v.Name, res["result"])
+			}
+			labels := make([]string, 0)
+			for _, item := range items {
+				labels = append(labels, item.Label)
+			}
+			had = strings.Join(labels, " ")
+		case "textDocument/hover":
+			var h *Hover
+			if err := json.Unmarshal(res["result"], &h); err == nil && h != nil {
+				had = h.Contents.Value
+			}
+		case "textDocument/definition":
+			var l *Location
+			if err := json.Unmarshal(res["result"], &l); err == nil && l != nil {
+				had = fmt.Sprintf("%s %d:%d-%d:%d", l.URI, l.Range.Start.Line, l.Range.Start.Character, l.Range.End.Line, l.Range.End.Character)
+			}
+		}
+		if (v.Method == "textDocument/hover" && !strings.HasPrefix(had, v.Expected)) || (v.Method != "textDocument/hover" && had != v.Expected) {
+			t.Errorf("%s: wrong result: expected=%#v had=%#v", v.Name, v.Expected, had)
+		}
+	}
+
+	// the rename of the filter fixes the first diagnostic
+	c.send(0, "textDocument/didChange", map[string]interface{}{
+		"textDocument":   versionedTextDocumentIdentifier{URI: uri, Version: 2},
+		"contentChanges": []textDocumentContentChangeEvent{{Range: &Range{Start: Position{1, 19}, End: Position{1, 19}}, Text: "t"}},
+	})
+	if had := c.diagnostics(uri); !reflect.DeepEqual(had, []string{"cache-ttl"}) {
+		t.Errorf("wrong diagnostics after change: expected=%#v had=%#v", []string{"cache-ttl"}, had)
+	}
+	// the document can't be parsed: the last parsed version is used for the rules
+	c.send(0, "textDocument/didChange", map[string]interface{}{
+		"textDocument":   versionedTextDocumentIdentifier{URI: uri, Version: 3},
+		"contentChanges": []textDocumentContentChangeEvent{{Text: text + "x => echo(to=$"}},
+	})
+	if had := c.diagnostics(uri); !reflect.DeepEqual(had, []string{"syntax"}) {
+		t.Errorf("wrong diagnostics after change: expected=%#v had=%#v", []string{"syntax"}, had)
+	}
+	res = c.call("textDocument/completion", position(uri, 4, 14))
+	if !strings.Contains(string(res["result"]), `"label":"CHAT"`) {
+		t.Errorf("wrong completion: expected=%#v had=%s", "CHAT", res["result"])
+	}
+
+	res = c.call("textDocument/rename", position(uri, 0, 0))
+	if !strings.Contains(string(res["error"]), "-32601") {
+		t.Errorf("wrong error: expected=%#v had=%s", "method not found", res["error"])
+	}
+	res = c.call("textDocument/hover", position("file:///not/open.rule", 0, 0))
+	if !strings.Contains(string(res["error"]), "is not open") {
+		t.Errorf("wrong error: expected=%#v had=%s", "not open", res["error"])
+	}
+
+	c.send(0, "textDocument/didClose", map[string]interface{}{"textDocument": textDocumentIdentifier{URI: uri}})
+	if had := c.diagnostics(uri); len(had) != 0 {
+		t.Errorf("wrong diagnostics after close: expected=%#v had=%#v", []string{}, had)
+	}
+
+	if res := c.call("shutdown", nil); string(res["result"]) != "null" {
+		t.Errorf("wrong shutdown result: %s", res["result"])
+	}
+	c.send(0, "exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("wrong error: expected=%#v had=%#v", nil, err)
+	}
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	c := newTestClient(t)
+	c.send(0, "exit", nil)
+	if err := <-c.done; err != ErrExitWithoutShutdown {
+		t.Errorf("wrong error: expected=%#v had=%#v", ErrExitWithoutShutdown, err)
+	}
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+	labels   = []string{"rule", "node"}
+
+	filterReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "driplane",
+		Subsystem: "filter",
+		Name:      "received_total",
+		Help:      "Number of messages received by the filter.",
+	}, labels)
+	filterMatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "driplane",
+		Subsystem: "filter",
+		Name:      "matched_total",
+		Help:      "Number of messages propagated by the filter.",
+	}, labels)
+	filterDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "driplane",
+		Subsystem: "filter",
+		Name:      "dropped_total",
+		Help:      "Number of messages not propagated by the filter.",
+	}, labels)
+	filterErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "driplane",
+		Subsystem: "filter",
+		Name:      "errors_total",
+		Help:      "Number of messages that caused an error in the filter.",
+	}, labels)
+	filterDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "driplane",
+		Subsystem: "filter",
+		Name:      "duration_seconds",
+		Help:      "Time spent by the filter to process a message.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10),
+	}, labels)
+	filterQueueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "driplane",
+		Subsystem: "filter",
+		Name:      "queue_length",
+		Help:      "Number of messages waiting to be processed by the filter.",
+	}, labels)
+	filterQueueDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "driplane",
+		Subsystem: "filter",
+		Name:      "queue_dropped_total",
+		Help:      "Number of messages discarded because the queue of the filter was full.",
+	}, labels)
+	feederMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "driplane",
+		Subsystem: "feeder",
+		Name:      "messages_total",
+		Help:      "Number of messages propagated by the feeder.",
+	}, labels)
+	feederLastMessage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "driplane",
+		Subsystem: "feeder",
+		Name:      "last_message_timestamp_seconds",
+		Help:      "Unix time of the last message propagated by the feeder.",
+	}, labels)
+)
+
+func init() {
+	registry.MustRegister(
+		filterReceived,
+		filterMatched,
+		filterDropped,
+		filterErrors,
+		filterDuration,
+		filterQueueLength,
+		filterQueueDropped,
+		feederMessages,
+		feederLastMessage,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+// FilterReceived counts a message received by a filter
+func FilterReceived(rule string, node string) {
+	filterReceived.WithLabelValues(rule, node).Inc()
+}
+
+// FilterDone records the result and the duration of a filter execution
+func FilterDone(rule string, node string, matched bool, err error, elapsed time.Duration) {
+	filterDuration.WithLabelValues(rule, node).Observe(elapsed.Seconds())
+	if err != nil {
+		filterErrors.WithLabelValues(rule, node).Inc()
+	}
+	if matched {
+		filterMatched.WithLabelValues(rule, node).Inc()
+	} else {
+		filterDropped.WithLabelValues(rule, node).Inc()
+	}
+}
+
+// QueueLength records the number of messages waiting in the queue of a filter
+func QueueLength(rule string, node string, n int) {
+	filterQueueLength.WithLabelValues(rule, node).Set(float64(n))
+}
+
+// QueueDropped counts a message discarded because the queue of a filter was full
+func QueueDropped(rule string, node string) {
+	filterQueueDropped.WithLabelValues(rule, node).Inc()
+}
+
+// FeederPropagated counts a message propagated by a feeder
+func FeederPropagated(rule string, node string) {
+	feederMessages.WithLabelValues(rule, node).Inc()
+	feederLastMessage.WithLabelValues(rule, node).SetToCurrentTime()
+}
+
+// Forget removes all the metrics of a node (i.e. when its rule is unloaded)
+func Forget(rule string, node string) {
+	for _, c := range []*prometheus.CounterVec{filterReceived, filterMatched, filterDropped, filterErrors, filterQueueDropped, feederMessages} {
+		c.DeleteLabelValues(rule, node)
+	}
+	filterDuration.DeleteLabelValues(rule, node)
+	filterQueueLength.DeleteLabelValues(rule, node)
+	feederLastMessage.DeleteLabelValues(rule, node)
+}
+
+// Handler returns the http.Handler exposing the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	// the registry is shared by the whole process, so the test starts from empty series
+	Forget("rule1", "echofilter:1")
+	Forget("rule1", "rssfeeder:2")
+
+	FilterReceived("rule1", "echofilter:1")
+	FilterReceived("rule1", "echofilter:1")
+	FilterDone("rule1", "echofilter:1", true, nil, time.Millisecond)
+	FilterDone("rule1", "echofilter:1", false, fmt.Errorf("error"), time.Millisecond)
+	QueueLength("rule1", "echofilter:1", 3)
+	QueueDropped("rule1", "echofilter:1")
+	FeederPropagated("rule1", "rssfeeder:2")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	expected := []string{
+		`driplane_filter_received_total{node="echofilter:1",rule="rule1"} 2`,
+		`driplane_filter_matched_total{node="echofilter:1",rule="rule1"} 1`,
+		`driplane_filter_dropped_total{node="echofilter:1",rule="rule1"} 1`,
+		`driplane_filter_errors_total{node="echofilter:1",rule="rule1"} 1`,
+		`driplane_filter_duration_seconds_count{node="echofilter:1",rule="rule1"} 2`,
+		`driplane_filter_queue_length{node="echofilter:1",rule="rule1"} 3`,
+		`driplane_filter_queue_dropped_total{node="echofilter:1",rule="rule1"} 1`,
+		`driplane_feeder_messages_total{node="rssfeeder:2",rule="rule1"} 1`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(body), e) {
+			t.Errorf("metric not found: %s", e)
+		}
+	}
+
+	Forget("rule1", "echofilter:1")
+	Forget("rule1", "rssfeeder:2")
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ = io.ReadAll(rec.Body)
+	for _, node := range []string{"echofilter:1", "rssfeeder:2"} {
+		if strings.Contains(string(body), `node="`+node+`"`) {
+			t.Errorf("the metrics of %s should be removed", node)
+		}
+	}
+}
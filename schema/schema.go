@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the kind of value accepted by a parameter
+type Type string
+
+// Types of the parameters: every value is received as a string, the type defines how it is parsed
+const (
+	String   Type = "string"
+	Int      Type = "int"
+	Number   Type = "number"
+	Bool     Type = "bool"
+	Duration Type = "duration"
+	// List is a JSON array, written in the rules as a list
+	List Type = "list"
+	// Map is a JSON object, written in the rules as a map
+	Map Type = "map"
+	// Rule is a reference to a rule, i.e. @rule_name
+	Rule Type = "rule"
+)
+
+// Param describes a parameter accepted by a filter or a feeder
+type Param struct {
+	Name        string
+	Type        Type
+	Default     string
+	Required    bool
+	Description string
+	// Values contains the accepted values, any value is accepted if it's empty
+	Values []string
+	// Output is true if the value is the name of a field of the Message that can be set by the filter
+	Output bool
+}
+
+// Schema describes a filter or a feeder and the parameters it accepts
+type Schema struct {
+	Description string
+	Params      []Param
+	// Open schemas accept also parameters that are not declared, passing them as they are
+	Open bool
+	// Fields are the extra fields set on the Messages
+	Fields []string
+	// DynamicFields is true if the extra fields set on the Messages are not known in advance
+	DynamicFields bool
+	// PassThrough is true for the filters propagating all the Messages they receive, unless an error occurs
+	PassThrough bool
+}
+
+// Get returns the parameter with the name, nil if it's not declared
+func (s *Schema) Get(name string) *Param {
+	for i := range s.Params {
+		if s.Params[i].Name == name {
+			return &s.Params[i]
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the declared parameters
+func (s *Schema) Names() []string {
+	names := make([]string, 0, len(s.Params))
+	for _, p := range s.Params {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Check returns an error if the value cannot be parsed with the type of the parameter or it is not one of the accepted values
+func (p *Param) Check(value string) error {
+	var err error
+	switch p.Type {
+	case Int:
+		_, err = strconv.Atoi(value)
+	case Number:
+		_, err = strconv.ParseFloat(value, 64)
+	case Bool:
+		// the filters and the feeders compare the value with "true", so the other forms of strconv.ParseBool are refused
+		if value != "true" && value != "false" {
+			err = fmt.Errorf("not a bool")
+		}
+	case Duration:
+		_, err = time.ParseDuration(value)
+	case List:
+		var v []interface{}
+		err = json.Unmarshal([]byte(value), &v)
+	case Map:
+		var v map[string]interface{}
+		err = json.Unmarshal([]byte(value), &v)
+	}
+	if err != nil {
+		return fmt.Errorf("parameter '%s' expects a value of type %s, got '%s'", p.Name, p.Type, value)
+	}
+	if len(p.Values) > 0 && !slices.Contains(p.Values, value) {
+		return fmt.Errorf("parameter '%s' accepts only %s, got '%s'", p.Name, quote(p.Values), value)
+	}
+	return nil
+}
+
+func quote(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, "'"+v+"'")
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestSchemaGet(t *testing.T) {
+	s := Schema{Params: []Param{{Name: "url", Type: String}, {Name: "freq", Type: Duration}}}
+	if p := s.Get("freq"); p == nil || p.Type != Duration {
+		t.Errorf("wrong param: expected=%#v had=%#v", "freq", p)
+	}
+	if p := s.Get("Freq"); p != nil {
+		t.Errorf("wrong param: expected=nil had=%#v", p)
+	}
+	if names := s.Names(); len(names) != 2 || names[0] != "url" || names[1] != "freq" {
+		t.Errorf("wrong names: expected=%#v had=%#v", []string{"url", "freq"}, names)
+	}
+}
+
+func TestParamCheck(t *testing.T) {
+	type Test struct {
+		Name     string
+		Param    Param
+		Value    string
+		Expected string
+	}
+	tests := []Test{
+		{"String", Param{Name: "p", Type: String}, "anything", ""},
+		{"Int", Param{Name: "p", Type: Int}, "42", ""},
+		{"WrongInt", Param{Name: "p", Type: Int}, "4.2", "parameter 'p' expects a value of type int, got '4.2'"},
+		{"Number", Param{Name: "p", Type: Number}, "-0.5", ""},
+		{"WrongNumber", Param{Name: "p", Type: Number}, "five", "parameter 'p' expects a value of type number, got 'five'"},
+		{"Bool", Param{Name: "p", Type: Bool}, "false", ""},
+		{"WrongBool", Param{Name: "p", Type: Bool}, "yes", "parameter 'p' expects a value of type bool, got 'yes'"},
+		{"NumericBool", Param{Name: "p", Type: Bool}, "1", "parameter 'p' expects a value of type bool, got '1'"},
+		{"UpperCaseBool", Param{Name: "p", Type: Bool}, "TRUE", "parameter 'p' expects a value of type bool, got 'TRUE'"},
+		{"Duration", Param{Name: "p", Type: Duration}, "1h30m", ""},
+		{"WrongDuration", Param{Name: "p", Type: Duration}, "10", "parameter 'p' expects a value of type duration, got '10'"},
+		{"List", Param{Name: "p", Type: List}, `["a",1]`, ""},
+		{"WrongList", Param{Name: "p", Type: List}, `{"a":1}`, "parameter 'p' expects a value of type list, got '{\"a\":1}'"},
+		{"Map", Param{Name: "p", Type: Map}, `{"a":1}`, ""},
+		{"WrongMap", Param{Name: "p", Type: Map}, "a=1", "parameter 'p' expects a value of type map, got 'a=1'"},
+		{"Rule", Param{Name: "p", Type: Rule}, "anything", ""},
+		{"Values", Param{Name: "p", Type: String, Values: []string{"a", "b"}}, "b", ""},
+		{"WrongValues", Param{Name: "p", Type: String, Values: []string{"a", "b"}}, "c", "parameter 'p' accepts only 'a', 'b', got 'c'"},
+	}
+
+	for _, v := range tests {
+		err := v.Param.Check(v.Value)
+		had := ""
+		if err != nil {
+			had = err.Error()
+		}
+		if had != v.Expected {
+			t.Errorf("%s: wrong error: expected=%#v had=%#v", v.Name, v.Expected, had)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// CheckpointStore is a file where the feeders save their state between restarts.
+// Each state is stored under a key and it can be any gob encodable value.
+type CheckpointStore struct {
+	sync.Mutex
+
+	filename string
+}
+
+var (
+	checkpointStores = make(map[string]*CheckpointStore)
+	checkpointLock   sync.Mutex
+)
+
+// GetCheckpointStore returns the CheckpointStore that uses filename (one per file)
+func GetCheckpointStore(filename string) *CheckpointStore {
+	checkpointLock.Lock()
+	defer checkpointLock.Unlock()
+	if s, ok := checkpointStores[filename]; ok {
+		return s
+	}
+	s := &CheckpointStore{filename: filename}
+	checkpointStores[filename] = s
+	return s
+}
+
+func (s *CheckpointStore) lockFile() (*flock.Flock, error) {
+	lock := flock.New(s.filename + ".lock")
+	lockCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	locked, err := lock.TryLockContext(lockCtx, 500*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("file locking: %s", err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("file locking: cannot lock %s", s.filename)
+	}
+	return lock, nil
+}
+
+// read returns all the checkpoints stored in the file. The caller has to hold the file lock.
+func (s *CheckpointStore) read() (map[string][]byte, error) {
+	dict := make(map[string][]byte)
+
+	info, err := os.Stat(s.filename)
+	if os.IsNotExist(err) || (err == nil && info.Size() == 0) {
+		return dict, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(s.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := gob.NewDecoder(file).Decode(&dict); err != nil {
+		return nil, fmt.Errorf("decoding: %s", err)
+	}
+	return dict, nil
+}
+
+// Load decodes in v the checkpoint saved with key. It returns false if the key doesn't exist.
+func (s *CheckpointStore) Load(key string, v interface{}) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	lock, err := s.lockFile()
+	if err != nil {
+		return false, err
+	}
+	defer lock.Unlock()
+
+	dict, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	b, ok := dict[key]
+	if !ok {
+		return false, nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		return false, fmt.Errorf("decoding '%s': %s", key, err)
+	}
+	return true, nil
+}
+
+// Save stores v as the checkpoint of key, replacing the previous one
+func (s *CheckpointStore) Save(key string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("encoding '%s': %s", key, err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	lock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	dict, err := s.read()
+	if err != nil {
+		return err
+	}
+	dict[key] = buf.Bytes()
+
+	// writing on a temporary file to avoid to lose all the checkpoints if something goes wrong
+	tmp := s.filename + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(file).Encode(dict); err != nil {
+		file.Close()
+		return fmt.Errorf("encoding: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCheckpointStore(t *testing.T) {
+	filename := path.Join(t.TempDir(), "checkpoints")
+	s := GetCheckpointStore(filename)
+	if s != GetCheckpointStore(filename) {
+		t.Errorf("the same file should return the same store")
+	}
+
+	var last time.Time
+	found, err := s.Load("rule:rssfeeder", &last)
+	if err != nil {
+		t.Errorf("load on a missing file returned '%s'", err)
+	}
+	if found {
+		t.Errorf("the key should not be found")
+	}
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := s.Save("rule:rssfeeder", now); err != nil {
+		t.Fatalf("save returned '%s'", err)
+	}
+	if err := s.Save("rule:aptfeeder", map[string]bool{"a.deb": true}); err != nil {
+		t.Fatalf("save returned '%s'", err)
+	}
+
+	// a new store reads the data written by the previous one
+	other := &CheckpointStore{filename: filename}
+	found, err = other.Load("rule:rssfeeder", &last)
+	if err != nil || !found {
+		t.Fatalf("key not loaded: found=%t err=%v", found, err)
+	}
+	if !last.Equal(now) {
+		t.Errorf("wrong value: expected=%s had=%s", now, last)
+	}
+	seen := make(map[string]bool)
+	if found, err := other.Load("rule:aptfeeder", &seen); err != nil || !found || !seen["a.deb"] {
+		t.Errorf("wrong value: found=%t err=%v value=%#v", found, err, seen)
+	}
+
+	if _, err := os.Stat(filename + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file has not been removed")
+	}
+}
+
+func TestCheckpointStoreWrongType(t *testing.T) {
+	s := &CheckpointStore{filename: path.Join(t.TempDir(), "checkpoints")}
+	if err := s.Save("key", "a string"); err != nil {
+		t.Fatalf("save returned '%s'", err)
+	}
+	var v map[string]bool
+	if _, err := s.Load("key", &v); err == nil {
+		t.Errorf("decoding in a wrong type should return an error")
+	}
+}
+
+func TestCheckpointStoreCorrupted(t *testing.T) {
+	filename := path.Join(t.TempDir(), "checkpoints")
+	if err := os.WriteFile(filename, []byte("not a gob"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &CheckpointStore{filename: filename}
+	var v string
+	if _, err := s.Load("key", &v); err == nil {
+		t.Errorf("a corrupted file should return an error")
+	}
+}
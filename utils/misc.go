@@ -11,6 +11,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -180,3 +181,60 @@ func flatType(s interface{}, prefix string, flatten map[string]string) {
 		flatten[strings.ToLower(prefix)] = fmt.Sprintf("%v", s)
 	}
 }
+
+// Levenshtein returns the edit distance between the strings a and b
+func Levenshtein(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	prev := make([]int, len(y)+1)
+	curr := make([]int, len(y)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		curr[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(y)]
+}
+
+// Suggest returns at most max candidates similar to name, the most similar first.
+// A candidate is similar if it starts with name or if their edit distance is at most a third of the length of name (at least 1).
+func Suggest(name string, candidates []string, max int) []string {
+	type scored struct {
+		value    string
+		distance int
+	}
+	lower := strings.ToLower(name)
+	threshold := len([]rune(name)) / 3
+	if threshold < 1 {
+		threshold = 1
+	}
+	found := make([]scored, 0)
+	for _, c := range candidates {
+		candidate := strings.ToLower(c)
+		if lower != "" && strings.HasPrefix(candidate, lower) {
+			// the candidates completing the name come first
+			found = append(found, scored{c, -1})
+		} else if d := Levenshtein(lower, candidate); d <= threshold {
+			found = append(found, scored{c, d})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].value < found[j].value
+	})
+	result := make([]string, 0, max)
+	for i := 0; i < len(found) && i < max; i++ {
+		result = append(result, found[i].value)
+	}
+	return result
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"os"
 	"path"
+	"reflect"
 	"testing"
 )
 
@@ -263,3 +264,49 @@ func TestFlatStructMapWithIntKeys(t *testing.T) {
 		t.Errorf("expected empty map for int-keyed map, got %d entries", len(flat))
 	}
 }
+
+func TestLevenshtein(t *testing.T) {
+	type Test struct {
+		A        string
+		B        string
+		Expected int
+	}
+	tests := []Test{
+		{"", "", 0},
+		{"text", "text", 0},
+		{"", "abc", 3},
+		{"txt", "text", 1},
+		{"kitten", "sitting", 3},
+		{"città", "citta", 1},
+	}
+	for _, v := range tests {
+		if d := Levenshtein(v.A, v.B); d != v.Expected {
+			t.Errorf("%s-%s: wrong distance: expected=%d had=%d", v.A, v.B, v.Expected, d)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"text", "format", "file", "folder", "telegram", "http", "hash"}
+	type Test struct {
+		Name     string
+		Expected []string
+	}
+	tests := []Test{
+		{"txt", []string{"text"}},
+		{"Text", []string{"text"}},
+		{"tele", []string{"telegram"}},
+		{"fil", []string{"file"}},
+		{"htp", []string{"http"}},
+		{"nothing", []string{}},
+	}
+	for _, v := range tests {
+		had := Suggest(v.Name, candidates, 3)
+		if !reflect.DeepEqual(had, v.Expected) {
+			t.Errorf("%s: wrong suggestions: expected=%#v had=%#v", v.Name, v.Expected, had)
+		}
+	}
+	if had := Suggest("f", candidates, 2); len(had) != 2 {
+		t.Errorf("wrong number of suggestions: expected=2 had=%d", len(had))
+	}
+}